@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"time"
+)
+
+// registerAdminRoutes mounts the operator-facing endpoints: metrics, admin APIs and diagnostics
+func (w *OAuthWrapper) registerAdminRoutes(mux *http.ServeMux) {
+	mux.Handle("/metrics", allowMethods(defaultRegistry, http.MethodGet))
+	mux.Handle("/admin/tokens", allowMethods(w.requireAdmin(http.HandlerFunc(w.handleAdminTokens)), http.MethodGet))
+	mux.Handle("/admin/clients/export", allowMethods(w.requireAdmin(http.HandlerFunc(w.handleAdminClientExport)), http.MethodGet))
+	mux.Handle("/admin/clients/import", allowMethods(w.requireAdmin(http.HandlerFunc(w.handleAdminClientImport)), http.MethodPost))
+	mux.Handle("/admin/clients/{id}/sessions", allowMethods(w.requireAdmin(http.HandlerFunc(w.handleAdminClientSessions)), http.MethodGet))
+	mux.Handle("/admin/drain", allowMethods(w.requireAdmin(http.HandlerFunc(w.handleAdminDrain)), http.MethodPost))
+	mux.Handle("/admin/undrain", allowMethods(w.requireAdmin(http.HandlerFunc(w.handleAdminUndrain)), http.MethodPost))
+	mux.Handle("/admin/revoke-all", allowMethods(w.requireAdmin(http.HandlerFunc(w.handleAdminRevokeAll)), http.MethodPost))
+}
+
+// adminRoutes builds the handler for the separate admin listener
+func (w *OAuthWrapper) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	w.registerAdminRoutes(mux)
+
+	// Profiling is only ever exposed here, never on the public listener
+	if w.enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return requestID(w.resolveClientIP(recoverPanics(serverHeader(mux))))
+}
+
+// requireAdmin guards admin APIs with the admin token; they don't exist when no token is configured
+func (w *OAuthWrapper) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		adminToken := w.currentSecrets().AdminToken
+		if adminToken == "" {
+			http.NotFound(rw, r)
+			return
+		}
+		token, ok := bearerToken(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeJSONError(rw, http.StatusUnauthorized, "invalid_token", "A valid admin token is required")
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// AdminTokenInfo describes an access token for operators without revealing it
+type AdminTokenInfo struct {
+	ID         string     `json:"id"`
+	ClientID   string     `json:"client_id"`
+	Audience   []string   `json:"audience,omitempty"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	UseCount   int64      `json:"use_count"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// tokenID is a stable, non-reversible identifier for a token, safe to show in listings and logs
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Handle the admin token listing, most recently used first
+func (w *OAuthWrapper) handleAdminTokens(rw http.ResponseWriter, r *http.Request) {
+	tokens := make([]AdminTokenInfo, 0, w.accessTokens.Len())
+	w.accessTokens.Range(func(token string, at *AccessToken) bool {
+		tokens = append(tokens, adminTokenInfo(token, at))
+		return true
+	})
+	sortByActivity(tokens)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(map[string]any{"tokens": tokens, "tokens_per_client": w.accessTokens.ClientCounts()})
+}
+
+func adminTokenInfo(token string, at *AccessToken) AdminTokenInfo {
+	info := AdminTokenInfo{
+		ID:        tokenID(token),
+		ClientID:  at.ClientID,
+		Audience:  at.Audience,
+		Scopes:    at.Scopes,
+		CreatedAt: at.CreatedAt,
+		UseCount:  at.UseCount(),
+		ExpiresAt: at.ExpiresAt,
+	}
+	if lastUsed := at.LastUsedAt(); !lastUsed.IsZero() {
+		info.LastUsedAt = &lastUsed
+	}
+	return info
+}
+
+// sortByActivity orders tokens most recently used first
+func sortByActivity(tokens []AdminTokenInfo) {
+	sort.Slice(tokens, func(i, j int) bool {
+		return lastActivity(tokens[i]).After(lastActivity(tokens[j]))
+	})
+}
+
+// lastActivity is when a token was last used, or issued if it never was
+func lastActivity(info AdminTokenInfo) time.Time {
+	if info.LastUsedAt != nil {
+		return *info.LastUsedAt
+	}
+	return info.CreatedAt
+}
+
+// AdminClientInfo is a registered client's metadata without its secret
+type AdminClientInfo struct {
+	ClientID                string    `json:"client_id"`
+	ClientName              string    `json:"client_name"`
+	RedirectURIs            []string  `json:"redirect_uris"`
+	GrantTypes              []string  `json:"grant_types"`
+	ResponseTypes           []string  `json:"response_types"`
+	TokenEndpointAuthMethod string    `json:"token_endpoint_auth_method"`
+	Public                  bool      `json:"public"`
+	Static                  bool      `json:"static"`
+	IssuedAt                time.Time `json:"issued_at"`
+	// Descriptive metadata the client registered, for inventory and ownership
+	ClientURI  string                     `json:"client_uri,omitempty"`
+	LogoURI    string                     `json:"logo_uri,omitempty"`
+	Contacts   []string                   `json:"contacts,omitempty"`
+	Metadata   map[string]string          `json:"metadata,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+}
+
+// AdminAuthCodeInfo describes an unredeemed authorization code without revealing it
+type AdminAuthCodeInfo struct {
+	ID          string    `json:"id"`
+	RedirectURI string    `json:"redirect_uri"`
+	PKCE        bool      `json:"pkce"`
+	Audience    []string  `json:"audience,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Expired     bool      `json:"expired"`
+}
+
+// AdminClientSessions is everything the wrapper holds for one client, for debugging its OAuth flow
+type AdminClientSessions struct {
+	Client    AdminClientInfo     `json:"client"`
+	AuthCodes []AdminAuthCodeInfo `json:"auth_codes"`
+	Tokens    []AdminTokenInfo    `json:"tokens"`
+	// ActiveTokens counts the client's unexpired tokens, the number its per-client limit applies to
+	ActiveTokens int `json:"active_tokens"`
+}
+
+// Handle the admin view of one client's registration, outstanding codes and active tokens
+func (w *OAuthWrapper) handleAdminClientSessions(rw http.ResponseWriter, r *http.Request) {
+	clientID := r.PathValue("id")
+	now := w.now()
+
+	w.mu.RLock()
+	client, exists := w.clients[clientID]
+	codes := []AdminAuthCodeInfo{}
+	if exists {
+		for code, authCode := range w.authCodes {
+			if authCode.ClientID != clientID {
+				continue
+			}
+			codes = append(codes, AdminAuthCodeInfo{
+				ID:          tokenID(code),
+				RedirectURI: authCode.RedirectURI,
+				PKCE:        authCode.CodeChallenge != "",
+				Audience:    authCode.Audience,
+				ExpiresAt:   authCode.ExpiresAt,
+				Expired:     now.After(authCode.ExpiresAt),
+			})
+		}
+	}
+	w.mu.RUnlock()
+
+	if !exists {
+		writeJSONError(rw, http.StatusNotFound, "invalid_client", "Unknown client_id")
+		return
+	}
+
+	sessions := AdminClientSessions{
+		Client: AdminClientInfo{
+			ClientID:                client.ClientID,
+			ClientName:              client.ClientName,
+			RedirectURIs:            client.RedirectURIs,
+			GrantTypes:              client.GrantTypes,
+			ResponseTypes:           client.ResponseTypes,
+			TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+			Public:                  client.isPublic(),
+			Static:                  client.Static,
+			IssuedAt:                time.Unix(client.ClientIDIssuedAt, 0).UTC(),
+			ClientURI:               client.ClientURI,
+			LogoURI:                 client.LogoURI,
+			Contacts:                client.Contacts,
+			Metadata:                client.Metadata,
+			Extensions:              client.Extensions,
+		},
+		AuthCodes: codes,
+		Tokens:    []AdminTokenInfo{},
+	}
+	sort.Slice(sessions.AuthCodes, func(i, j int) bool {
+		return sessions.AuthCodes[i].ExpiresAt.Before(sessions.AuthCodes[j].ExpiresAt)
+	})
+
+	for _, token := range w.accessTokens.ClientTokens(clientID) {
+		if at, ok := w.accessTokens.Get(token); ok {
+			sessions.Tokens = append(sessions.Tokens, adminTokenInfo(token, at))
+			if !at.expired(now, w.tokenIdleTTL, w.clockSkew) {
+				sessions.ActiveTokens++
+			}
+		}
+	}
+	sortByActivity(sessions.Tokens)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(sessions)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getStatus returns the status code of a GET for path
+func getStatus(h http.Handler, path string) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestAdminRoutesSplit(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	if code := getStatus(w.routes(), "/metrics"); code != http.StatusOK {
+		t.Errorf("without an admin address, /metrics should be on the main listener, got %d", code)
+	}
+
+	w.adminAddr = "127.0.0.1:9090"
+	if code := getStatus(w.routes(), "/metrics"); code != http.StatusNotFound {
+		t.Errorf("with an admin address, /metrics should not be on the main listener, got %d", code)
+	}
+	if code := getStatus(w.adminRoutes(), "/metrics"); code != http.StatusOK {
+		t.Errorf("expected /metrics on the admin listener, got %d", code)
+	}
+	if code := getStatus(w.adminRoutes(), "/token"); code != http.StatusNotFound {
+		t.Errorf("OAuth endpoints should not be on the admin listener, got %d", code)
+	}
+}
+
+func TestPprofOnlyOnAdminListener(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.adminAddr = "127.0.0.1:9090"
+	if code := getStatus(w.adminRoutes(), "/debug/pprof/goroutine?debug=1"); code != http.StatusNotFound {
+		t.Errorf("pprof should be off by default, got %d", code)
+	}
+
+	w.enablePprof = true
+	if code := getStatus(w.adminRoutes(), "/debug/pprof/goroutine?debug=1"); code != http.StatusOK {
+		t.Errorf("expected pprof on the admin listener, got %d", code)
+	}
+	if code := getStatus(w.routes(), "/debug/pprof/goroutine?debug=1"); code != http.StatusNotFound {
+		t.Errorf("pprof must never be on the public listener, got %d", code)
+	}
+}
+
+func TestAdminTokensListing(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	w := newTestWrapper(backend.URL)
+	now := time.Now()
+	w.accessTokens.Set("dormant", &AccessToken{ClientID: "a", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour)})
+	w.accessTokens.Set("active", &AccessToken{ClientID: "b", CreatedAt: now.Add(-3 * time.Hour), ExpiresAt: now.Add(time.Hour)})
+
+	// Using a token on /sse records LastUsedAt and counts the use
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer active")
+	active, _ := w.accessTokens.Get("active")
+	usesBefore := tokenUsesTotal.value.Load()
+	w.handleSSEProxy(httptest.NewRecorder(), req)
+	w.handleSSEProxy(httptest.NewRecorder(), req)
+	if active.LastUsedAt().IsZero() {
+		t.Fatal("expected /sse to record LastUsedAt")
+	}
+	if active.UseCount() != 2 || tokenUsesTotal.value.Load()-usesBefore != 2 {
+		t.Errorf("expected two counted uses, got %d", active.UseCount())
+	}
+
+	if code := getStatus(w.routes(), "/admin/tokens"); code != http.StatusNotFound {
+		t.Errorf("admin APIs should not exist without an admin token, got %d", code)
+	}
+
+	w.secrets.Store(&secrets{AdminToken: "admin"})
+	if code := getStatus(w.routes(), "/admin/tokens"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/tokens", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var body struct {
+		Tokens []AdminTokenInfo `json:"tokens"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Tokens) != 2 || body.Tokens[0].ClientID != "b" || body.Tokens[0].LastUsedAt == nil || body.Tokens[1].LastUsedAt != nil ||
+		body.Tokens[0].UseCount != 2 || body.Tokens[1].UseCount != 0 {
+		t.Errorf("expected the active token first with last_used_at and use_count set, got %+v", body.Tokens)
+	}
+	if strings.Contains(rec.Body.String(), "active") || strings.Contains(rec.Body.String(), "dormant") {
+		t.Error("listing must not reveal token values")
+	}
+}
+
+func TestAdminClientSessions(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.secrets.Store(&secrets{AdminToken: "admin"})
+	now := time.Now()
+	w.clients["client"] = &ClientRegistrationResponse{
+		ClientID:         "client",
+		ClientSecret:     "very-secret",
+		ClientName:       "Claude",
+		RedirectURIs:     []string{"https://claude.ai/api/mcp/auth_callback"},
+		GrantTypes:       supportedGrantTypes,
+		ResponseTypes:    supportedResponseTypes,
+		ClientIDIssuedAt: now.Unix(),
+	}
+	w.authCodes["code-for-client"] = &AuthCode{ClientID: "client", RedirectURI: "https://claude.ai/api/mcp/auth_callback", CodeChallenge: "x", ExpiresAt: now.Add(time.Minute)}
+	w.authCodes["code-for-other"] = &AuthCode{ClientID: "other", ExpiresAt: now.Add(time.Minute)}
+	w.accessTokens.Set("token-for-client", &AccessToken{ClientID: "client", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	w.accessTokens.Set("token-for-other", &AccessToken{ClientID: "other", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		w.routes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/admin/clients/client/sessions", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", rec.Code)
+	}
+	if rec := get("/admin/clients/missing/sessions", "admin"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown client, got %d", rec.Code)
+	}
+
+	rec := get("/admin/clients/client/sessions", "admin")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	raw := rec.Body.String()
+	for _, secret := range []string{"very-secret", "code-for-client", "token-for-client"} {
+		if strings.Contains(raw, secret) {
+			t.Errorf("session view must not reveal %q", secret)
+		}
+	}
+
+	var sessions AdminClientSessions
+	if err := json.Unmarshal([]byte(raw), &sessions); err != nil {
+		t.Fatal(err)
+	}
+	if sessions.Client.ClientName != "Claude" || sessions.Client.Public {
+		t.Errorf("unexpected client %+v", sessions.Client)
+	}
+	if len(sessions.AuthCodes) != 1 || sessions.AuthCodes[0].ID != tokenID("code-for-client") || !sessions.AuthCodes[0].PKCE {
+		t.Errorf("expected only the client's code, got %+v", sessions.AuthCodes)
+	}
+	if len(sessions.Tokens) != 1 || sessions.Tokens[0].ID != tokenID("token-for-client") {
+		t.Errorf("expected only the client's token, got %+v", sessions.Tokens)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mcpSessionIDHeader identifies a Streamable HTTP session; the backend that issued it holds its state
+const mcpSessionIDHeader = "Mcp-Session-Id"
+
+// sessionAffinity pins each MCP session to the backend that created it, so follow-up requests
+// reach the replica holding the session. Entries are dropped when the session ends or goes idle.
+type sessionAffinity struct {
+	mu       sync.Mutex
+	sessions map[string]*affinityEntry
+	idleTTL  time.Duration
+}
+
+type affinityEntry struct {
+	backend  *mcpBackend
+	lastSeen time.Time
+}
+
+func newSessionAffinity(idleTTL time.Duration) *sessionAffinity {
+	return &sessionAffinity{sessions: make(map[string]*affinityEntry), idleTTL: idleTTL}
+}
+
+// lookup returns the backend pinned to a session and marks the session as active
+func (a *sessionAffinity) lookup(sessionID string, now time.Time) (*mcpBackend, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.sessions[sessionID]
+	if !ok {
+		return nil, false
+	}
+	if now.Sub(entry.lastSeen) > a.idleTTL {
+		delete(a.sessions, sessionID)
+		return nil, false
+	}
+	entry.lastSeen = now
+	return entry.backend, true
+}
+
+// bind pins a session to a backend. Adding a session sweeps idle ones so abandoned sessions don't pile up.
+func (a *sessionAffinity) bind(sessionID string, backend *mcpBackend, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if entry, ok := a.sessions[sessionID]; ok {
+		entry.backend, entry.lastSeen = backend, now
+		return
+	}
+	for id, entry := range a.sessions {
+		if now.Sub(entry.lastSeen) > a.idleTTL {
+			delete(a.sessions, id)
+		}
+	}
+	a.sessions[sessionID] = &affinityEntry{backend: backend, lastSeen: now}
+}
+
+func (a *sessionAffinity) evict(sessionID string) {
+	a.mu.Lock()
+	delete(a.sessions, sessionID)
+	a.mu.Unlock()
+}
+
+func (a *sessionAffinity) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.sessions)
+}
+
+// sseSessionParam carries the HTTP+SSE session on message POSTs, as named by the endpoint event
+const sseSessionParam = "sessionId"
+
+// maxEndpointEventBytes is how far into an /sse stream the endpoint event is looked for
+const maxEndpointEventBytes = 4096
+
+// backendFor picks the backend for a proxied request: the one pinned to its session, if any
+func (w *OAuthWrapper) backendFor(req *http.Request) *mcpBackend {
+	sessionID := req.Header.Get(mcpSessionIDHeader)
+	if sessionID == "" && req.URL.Path == messageEndpoint {
+		sessionID = req.URL.Query().Get(sseSessionParam)
+	}
+	if sessionID != "" {
+		if backend, ok := w.affinity.lookup(sessionID, w.now()); ok {
+			return backend
+		}
+	}
+	return w.chooseBackend()
+}
+
+// trackSSESession pins an HTTP+SSE session to the backend serving its /sse stream, so the message
+// POSTs naming it reach the same replica. The session ID is only in the stream's endpoint event.
+func (w *OAuthWrapper) trackSSESession(resp *http.Response) {
+	if resp.Request.URL.Path != sseEndpoint || resp.StatusCode != http.StatusOK || !isEventStream(resp.Header.Get("Content-Type")) {
+		return
+	}
+	backend := w.backendServing(resp.Request)
+	if backend == nil {
+		return
+	}
+	resp.Body = &endpointEventBody{ReadCloser: resp.Body, bind: func(sessionID string) {
+		w.affinity.bind(sessionID, backend, w.now())
+	}}
+}
+
+// endpointEventBody passes an event stream through unchanged while watching its start for the
+// endpoint event, calling bind with the session ID from its URL
+type endpointEventBody struct {
+	io.ReadCloser
+	bind func(sessionID string)
+	seen []byte
+	done bool
+}
+
+func (b *endpointEventBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done || n == 0 {
+		return n, err
+	}
+	b.seen = append(b.seen, p[:n]...)
+	if sessionID, ok := endpointSessionID(b.seen); ok {
+		b.bind(sessionID)
+		b.done = true
+	}
+	if b.done || len(b.seen) > maxEndpointEventBytes {
+		b.done, b.seen = true, nil
+	}
+	return n, err
+}
+
+// endpointSessionID finds the first complete endpoint event in the start of a stream and returns
+// the session ID from the URL in its data
+func endpointSessionID(stream []byte) (string, bool) {
+	events := strings.Split(strings.ReplaceAll(string(stream), "\r\n", "\n"), "\n\n")
+	// The last piece may be an event still arriving
+	for _, event := range events[:len(events)-1] {
+		var name, data string
+		for _, line := range strings.Split(event, "\n") {
+			if v, ok := strings.CutPrefix(line, "event:"); ok {
+				name = strings.TrimSpace(v)
+			} else if v, ok := strings.CutPrefix(line, "data:"); ok {
+				data = strings.TrimSpace(v)
+			}
+		}
+		if name != "endpoint" {
+			continue
+		}
+		u, err := url.Parse(data)
+		if err != nil {
+			return "", false
+		}
+		sessionID := u.Query().Get(sseSessionParam)
+		return sessionID, sessionID != ""
+	}
+	return "", false
+}
+
+// trackSession updates the affinity table from a backend response: a new session ID pins the
+// session to the backend that issued it, and a terminated or unknown session is forgotten
+func (w *OAuthWrapper) trackSession(resp *http.Response) {
+	requested := resp.Request.Header.Get(mcpSessionIDHeader)
+	if requested != "" && (resp.StatusCode == http.StatusNotFound ||
+		(resp.Request.Method == http.MethodDelete && resp.StatusCode < http.StatusMultipleChoices)) {
+		w.affinity.evict(requested)
+		return
+	}
+
+	issued := resp.Header.Get(mcpSessionIDHeader)
+	if issued == "" || resp.StatusCode >= http.StatusMultipleChoices {
+		return
+	}
+	if backend := w.backendServing(resp.Request); backend != nil {
+		w.affinity.bind(issued, backend, w.now())
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionBackend answers with its name and issues a session ID to requests that don't carry one
+func sessionBackend(t *testing.T, name string) *mcpBackend {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(mcpSessionIDHeader) == "" {
+			rw.Header().Set(mcpSessionIDHeader, name+"-session")
+		}
+		io.WriteString(rw, name)
+	}))
+	t.Cleanup(server.Close)
+	backend, err := newMCPBackend(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestSessionAffinity(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.affinity = newSessionAffinity(time.Minute)
+	w.lbStrategy = lbLeastConnections // with nothing in flight, always the first backend
+	proxy, err := w.reverseProxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := sessionBackend(t, "a"), sessionBackend(t, "b")
+
+	send := func(method, sessionID string) string {
+		req := httptest.NewRequest(method, "/mcp", nil)
+		if sessionID != "" {
+			req.Header.Set(mcpSessionIDHeader, sessionID)
+		}
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	// A new session lands on the chosen backend and is pinned there
+	w.backends = []*mcpBackend{a, b}
+	if got := send(http.MethodPost, ""); got != "a" {
+		t.Fatalf("expected the new session on a, got %q", got)
+	}
+
+	// Even once another backend would be chosen, the session keeps hitting a
+	w.backends = []*mcpBackend{b, a}
+	if got := send(http.MethodPost, "a-session"); got != "a" {
+		t.Errorf("expected the pinned session on a, got %q", got)
+	}
+	if got := send(http.MethodPost, "unknown"); got != "b" {
+		t.Errorf("expected an unknown session on the chosen backend, got %q", got)
+	}
+
+	// Ending the session drops the pin
+	send(http.MethodDelete, "a-session")
+	if _, ok := w.affinity.lookup("a-session", time.Now()); ok {
+		t.Error("expected the session to be evicted after DELETE")
+	}
+}
+
+func TestSessionAffinityIdleEviction(t *testing.T) {
+	affinity := newSessionAffinity(time.Minute)
+	backend := &mcpBackend{}
+	now := time.Now()
+
+	affinity.bind("s1", backend, now)
+	if got, ok := affinity.lookup("s1", now.Add(30*time.Second)); !ok || got != backend {
+		t.Fatal("expected the session to be pinned")
+	}
+	// The lookup refreshed the session, so it survives a minute after it
+	if _, ok := affinity.lookup("s1", now.Add(80*time.Second)); !ok {
+		t.Error("expected activity to keep the session pinned")
+	}
+	if _, ok := affinity.lookup("s1", now.Add(3*time.Minute)); ok {
+		t.Error("expected the idle session to be evicted")
+	}
+
+	affinity.bind("s2", backend, now)
+	affinity.bind("s3", backend, now.Add(2*time.Minute))
+	if affinity.Len() != 1 {
+		t.Errorf("expected binding to sweep idle sessions, have %d", affinity.Len())
+	}
+}
+
+func TestTrackSessionForgetsUnknownSessions(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.affinity = newSessionAffinity(time.Minute)
+	w.affinity.bind("gone", &mcpBackend{}, time.Now())
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set(mcpSessionIDHeader, "gone")
+	w.trackSession(&http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Request: req})
+
+	if w.affinity.Len() != 0 {
+		t.Error("expected a session the backend no longer knows to be evicted")
+	}
+}
+
+func TestSSESessionAffinity(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.affinity = newSessionAffinity(time.Minute)
+	w.lbStrategy = lbLeastConnections
+	proxy, err := w.reverseProxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sseBackend := func(name string) *mcpBackend {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/sse" {
+				rw.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(rw, ": hello\r\n\r\nevent: endpoint\r\ndata: /message?sessionId="+name+"-sse\r\n\r\n")
+				return
+			}
+			io.WriteString(rw, name)
+		}))
+		t.Cleanup(server.Close)
+		backend, err := newMCPBackend(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return backend
+	}
+	a, b := sseBackend("a"), sseBackend("b")
+
+	send := func(method, target string) string {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec.Body.String()
+	}
+
+	w.backends = []*mcpBackend{a, b}
+	if stream := send(http.MethodGet, "/sse"); !strings.Contains(stream, "a-sse") {
+		t.Fatalf("expected the stream from a to pass through unchanged, got %q", stream)
+	}
+
+	w.backends = []*mcpBackend{b, a}
+	if got := send(http.MethodPost, "/message?sessionId=a-sse"); got != "a" {
+		t.Errorf("expected messages for the stream's session on a, got %q", got)
+	}
+	if got := send(http.MethodPost, "/message?sessionId=unknown"); got != "b" {
+		t.Errorf("expected an unknown session on the chosen backend, got %q", got)
+	}
+}
+
+func TestEndpointSessionID(t *testing.T) {
+	tests := []struct {
+		stream string
+		want   string
+	}{
+		{"event: endpoint\ndata: /message?sessionId=abc\n\n", "abc"},
+		{"event: endpoint\ndata: https://mcp.example.com/message?sessionId=abc&x=1\n\n", "abc"},
+		{"event: message\ndata: {}\n\nevent: endpoint\ndata: /message?sessionId=def\n\n", "def"},
+		// Not complete yet
+		{"event: endpoint\ndata: /message?sessionId=abc", ""},
+		{"event: endpoint\ndata: /message\n\n", ""},
+		{"data: /message?sessionId=abc\n\n", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := endpointSessionID([]byte(tt.stream)); got != tt.want {
+			t.Errorf("endpointSessionID(%q) = %q, want %q", tt.stream, got, tt.want)
+		}
+	}
+}
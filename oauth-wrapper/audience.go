@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A token's audience is everything it may be presented to. It starts as the configured token
+// audiences, and resource indicators (RFC 8707) narrow it to the resources or audiences they name.
+// Tokens are opaque, so the audience is stored server-side with the token.
+
+// grantAudience is the audience an authorization code grants: the requested resource indicators when
+// the client named any, every configured token audience otherwise. Requested values must be configured
+// resources or audiences; without either configured, resource indicators are ignored.
+func (w *OAuthWrapper) grantAudience(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return slices.Clone(w.tokenAudience), nil
+	}
+	if len(w.resources) == 0 && len(w.tokenAudience) == 0 {
+		return nil, nil
+	}
+
+	audience := make([]string, 0, len(requested))
+	for _, resource := range requested {
+		resource = normalizeResource(resource)
+		if !slices.Contains(w.resources, resource) && !slices.Contains(w.tokenAudience, resource) {
+			return nil, fmt.Errorf("resource %q is not served by this authorization server", resource)
+		}
+		audience = append(audience, resource)
+	}
+	return audience, nil
+}
+
+// narrowAudience checks that a token request only asks for resources granted to the code
+func narrowAudience(granted, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return granted, nil
+	}
+
+	audience := make([]string, 0, len(requested))
+	for _, resource := range requested {
+		resource = normalizeResource(resource)
+		if !slices.Contains(granted, resource) {
+			return nil, fmt.Errorf("resource %q was not granted to the authorization code", resource)
+		}
+		audience = append(audience, resource)
+	}
+	return audience, nil
+}
+
+// audienceAllows reports whether a token with the given audience may access the resource: the
+// audience must name the wrapper's own audience (the first configured one), the resource, or a URI
+// the resource is below. Tokens without an audience are valid everywhere unless audiences are configured.
+func (w *OAuthWrapper) audienceAllows(audience []string, resource string) bool {
+	if len(audience) == 0 {
+		return len(w.tokenAudience) == 0
+	}
+	resource = normalizeResource(resource)
+	for _, aud := range audience {
+		if (len(w.tokenAudience) > 0 && aud == w.tokenAudience[0]) || resource == aud || strings.HasPrefix(resource, aud+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTokenAudience(t *testing.T) {
+	const proxyAud, downstreamAud, resource = "https://mcp.example.com", "https://slack-mcp.internal", "https://mcp.example.com/sse"
+	issue := func(w *OAuthWrapper, authorizeResources, tokenResources []string) (*AccessToken, error) {
+		t.Helper()
+		redirect, err := w.authorize(authorizeRequest{ClientID: "client", RedirectURI: testRedirectURI, ResponseType: "code", Resources: authorizeResources})
+		if err != nil {
+			t.Fatalf("authorize: %v", err)
+		}
+		resp, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: redirect.Query().Get("code"), ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI, Resources: tokenResources})
+		if err != nil {
+			return nil, err
+		}
+		at, _ := w.accessTokens.Get(resp.AccessToken)
+		return at, nil
+	}
+
+	tests := []struct {
+		name               string
+		authorizeResources []string
+		tokenResources     []string
+		wantAudience       []string
+	}{
+		{"every audience by default", nil, nil, []string{proxyAud, downstreamAud}},
+		{"narrowed at authorization", []string{downstreamAud + "/"}, nil, []string{downstreamAud}},
+		{"narrowed at the token endpoint", nil, []string{proxyAud}, []string{proxyAud}},
+		{"narrowed to a resource", []string{resource, downstreamAud}, []string{resource}, []string{resource}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newOAuthTestWrapper(time.Now())
+			w.resources = []string{resource}
+			w.tokenAudience = []string{proxyAud, downstreamAud}
+			at, err := issue(w, tt.authorizeResources, tt.tokenResources)
+			if err != nil {
+				t.Fatalf("exchangeCode: %v", err)
+			}
+			if !slices.Equal(at.Audience, tt.wantAudience) {
+				t.Errorf("expected audience %v, got %v", tt.wantAudience, at.Audience)
+			}
+		})
+	}
+
+	// A token can't widen the audience its code was granted
+	w := newOAuthTestWrapper(time.Now())
+	w.tokenAudience = []string{proxyAud, downstreamAud}
+	_, err := issue(w, []string{downstreamAud}, []string{proxyAud})
+	wantOAuthError(t, err, http.StatusBadRequest, "invalid_target")
+
+	// Without configured audiences tokens carry none
+	w = newOAuthTestWrapper(time.Now())
+	if at, err := issue(w, nil, nil); err != nil || at.Audience != nil {
+		t.Errorf("expected no audience without configured audiences, got %v (%v)", at.Audience, err)
+	}
+}
+
+func TestGrantAudience(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+
+	// Without configured resources or audiences resource indicators are ignored
+	if got, err := w.grantAudience([]string{"https://other.example"}); err != nil || got != nil {
+		t.Fatalf("expected resources to be ignored, got %v %v", got, err)
+	}
+
+	w.resources = []string{"https://mcp.example/sse"}
+	w.tokenAudience = []string{"https://mcp.example"}
+	if got, err := w.grantAudience(nil); err != nil || !slices.Equal(got, w.tokenAudience) {
+		t.Errorf("expected the configured audiences by default, got %v %v", got, err)
+	}
+	if got, err := w.grantAudience([]string{"https://mcp.example/sse/"}); err != nil || !slices.Equal(got, []string{"https://mcp.example/sse"}) {
+		t.Errorf("expected an allowlisted resource to narrow the audience, got %v %v", got, err)
+	}
+	if _, err := w.grantAudience([]string{"https://other.example"}); err == nil {
+		t.Error("expected a resource that is neither configured nor an audience to be rejected")
+	}
+}
+
+func TestAuthorizeInvalidTargetRedirects(t *testing.T) {
+	w := newOAuthTestWrapper(time.Now())
+	w.resources = []string{"https://mcp.example/sse"}
+
+	_, err := w.authorize(authorizeRequest{ClientID: "client", RedirectURI: testRedirectURI, ResponseType: "code", State: "xyz", Resources: []string{"https://other.example"}})
+	wantOAuthError(t, err, http.StatusBadRequest, "invalid_target")
+	var rerr *redirectError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected invalid_target on the redirect URI, got %v", err)
+	}
+	if q := rerr.Redirect.Query(); q.Get("error") != "invalid_target" || q.Get("state") != "xyz" {
+		t.Errorf("expected the error and state on the redirect, got %s", rerr.Redirect)
+	}
+	if len(w.authCodes) != 0 {
+		t.Error("no code should be stored for a rejected request")
+	}
+}
+
+func TestNarrowAudience(t *testing.T) {
+	granted := []string{"https://a.example", "https://b.example"}
+
+	if got, _ := narrowAudience(granted, nil); len(got) != 2 {
+		t.Errorf("expected the whole granted audience without narrowing, got %v", got)
+	}
+	if got, err := narrowAudience(granted, []string{"https://b.example"}); err != nil || len(got) != 1 {
+		t.Errorf("expected narrowing to succeed, got %v %v", got, err)
+	}
+	if _, err := narrowAudience(granted, []string{"https://c.example"}); err == nil {
+		t.Error("expected broadening to fail")
+	}
+}
+
+func TestAudienceAllows(t *testing.T) {
+	tests := []struct {
+		tokenAudience []string
+		audience      []string
+		resource      string
+		want          bool
+	}{
+		{nil, nil, "https://mcp.example/sse", true},
+		{nil, []string{"https://mcp.example"}, "https://mcp.example/sse", true},
+		{nil, []string{"https://mcp.example/sse"}, "https://mcp.example/sse", true},
+		{nil, []string{"https://mcp.example/mcp"}, "https://mcp.example/sse", false},
+		{nil, []string{"https://mcp.example"}, "https://mcp.example.evil/sse", false},
+		{[]string{"https://proxy.example", "https://slack-mcp.internal"}, []string{"https://proxy.example"}, "https://mcp.example/sse", true},
+		{[]string{"https://proxy.example", "https://slack-mcp.internal"}, []string{"https://slack-mcp.internal"}, "https://mcp.example/sse", false},
+		{[]string{"https://proxy.example"}, []string{"https://mcp.example/sse"}, "https://mcp.example/sse", true},
+		{[]string{"https://proxy.example"}, nil, "https://mcp.example/sse", false},
+	}
+	w := newTestWrapper("http://127.0.0.1:13080")
+	for _, tt := range tests {
+		w.tokenAudience = tt.tokenAudience
+		if got := w.audienceAllows(tt.audience, tt.resource); got != tt.want {
+			t.Errorf("audienceAllows(%v, %q) with audiences %v = %v, want %v", tt.audience, tt.resource, tt.tokenAudience, got, tt.want)
+		}
+	}
+}
+
+func TestProxyRequiresAudience(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.tokenAudience = []string{"https://mcp.example.com", "https://slack-mcp.internal"}
+	w.accessTokens.Set("downstream", &AccessToken{ClientID: "client", Audience: []string{"https://slack-mcp.internal"}, ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer downstream")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+
+	if rec.Code != http.StatusUnauthorized || decodeJSONError(t, rec)["error"] != "invalid_token" {
+		t.Errorf("expected a token without the proxy's audience to be rejected, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("expected a Bearer challenge")
+	}
+}
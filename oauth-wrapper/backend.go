@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// backendWaitMaxInterval caps the backoff between health checks while waiting for the MCP server
+const backendWaitMaxInterval = 5 * time.Second
+
+// waitForBackend polls the MCP server's health until it passes or the startup timeout elapses,
+// then marks the wrapper ready. A zero timeout skips the wait. Polls back off exponentially from
+// the wait interval, with jitter, so a slow cold start isn't hammered.
+func (w *OAuthWrapper) waitForBackend(ctx context.Context) {
+	defer w.started.Store(true)
+	if w.backendWaitTimeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.backendWaitTimeout)
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		err := w.checkMCPHealth(ctx)
+		if err == nil {
+			slog.Info("MCP server is up", "attempts", attempt)
+			return
+		}
+		delay := jitteredBackoff(w.backendWaitInterval, backendWaitMaxInterval, attempt)
+		// Report the first attempts, then ever more rarely (at 4, 8, 16, ...); the rest are debug noise
+		level := slog.LevelDebug
+		if attempt&(attempt-1) == 0 {
+			level = slog.LevelInfo
+		}
+		slog.Log(ctx, level, "Waiting for MCP server", "attempt", attempt, "retry_in", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			slog.Warn("MCP server not up after startup timeout; serving anyway", "timeout", w.backendWaitTimeout, "attempts", attempt, "error", err)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// awaitBackend holds an SSE request until an MCP backend is ready, polling its health for at most
+// the SSE ready wait. It reports false if the wait runs out or the client disconnects first.
+// Without a ready wait requests are never held. Held requests share probes and back off like the
+// startup wait.
+func (w *OAuthWrapper) awaitBackend(ctx context.Context) bool {
+	if w.sseReadyWait <= 0 || w.backendReady() {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.sseReadyWait)
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		if w.probeMCPHealth(ctx) == nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(jitteredBackoff(w.backendWaitInterval, backendWaitMaxInterval, attempt)):
+		}
+	}
+}
+
+// jitteredBackoff is the delay after the given attempt (from 1): base doubled per attempt up to
+// ceiling, then randomized to between half and all of that, so waiting callers don't poll in lockstep
+func jitteredBackoff(base, ceiling time.Duration, attempt int) time.Duration {
+	delay := ceiling
+	if shift := attempt - 1; shift < 32 && base<<shift > 0 && base<<shift < ceiling {
+		delay = base << shift
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// backendReady reports whether the startup wait is over and some backend is in rotation
+func (w *OAuthWrapper) backendReady() bool {
+	if _, err := w.reverseProxy(); err != nil || !w.started.Load() {
+		return false
+	}
+	for _, backend := range w.backends {
+		if backend.healthy.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// Strategies for spreading new sessions across MCP backends
+const (
+	lbRoundRobin       = "round-robin"
+	lbLeastConnections = "least-connections"
+)
+
+var supportedLBStrategies = []string{lbRoundRobin, lbLeastConnections}
+
+// mcpBackend is one MCP server the proxy can route to
+type mcpBackend struct {
+	url *url.URL
+	// director rewrites an outgoing request to target this backend
+	director func(*http.Request)
+	// healthy is cleared while the backend fails its health check, taking it out of rotation
+	healthy atomic.Bool
+	// inFlight counts requests and open streams currently proxied to the backend
+	inFlight atomic.Int64
+}
+
+func newMCPBackend(rawURL string) (*mcpBackend, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	backend := &mcpBackend{url: target, director: httputil.NewSingleHostReverseProxy(target).Director}
+	backend.healthy.Store(true)
+	backendUp.Set(backend.label(), 1)
+	backendInFlight.Set(backend.label(), 0)
+	return backend, nil
+}
+
+// label identifies the backend in metrics and logs
+func (b *mcpBackend) label() string {
+	return b.url.Redacted()
+}
+
+func (b *mcpBackend) setHealthy(healthy bool) {
+	b.healthy.Store(healthy)
+	if healthy {
+		backendUp.Set(b.label(), 1)
+	} else {
+		backendUp.Set(b.label(), 0)
+	}
+}
+
+func (b *mcpBackend) addInFlight(delta int64) {
+	backendInFlight.Set(b.label(), b.inFlight.Add(delta))
+}
+
+// backendURLs lists the configured MCP servers, falling back to the single MCP URL
+func (w *OAuthWrapper) backendURLs() []string {
+	if len(w.mcpBackendURLs) > 0 {
+		return w.mcpBackendURLs
+	}
+	return []string{w.mcpURL}
+}
+
+// chooseBackend picks the backend for a request that isn't pinned to one by its session.
+// Unhealthy backends are skipped unless none are healthy, in which case any may recover first.
+func (w *OAuthWrapper) chooseBackend() *mcpBackend {
+	candidates := make([]*mcpBackend, 0, len(w.backends))
+	for _, backend := range w.backends {
+		if backend.healthy.Load() {
+			candidates = append(candidates, backend)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = w.backends
+	}
+
+	if w.lbStrategy == lbLeastConnections {
+		least := candidates[0]
+		for _, backend := range candidates[1:] {
+			if backend.inFlight.Load() < least.inFlight.Load() {
+				least = backend
+			}
+		}
+		return least
+	}
+	return candidates[(w.nextBackend.Add(1)-1)%uint64(len(candidates))]
+}
+
+// monitorBackends health checks every backend each interval, taking failing ones out of rotation
+// until they pass again
+func (w *OAuthWrapper) monitorBackends(ctx context.Context) {
+	if _, err := w.reverseProxy(); err != nil {
+		return
+	}
+	ticker := time.NewTicker(w.backendHealthInterval)
+	defer ticker.Stop()
+	for {
+		for _, backend := range w.backends {
+			err := w.checkBackendHealth(ctx, strings.TrimSuffix(backend.url.String(), "/"))
+			switch wasHealthy := backend.healthy.Load(); {
+			case err != nil && wasHealthy:
+				slog.Warn("MCP backend failed its health check, removing it from rotation", "backend", backend.label(), "error", err)
+			case err == nil && !wasHealthy:
+				slog.Info("MCP backend is healthy again, returning it to rotation", "backend", backend.label())
+			}
+			backend.setHealthy(err == nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// inFlightTransport counts proxied requests per backend until their response body is closed
+type inFlightTransport struct {
+	next    http.RoundTripper
+	wrapper *OAuthWrapper
+}
+
+func (t *inFlightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backend := t.wrapper.backendServing(req)
+	if backend == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	backend.addInFlight(1)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		backend.addInFlight(-1)
+		return nil, err
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body, done: sync.OnceFunc(func() { backend.addInFlight(-1) })}
+	return resp, nil
+}
+
+type inFlightBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *inFlightBody) Close() error {
+	defer b.done()
+	return b.ReadCloser.Close()
+}
+
+// backendServing maps an outgoing request back to the backend it was sent to
+func (w *OAuthWrapper) backendServing(req *http.Request) *mcpBackend {
+	for _, backend := range w.backends {
+		if backend.url.Scheme == req.URL.Scheme && backend.url.Host == req.URL.Host {
+			return backend
+		}
+	}
+	return nil
+}
+
+// retryTransport retries requests to the MCP server that fail with connection refused,
+// which is what a backend that is still starting looks like. Messages (requests with a body) have
+// their own, more conservative, retries.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+
+	messageRetries int
+	messageBackoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		return t.roundTripMessage(req)
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err == nil || attempt >= t.retries || !errors.Is(err, syscall.ECONNREFUSED) {
+			return resp, err
+		}
+
+		delay := t.backoff << attempt
+		slog.DebugContext(req.Context(), "MCP server refused connection, retrying", "attempt", attempt+1, "delay", delay)
+		select {
+		case <-req.Context().Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// roundTripMessage retries a message only while it can't have been delivered: the connection to the
+// MCP server could not be made, and none of the streamed body was read. Anything later may have
+// reached the backend, and JSON-RPC calls aren't safe to repeat.
+func (t *retryTransport) roundTripMessage(req *http.Request) (*http.Response, error) {
+	if t.messageRetries <= 0 {
+		return t.next.RoundTrip(req)
+	}
+	body := &unsentBody{ReadCloser: req.Body}
+	req = req.Clone(req.Context())
+	req.Body = body
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		var opErr *net.OpError
+		if err == nil || attempt >= t.messageRetries || body.read.Load() || !errors.As(err, &opErr) || opErr.Op != "dial" {
+			return resp, err
+		}
+
+		delay := t.messageBackoff << attempt
+		slog.InfoContext(req.Context(), "MCP server unreachable, retrying message", "attempt", attempt+1, "delay", delay, "error", err)
+		select {
+		case <-req.Context().Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// unsentBody lets a failed attempt be retried with the same streamed body: it records whether any
+// of it was read, and leaves closing it to the server, which closes every request body it reads
+type unsentBody struct {
+	io.ReadCloser
+	read atomic.Bool
+}
+
+func (b *unsentBody) Read(p []byte) (int, error) {
+	b.read.Store(true)
+	return b.ReadCloser.Read(p)
+}
+
+func (b *unsentBody) Close() error { return nil }
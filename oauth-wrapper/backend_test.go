@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWaitForBackendMarksReady(t *testing.T) {
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+
+	w := newTestWrapper(backend.URL)
+	w.started.Store(false)
+	w.backendWaitTimeout = 5 * time.Second
+	w.backendWaitInterval = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		w.waitForBackend(context.Background())
+		close(done)
+	}()
+
+	if code := getStatus(w.routes(), "/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while starting, got %d", code)
+	}
+
+	healthy.Store(true)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitForBackend did not return once the backend was healthy")
+	}
+	if code := getStatus(w.routes(), "/ready"); code != http.StatusOK {
+		t.Errorf("expected 200 after startup, got %d", code)
+	}
+}
+
+func TestWaitForBackendGivesUp(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:1")
+	w.started.Store(false)
+	w.backendWaitTimeout = 50 * time.Millisecond
+	w.backendWaitInterval = 10 * time.Millisecond
+
+	w.waitForBackend(context.Background())
+	if !w.started.Load() {
+		t.Error("expected the wrapper to be marked started after the timeout")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryTransport(t *testing.T) {
+	refused := fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED)
+
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		method    string
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds after refusals", 2, refused, http.MethodGet, 3, false},
+		{"gives up after retries", 5, refused, http.MethodGet, 3, true},
+		{"other errors are not retried", 5, errors.New("boom"), http.MethodGet, 1, true},
+		{"requests with a body only get message retries", 5, refused, http.MethodPost, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			rt := &retryTransport{
+				retries: 2,
+				backoff: time.Millisecond,
+				next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					calls++
+					if calls <= tt.failures {
+						return nil, tt.err
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+			}
+
+			req := httptest.NewRequest(tt.method, "http://backend/sse", nil)
+			if tt.method == http.MethodPost {
+				req = httptest.NewRequest(tt.method, "http://backend/message", strings.NewReader("{}"))
+			}
+			_, err := rt.RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryTransportMessages(t *testing.T) {
+	dialFailed := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		readFirst bool
+		wantCalls int
+		wantErr   bool
+	}{
+		{"retried while the backend can't be reached", 1, dialFailed, false, 2, false},
+		{"gives up after message retries", 5, dialFailed, false, 3, true},
+		{"not retried once the connection was made", 5, reset, false, 1, true},
+		{"not retried once the body was read", 5, dialFailed, true, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			calls := 0
+			var delivered string
+			rt := &retryTransport{
+				messageRetries: 2,
+				messageBackoff: time.Millisecond,
+				next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					calls++
+					if calls <= tt.failures {
+						if tt.readFirst {
+							r.Body.Read(make([]byte, 1))
+						}
+						r.Body.Close()
+						return nil, tt.err
+					}
+					body, _ := io.ReadAll(r.Body)
+					delivered = string(body)
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "http://backend/message", strings.NewReader(`{"jsonrpc":"2.0"}`))
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, "req-123"))
+			_, err := rt.RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if !tt.wantErr && delivered != `{"jsonrpc":"2.0"}` {
+				t.Errorf("expected the whole message delivered on retry, got %q", delivered)
+			}
+			if retried := strings.Count(logs.String(), "retrying message"); retried != tt.wantCalls-1 || (retried > 0 && !strings.Contains(logs.String(), "req-123")) {
+				t.Errorf("expected each retry logged with the request ID, got %s", logs)
+			}
+		})
+	}
+}
+
+func TestChooseBackend(t *testing.T) {
+	a, _ := newMCPBackend("http://a.internal:13080")
+	b, _ := newMCPBackend("http://b.internal:13080")
+	c, _ := newMCPBackend("http://c.internal:13080")
+
+	t.Run("round robin skips unhealthy backends", func(t *testing.T) {
+		w := newTestWrapper("http://127.0.0.1:13080")
+		w.backends = []*mcpBackend{a, b, c}
+		b.setHealthy(false)
+		defer b.setHealthy(true)
+
+		var got []string
+		for i := 0; i < 4; i++ {
+			got = append(got, w.chooseBackend().url.Host)
+		}
+		want := []string{"a.internal:13080", "c.internal:13080", "a.internal:13080", "c.internal:13080"}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("all unhealthy falls back to every backend", func(t *testing.T) {
+		w := newTestWrapper("http://127.0.0.1:13080")
+		w.backends = []*mcpBackend{a, b}
+		a.setHealthy(false)
+		b.setHealthy(false)
+		defer a.setHealthy(true)
+		defer b.setHealthy(true)
+
+		if got := w.chooseBackend(); got != a {
+			t.Errorf("expected a backend anyway, got %v", got.url)
+		}
+	})
+
+	t.Run("least connections", func(t *testing.T) {
+		w := newTestWrapper("http://127.0.0.1:13080")
+		w.lbStrategy = lbLeastConnections
+		w.backends = []*mcpBackend{a, b, c}
+		a.addInFlight(2)
+		b.addInFlight(1)
+		c.addInFlight(3)
+		defer a.addInFlight(-2)
+		defer b.addInFlight(-1)
+		defer c.addInFlight(-3)
+
+		if got := w.chooseBackend(); got != b {
+			t.Errorf("expected the least loaded backend, got %v", got.url)
+		}
+	})
+}
+
+func TestMonitorBackends(t *testing.T) {
+	var healthy atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(flaky.Close)
+	steady := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(steady.Close)
+
+	w := newTestWrapper(flaky.URL)
+	w.mcpBackendURLs = []string{flaky.URL, steady.URL}
+	w.backendHealthInterval = 10 * time.Millisecond
+	if _, err := w.reverseProxy(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go w.monitorBackends(ctx)
+
+	waitFor := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if w.backends[0].healthy.Load() == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("flaky backend never became healthy=%v", want)
+	}
+
+	waitFor(false)
+	if !strings.Contains(metricsOutput(), `oauth_wrapper_backend_up{backend="`+flaky.URL+`"} 0`) {
+		t.Error("expected the unhealthy backend to be reported down")
+	}
+	healthy.Store(true)
+	waitFor(true)
+}
+
+func metricsOutput() string {
+	rec := httptest.NewRecorder()
+	defaultRegistry.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestAwaitBackend(t *testing.T) {
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	w := newTestWrapper(backend.URL)
+	w.sseReadyWait = 5 * time.Second
+	w.backendWaitInterval = 10 * time.Millisecond
+	if !w.awaitBackend(context.Background()) {
+		t.Fatal("expected no wait while a backend is in rotation")
+	}
+
+	// While restarting, the request is held until the backend comes back
+	w.backends[0].setHealthy(false)
+	time.AfterFunc(50*time.Millisecond, func() { healthy.Store(true) })
+	start := time.Now()
+	if !w.awaitBackend(context.Background()) {
+		t.Fatal("expected the backend to become ready within the wait")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("expected the request to be held until the backend was healthy")
+	}
+
+	// A client that goes away stops waiting
+	healthy.Store(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	if w.awaitBackend(ctx) {
+		t.Error("expected a cancelled wait to fail")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected the disconnect to end the wait early")
+	}
+}
+
+func TestHandleSSEProxyReadyWaitTimesOut(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:1")
+	w.started.Store(false)
+	w.sseReadyWait = 50 * time.Millisecond
+	w.backendWaitInterval = 10 * time.Millisecond
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 once the ready wait passes, got %d", rec.Code)
+	}
+	if w.sseConns["token"] != 0 {
+		t.Error("a rejected request must not hold an SSE slot")
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	base, ceiling := 100*time.Millisecond, time.Second
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 100: time.Second} {
+		for i := 0; i < 20; i++ {
+			if got := jitteredBackoff(base, ceiling, attempt); got < want/2 || got > want {
+				t.Fatalf("attempt %d: expected a delay between %s and %s, got %s", attempt, want/2, want, got)
+			}
+		}
+	}
+}
+
+func TestProbeMCPHealthSharesInFlightProbe(t *testing.T) {
+	var probes atomic.Int32
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		<-release
+	}))
+	t.Cleanup(backend.Close)
+
+	w := newTestWrapper(backend.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.probeMCPHealth(context.Background()); err != nil {
+				t.Errorf("probe: %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := probes.Load(); n != 1 {
+		t.Errorf("expected concurrent callers to share one probe, got %d", n)
+	}
+}
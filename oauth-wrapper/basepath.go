@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// validBasePath checks a configured base path: a leading slash, no trailing one, and plain path
+// segments, so it can be used verbatim as a route prefix
+func validBasePath(p string) bool {
+	if !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(p[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~", c)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// underBasePath serves mux below the configured base path. The authorization server metadata is
+// also served where RFC 8414 section 3.1 looks for it when the issuer has a path: the well-known
+// path inserted before the base path.
+func (w *OAuthWrapper) underBasePath(mux http.Handler) http.Handler {
+	root := http.NewServeMux()
+	root.Handle(w.basePath+"/", http.StripPrefix(w.basePath, mux))
+	root.Handle("/.well-known/oauth-authorization-server"+w.basePath, allowMethods(http.HandlerFunc(w.handleMetadata), http.MethodGet))
+	return root
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidBasePath(t *testing.T) {
+	tests := map[string]bool{
+		"/oauth":         true,
+		"/gateway/oauth": true,
+		"/v1.2_x~y-z":    true,
+		"oauth":          false,
+		"/oauth/":        false,
+		"/":              false,
+		"//oauth":        false,
+		"/oauth/../x":    false,
+		"/oauth/{id}":    false,
+		"/oauth?x=1":     false,
+	}
+	for path, want := range tests {
+		if got := validBasePath(path); got != want {
+			t.Errorf("validBasePath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestBasePathPrefixesRoutesAndMetadata(t *testing.T) {
+	w := newOAuthWrapper(&Config{PublicURL: "https://gateway.example.com", BasePath: "/oauth", MCPURL: "http://127.0.0.1:13080"})
+	handler := w.routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	for _, path := range []string{"/oauth/.well-known/oauth-authorization-server", "/.well-known/oauth-authorization-server/oauth"} {
+		rec := get(path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, rec.Code)
+		}
+		var metadata OAuth2Metadata
+		if err := json.NewDecoder(rec.Body).Decode(&metadata); err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Issuer != "https://gateway.example.com/oauth" || metadata.TokenEndpoint != "https://gateway.example.com/oauth/token" {
+			t.Errorf("%s: expected prefixed URLs, got issuer %q and token endpoint %q", path, metadata.Issuer, metadata.TokenEndpoint)
+		}
+	}
+
+	if rec := get("/oauth/health"); rec.Code != http.StatusOK {
+		t.Errorf("expected routes under the base path, got %d", rec.Code)
+	}
+	if rec := get("/.well-known/oauth-authorization-server"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected unprefixed routes to be gone, got %d", rec.Code)
+	}
+}
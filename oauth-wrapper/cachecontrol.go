@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discoveryMaxAge is how long clients and caches may reuse discovery documents (metadata and, once
+// served, JWKS) without revalidating. They only change when the configuration does, and the ETag
+// lets clients revalidate cheaply after that.
+const discoveryMaxAge = time.Hour
+
+// writeCacheableJSON writes v as JSON with Cache-Control and a strong ETag over the encoded body,
+// answering 304 Not Modified when the request's If-None-Match already has it
+func writeCacheableJSON(rw http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(rw, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+	rw.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(discoveryMaxAge.Seconds())))
+	rw.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(body)
+}
+
+// etagMatches applies If-None-Match's weak comparison (RFC 9110 section 13.1.2): any listed tag
+// with the same opaque value matches, as does *
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
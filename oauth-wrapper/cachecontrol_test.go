@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscoveryCaching(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.resources = []string{"http://localhost:8080/sse"}
+	handler := w.routes()
+
+	for _, path := range []string{"/.well-known/oauth-authorization-server", "/.well-known/openid-configuration", protectedResourcePath} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			etag := rec.Header().Get("ETag")
+			if rec.Code != http.StatusOK || etag == "" {
+				t.Fatalf("expected 200 with an ETag, got %d %q", rec.Code, etag)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+				t.Errorf("unexpected Cache-Control %q", got)
+			}
+
+			for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set("If-None-Match", ifNoneMatch)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+					t.Errorf("If-None-Match %s: expected an empty 304 with the ETag, got %d", ifNoneMatch, rec.Code)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("If-None-Match", `"stale"`)
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+				t.Errorf("expected a stale ETag to get the document, got %d", rec.Code)
+			}
+		})
+	}
+
+	// The ETag follows the content, so a configuration change invalidates cached copies
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/oauth-authorization-server", nil))
+	before := rec.Header().Get("ETag")
+	w.dpop = true
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/oauth-authorization-server", nil))
+	if rec.Header().Get("ETag") == before {
+		t.Error("expected the ETag to change with the metadata")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// How /oauth/callback answers. The wrapper never starts an authorization flow of its own, so
+// nothing redirects here in normal operation; clients such as Claude Teams receive their codes on
+// their own redirect URIs.
+const (
+	callbackModeEcho           = "echo"            // 200 with what was received, for debugging
+	callbackModeNotFound       = "not-found"       // 404, as if the route didn't exist
+	callbackModeNotImplemented = "not-implemented" // 501 explaining the endpoint isn't used
+)
+
+var supportedCallbackModes = []string{callbackModeEcho, callbackModeNotFound, callbackModeNotImplemented}
+
+// maxCallbackStateLength bounds the state echoed back, which is reflected from the query
+const maxCallbackStateLength = 512
+
+// CallbackEcho is what the echo mode reports back. The code itself is never echoed or logged.
+type CallbackEcho struct {
+	Message          string `json:"message"`
+	State            string `json:"state,omitempty"`
+	CodeReceived     bool   `json:"code_received"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// validCallbackState checks state against its syntax (RFC 6749 appendix A.5: printable ASCII,
+// spaces included) and a length cap before it is reflected back
+func validCallbackState(state string) bool {
+	if len(state) > maxCallbackStateLength {
+		return false
+	}
+	for _, c := range state {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// handleCallback answers requests to /oauth/callback according to the configured mode. Every
+// request is logged with the parameters it carried, so a misdirected redirect is easy to spot.
+func (w *OAuthWrapper) handleCallback(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	slog.InfoContext(r.Context(), "Received request on the unused OAuth callback", "mode", w.callbackMode,
+		"state", state, "code_received", q.Has("code"), "error", q.Get("error"), "error_description", q.Get("error_description"))
+
+	switch w.callbackMode {
+	case callbackModeNotFound:
+		http.NotFound(rw, r)
+		return
+	case callbackModeNotImplemented:
+		writeJSONError(rw, http.StatusNotImplemented, "unsupported_endpoint",
+			"The wrapper doesn't start authorization flows, so this callback isn't used; clients receive codes on their own redirect URIs")
+		return
+	}
+
+	if !validCallbackState(state) {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_request", "state is too long or contains characters that aren't allowed")
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(CallbackEcho{
+		Message:          "OAuth callback received; the wrapper doesn't use it, clients receive codes on their own redirect URIs",
+		State:            state,
+		CodeReceived:     q.Has("code"),
+		Error:            q.Get("error"),
+		ErrorDescription: q.Get("error_description"),
+	})
+}
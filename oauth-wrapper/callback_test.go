@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCallbackModes(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	handler := w.routes()
+	callback := func(q url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/callback?"+q.Encode(), nil))
+		return rec
+	}
+
+	w.callbackMode = callbackModeEcho
+	rec := callback(url.Values{"code": {"secret-code"}, "state": {"abc 123"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 in echo mode, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "secret-code") {
+		t.Error("the code must never be echoed")
+	}
+	var echo CallbackEcho
+	if err := json.NewDecoder(rec.Body).Decode(&echo); err != nil {
+		t.Fatal(err)
+	}
+	if echo.State != "abc 123" || !echo.CodeReceived {
+		t.Errorf("expected the state and code presence to be echoed, got %+v", echo)
+	}
+
+	if rec := callback(url.Values{"state": {"a\nb"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a state with control characters to be rejected, got %d", rec.Code)
+	}
+	if rec := callback(url.Values{"state": {strings.Repeat("s", maxCallbackStateLength+1)}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an overlong state to be rejected, got %d", rec.Code)
+	}
+
+	w.callbackMode = callbackModeNotFound
+	if rec := callback(nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 in not-found mode, got %d", rec.Code)
+	}
+
+	w.callbackMode = callbackModeNotImplemented
+	rec = callback(nil)
+	if rec.Code != http.StatusNotImplemented || decodeJSONError(t, rec)["error"] != "unsupported_endpoint" {
+		t.Errorf("expected 501 unsupported_endpoint in not-implemented mode, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// checkConfig reports a configuration that loaded and validated, for -check-config: a redacted
+// summary of every setting and, with -check-backends, the health of each MCP backend. It returns
+// an error if any backend check fails.
+func checkConfig(out io.Writer, cfg *Config) error {
+	fmt.Fprintln(out, "Configuration is valid:")
+	for _, attr := range cfg.LogValue().Group() {
+		fmt.Fprintf(out, "  %s = %s\n", attr.Key, attr.Value)
+	}
+	if !cfg.CheckBackends {
+		return nil
+	}
+
+	w := newOAuthWrapper(cfg)
+	var errs []error
+	for _, backendURL := range w.backendURLs() {
+		if err := w.checkBackendHealth(context.Background(), backendURL); err != nil {
+			fmt.Fprintf(out, "MCP backend %s: FAILED: %v\n", backendURL, err)
+			errs = append(errs, fmt.Errorf("MCP backend %s: %w", backendURL, err))
+			continue
+		}
+		fmt.Fprintf(out, "MCP backend %s: ok\n", backendURL)
+	}
+	return errors.Join(errs...)
+}
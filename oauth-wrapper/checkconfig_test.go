@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-secret")
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg, err := loadConfig([]string{"-check-config", "-mcp-backends", backend.URL})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if !cfg.CheckConfig || cfg.CheckBackends {
+		t.Fatalf("expected only -check-config to be set, got %v %v", cfg.CheckConfig, cfg.CheckBackends)
+	}
+
+	var out strings.Builder
+	if err := checkConfig(&out, cfg); err != nil {
+		t.Fatalf("checkConfig: %v", err)
+	}
+	if !strings.Contains(out.String(), "slack_token = [redacted]") || strings.Contains(out.String(), "xoxp-secret") {
+		t.Errorf("expected a redacted summary, got:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "MCP backend") {
+		t.Error("backends should only be probed with -check-backends")
+	}
+
+	cfg.CheckBackends = true
+	cfg.MCPBackends = []string{backend.URL, "http://127.0.0.1:1"}
+	out.Reset()
+	err = checkConfig(&out, cfg)
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Errorf("expected the unreachable backend to fail the check, got %v", err)
+	}
+	if !strings.Contains(out.String(), backend.URL+": ok") {
+		t.Errorf("expected the healthy backend to be reported, got:\n%s", out.String())
+	}
+}
+
+func TestCheckConfigIsCommandLineOnly(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"check-config": true}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig([]string{"-config", path}); err == nil {
+		t.Error("expected check-config to be rejected in the config file")
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// private_key_jwt client authentication (RFC 7523 section 2.2, OpenID Connect Core section 9):
+// the client proves its identity at /token with a JWT signed by a key it registered.
+
+const (
+	authMethodPrivateKeyJWT = "private_key_jwt"
+	clientAssertionTypeJWT  = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// Signature algorithms accepted on client assertions
+var supportedAssertionAlgs = []string{"RS256", "ES256"}
+
+const (
+	// assertionClockSkew tolerates clocks that disagree slightly on exp and nbf
+	assertionClockSkew = 30 * time.Second
+	// maxAssertionLifetime bounds how far in the future exp may be, which also bounds how long jtis are kept
+	maxAssertionLifetime = 10 * time.Minute
+	// maxJWKSBytes bounds a fetched JWKS document
+	maxJWKSBytes = 64 << 10
+	// jwksCacheTTL is how long keys fetched from a jwks_uri are used before it is fetched again
+	jwksCacheTTL = 5 * time.Minute
+	// jwksRefetchInterval spaces out refetches for a kid the cached keys lack, so assertions naming
+	// made-up kids can't turn into a stream of outbound requests
+	jwksRefetchInterval = 10 * time.Second
+)
+
+// jwk is a JSON Web Key (RFC 7517), limited to the RSA and P-256 EC members we verify with
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// D is the private exponent or scalar; it's only decoded so private keys can be refused
+	D string `json:"d,omitempty"`
+}
+
+// jwkSet is a JWKS document
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// publicKey decodes the key, rejecting kinds and curves we can't verify with
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	if k.D != "" {
+		return nil, errors.New("key must not include private key material")
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("RSA key modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA key has an invalid exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key is %d bits, at least 2048 are required", n.BitLen())
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("EC curve %q is not supported, use P-256", k.Crv)
+		}
+		x, errX := decodeBigInt(k.X)
+		y, errY := decodeBigInt(k.Y)
+		if errX != nil || errY != nil || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("EC key is not a valid P-256 point")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("key type %q is not supported", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("not a base64url-encoded integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// validateClientKeys checks the key material a private_key_jwt client registers
+func validateClientKeys(req *ClientRegistrationRequest) error {
+	if req.TokenEndpointAuthMethod != authMethodPrivateKeyJWT {
+		if req.JWKS != nil || req.JWKSURI != "" {
+			return errors.New("jwks and jwks_uri are only used with token_endpoint_auth_method private_key_jwt")
+		}
+		return nil
+	}
+
+	switch {
+	case (req.JWKS == nil) == (req.JWKSURI == ""):
+		return errors.New("private_key_jwt clients must register exactly one of jwks or jwks_uri")
+	case req.JWKSURI != "":
+		u, err := url.Parse(req.JWKSURI)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("jwks_uri %q must be an https URL", req.JWKSURI)
+		}
+	default:
+		if len(req.JWKS.Keys) == 0 {
+			return errors.New("jwks must contain at least one key")
+		}
+		for _, key := range req.JWKS.Keys {
+			if _, err := key.publicKey(); err != nil {
+				return fmt.Errorf("jwks key %q: %w", key.Kid, err)
+			}
+		}
+	}
+	return nil
+}
+
+// assertionClaims are the JWT claims a client assertion must carry
+type assertionClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ID        string   `json:"jti"`
+}
+
+// audience accepts the JWT aud claim as either a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// assertionIssuer reads the client_id a client assertion claims to come from, without verifying it,
+// so the client can be looked up when the request doesn't name it
+func assertionIssuer(assertion string) string {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	var claims assertionClaims
+	if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err != nil || json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+// verifyClientAssertion authenticates a private_key_jwt client from its signed assertion
+func (w *OAuthWrapper) verifyClientAssertion(ctx context.Context, client *ClientRegistrationResponse, assertionType, assertion string) error {
+	if assertionType != clientAssertionTypeJWT {
+		return fmt.Errorf("client_assertion_type must be %s", clientAssertionTypeJWT)
+	}
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return errors.New("client_assertion is not a JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return fmt.Errorf("client_assertion header: %w", err)
+	}
+	if !slices.Contains(supportedAssertionAlgs, header.Alg) {
+		return fmt.Errorf("client_assertion alg %q is not supported, use one of %s", header.Alg, strings.Join(supportedAssertionAlgs, ", "))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("client_assertion signature is not base64url")
+	}
+
+	keys, err := w.clientKeys(ctx, client, header.Kid)
+	if err != nil {
+		return err
+	}
+	if !verifyJWTSignature(keys, header.Alg, header.Kid, parts[0]+"."+parts[1], signature) {
+		return errors.New("client_assertion signature does not match any registered key")
+	}
+
+	var claims assertionClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return fmt.Errorf("client_assertion claims: %w", err)
+	}
+	now := w.now()
+	switch {
+	case claims.Issuer != client.ClientID || claims.Subject != client.ClientID:
+		return errors.New("client_assertion iss and sub must be the client_id")
+	case !slices.Contains(claims.Audience, w.publicURL+"/token"):
+		return fmt.Errorf("client_assertion aud must include %s", w.publicURL+"/token")
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(assertionClockSkew)):
+		return errors.New("client_assertion is expired")
+	case time.Unix(claims.ExpiresAt, 0).After(now.Add(maxAssertionLifetime)):
+		return fmt.Errorf("client_assertion exp must be within %s", maxAssertionLifetime)
+	case claims.NotBefore != 0 && now.Add(assertionClockSkew).Before(time.Unix(claims.NotBefore, 0)):
+		return errors.New("client_assertion is not valid yet")
+	case claims.ID == "":
+		return errors.New("client_assertion must have a jti")
+	}
+
+	if err := w.assertionIDs.use(client.ClientID+" "+claims.ID, time.Unix(claims.ExpiresAt, 0).Add(assertionClockSkew), now); err != nil {
+		return fmt.Errorf("client_assertion %w", err)
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("not base64url")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("not a JSON object")
+	}
+	return nil
+}
+
+// verifyJWTSignature checks the signature against every usable key, or only the one named by kid
+func verifyJWTSignature(keys []jwk, alg, kid, signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+	for _, key := range keys {
+		if (kid != "" && key.Kid != kid) || (key.Alg != "" && key.Alg != alg) || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		publicKey, err := key.publicKey()
+		if err != nil {
+			continue
+		}
+		switch pub := publicKey.(type) {
+		case *rsa.PublicKey:
+			if alg == "RS256" && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			// JWS encodes ES256 signatures as the 32-byte r and s concatenated
+			if alg == "ES256" && len(signature) == 64 {
+				r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+				if ecdsa.Verify(pub, digest[:], r, s) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// newJWKSClient fetches jwks_uri documents over transport. Anyone may register a jwks_uri, and only
+// the registered URL is checked to be https, so redirects are refused rather than followed anywhere.
+func newJWKSClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errors.New("jwks_uri must not redirect")
+		},
+	}
+}
+
+// clientKeys returns the keys a client registered inline, or those from its jwks_uri. Fetched keys
+// are cached, and fetched again early only when the assertion names a kid they lack.
+func (w *OAuthWrapper) clientKeys(ctx context.Context, client *ClientRegistrationResponse, kid string) ([]jwk, error) {
+	if client.JWKS != nil {
+		return client.JWKS.Keys, nil
+	}
+
+	now := w.now()
+	if cached, ok := w.jwks.get(client.JWKSURI); ok {
+		age := now.Sub(cached.fetchedAt)
+		hasKid := kid == "" || slices.ContainsFunc(cached.keys, func(key jwk) bool { return key.Kid == kid })
+		if age < jwksCacheTTL && (hasKid || age < jwksRefetchInterval) {
+			return cached.keys, nil
+		}
+	}
+	keys, err := w.fetchJWKS(ctx, client.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	w.jwks.put(client.JWKSURI, keys, now)
+	return keys, nil
+}
+
+// fetchJWKS downloads the key set at uri
+func (w *OAuthWrapper) fetchJWKS(ctx context.Context, uri string) ([]jwk, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := w.jwksClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks_uri: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks_uri: %s", resp.Status)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("jwks_uri did not return a JWKS: %w", err)
+	}
+	return set.Keys, nil
+}
+
+// jwksCache holds the keys fetched from each jwks_uri
+type jwksCache struct {
+	mu      sync.Mutex
+	entries map[string]jwksCacheEntry
+}
+
+type jwksCacheEntry struct {
+	keys      []jwk
+	fetchedAt time.Time
+}
+
+func (c *jwksCache) get(uri string) (jwksCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[uri]
+	return entry, ok
+}
+
+// put stores the keys fetched from uri, dropping entries too old to be used again
+func (c *jwksCache) put(uri string, keys []jwk, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]jwksCacheEntry)
+	}
+	for cached, entry := range c.entries {
+		if now.Sub(entry.fetchedAt) >= jwksCacheTTL {
+			delete(c.entries, cached)
+		}
+	}
+	c.entries[uri] = jwksCacheEntry{keys: keys, fetchedAt: now}
+}
+
+// maxAssertionIDs caps how many unexpired ids an assertionIDCache holds. Past it new ids are
+// refused rather than older ones forgotten, which would let them be replayed.
+const maxAssertionIDs = 100_000
+
+var (
+	errAssertionIDUsed      = errors.New("has already been used")
+	errAssertionIDCacheFull = errors.New("cannot be checked for replay, too many are outstanding")
+)
+
+// assertionIDCache remembers the jtis of accepted assertions (or redeemed stateless codes) until they
+// expire, so none is accepted twice. Ids are queued by expiry, so each use only sweeps the expired ones.
+type assertionIDCache struct {
+	mu     sync.Mutex
+	ids    map[string]time.Time
+	expiry assertionIDQueue
+}
+
+// use records id, failing with errAssertionIDUsed if it was already used or errAssertionIDCacheFull
+// if the cache can't take it
+func (c *assertionIDCache) use(id string, expiresAt, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids == nil {
+		c.ids = make(map[string]time.Time)
+	}
+	for len(c.expiry) > 0 && now.After(c.expiry[0].expiresAt) {
+		delete(c.ids, heap.Pop(&c.expiry).(assertionID).id)
+	}
+	if _, ok := c.ids[id]; ok {
+		return errAssertionIDUsed
+	}
+	if len(c.ids) >= maxAssertionIDs {
+		return errAssertionIDCacheFull
+	}
+	c.ids[id] = expiresAt
+	heap.Push(&c.expiry, assertionID{id, expiresAt})
+	return nil
+}
+
+type assertionID struct {
+	id        string
+	expiresAt time.Time
+}
+
+// assertionIDQueue is a min-heap of ids by expiry
+type assertionIDQueue []assertionID
+
+func (q assertionIDQueue) Len() int           { return len(q) }
+func (q assertionIDQueue) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q assertionIDQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *assertionIDQueue) Push(x any)        { *q = append(*q, x.(assertionID)) }
+func (q *assertionIDQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
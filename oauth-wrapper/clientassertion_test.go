@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newAssertionKey generates a P-256 key and its public JWK
+func newAssertionKey(t *testing.T, kid string) (*ecdsa.PrivateKey, jwk) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, jwk{
+		Kty: "EC",
+		Kid: kid,
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// signAssertion builds an ES256 client assertion
+func signAssertion(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestValidateClientKeys(t *testing.T) {
+	_, key := newAssertionKey(t, "k1")
+
+	tests := []struct {
+		name    string
+		req     ClientRegistrationRequest
+		wantErr bool
+	}{
+		{"inline jwks", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKS: &jwkSet{Keys: []jwk{key}}}, false},
+		{"jwks_uri", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKSURI: "https://app.example.com/jwks.json"}, false},
+		{"no keys", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT}, true},
+		{"both", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKS: &jwkSet{Keys: []jwk{key}}, JWKSURI: "https://app.example.com/jwks.json"}, true},
+		{"http jwks_uri", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKSURI: "http://app.example.com/jwks.json"}, true},
+		{"empty jwks", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKS: &jwkSet{}}, true},
+		{"unsupported curve", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKS: &jwkSet{Keys: []jwk{{Kty: "EC", Crv: "P-384", X: key.X, Y: key.Y}}}}, true},
+		{"short RSA key", ClientRegistrationRequest{TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKS: &jwkSet{Keys: []jwk{{Kty: "RSA", N: base64.RawURLEncoding.EncodeToString(make([]byte, 128)), E: "AQAB"}}}}, true},
+		{"keys without private_key_jwt", ClientRegistrationRequest{JWKSURI: "https://app.example.com/jwks.json"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateClientKeys(&tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("validateClientKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeWithClientAssertion(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	key, public := newAssertionKey(t, "k1")
+	otherKey, _ := newAssertionKey(t, "k1")
+
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"iss": "jwt-client",
+			"sub": "jwt-client",
+			"aud": "http://localhost:8080/token",
+			"exp": now.Add(time.Minute).Unix(),
+			"jti": "jti-1",
+		}
+	}
+
+	tests := []struct {
+		name          string
+		signer        *ecdsa.PrivateKey
+		modify        func(map[string]any)
+		assertionType string
+		wantErr       bool
+	}{
+		{"success", key, func(map[string]any) {}, clientAssertionTypeJWT, false},
+		{"aud array", key, func(c map[string]any) { c["aud"] = []string{"other", "http://localhost:8080/token"} }, clientAssertionTypeJWT, false},
+		{"wrong aud", key, func(c map[string]any) { c["aud"] = "http://localhost:8080/authorize" }, clientAssertionTypeJWT, true},
+		{"wrong issuer", key, func(c map[string]any) { c["iss"] = "client" }, clientAssertionTypeJWT, true},
+		{"expired", key, func(c map[string]any) { c["exp"] = now.Add(-time.Minute).Unix() }, clientAssertionTypeJWT, true},
+		{"too long lived", key, func(c map[string]any) { c["exp"] = now.Add(time.Hour).Unix() }, clientAssertionTypeJWT, true},
+		{"not yet valid", key, func(c map[string]any) { c["nbf"] = now.Add(time.Minute).Unix() }, clientAssertionTypeJWT, true},
+		{"missing jti", key, func(c map[string]any) { delete(c, "jti") }, clientAssertionTypeJWT, true},
+		{"bad signature", otherKey, func(map[string]any) {}, clientAssertionTypeJWT, true},
+		{"missing assertion type", key, func(map[string]any) {}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newOAuthTestWrapper(now)
+			w.clients["jwt-client"] = &ClientRegistrationResponse{
+				ClientID:                "jwt-client",
+				RedirectURIs:            []string{testRedirectURI},
+				TokenEndpointAuthMethod: authMethodPrivateKeyJWT,
+				JWKS:                    &jwkSet{Keys: []jwk{public}},
+			}
+			w.authCodes["code"] = &AuthCode{ClientID: "jwt-client", RedirectURI: testRedirectURI, ExpiresAt: now.Add(time.Minute)}
+			claims := validClaims()
+			tt.modify(claims)
+			req := tokenRequest{
+				GrantType:           "authorization_code",
+				Code:                "code",
+				ClientID:            "jwt-client",
+				RedirectURI:         testRedirectURI,
+				ClientAssertionType: tt.assertionType,
+				ClientAssertion:     signAssertion(t, tt.signer, "k1", claims),
+			}
+
+			_, err := w.exchangeCode(req)
+			if tt.wantErr {
+				wantOAuthError(t, err, http.StatusUnauthorized, "invalid_client")
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchangeCode: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientAssertionReplay(t *testing.T) {
+	now := time.Now()
+	key, public := newAssertionKey(t, "k1")
+	w := newOAuthTestWrapper(now)
+	client := &ClientRegistrationResponse{ClientID: "jwt-client", TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKS: &jwkSet{Keys: []jwk{public}}}
+	assertion := signAssertion(t, key, "", map[string]any{
+		"iss": "jwt-client", "sub": "jwt-client", "aud": []string{"http://localhost:8080/token"},
+		"exp": now.Add(time.Minute).Unix(), "jti": "once",
+	})
+
+	if err := w.verifyClientAssertion(context.Background(), client, clientAssertionTypeJWT, assertion); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := w.verifyClientAssertion(context.Background(), client, clientAssertionTypeJWT, assertion); err == nil {
+		t.Error("expected a replayed jti to be rejected")
+	}
+}
+
+func TestAssertionIDCache(t *testing.T) {
+	now := time.Now()
+	var c assertionIDCache
+
+	if err := c.use("a", now.Add(time.Minute), now); err != nil {
+		t.Fatalf("expected a new id to be accepted, got %v", err)
+	}
+	if err := c.use("a", now.Add(time.Minute), now); !errors.Is(err, errAssertionIDUsed) {
+		t.Errorf("expected a reused id to be refused, got %v", err)
+	}
+	c.use("b", now.Add(2*time.Minute), now)
+
+	// Expired ids are swept in expiry order, leaving unexpired ones
+	later := now.Add(90 * time.Second)
+	if err := c.use("a", later.Add(time.Minute), later); err != nil {
+		t.Errorf("expected an expired id to be usable again, got %v", err)
+	}
+	if err := c.use("b", later.Add(time.Minute), later); !errors.Is(err, errAssertionIDUsed) {
+		t.Errorf("expected an unexpired id to stay used, got %v", err)
+	}
+	if len(c.ids) != 2 || len(c.expiry) != 2 {
+		t.Errorf("expected 2 ids held, got %d (%d queued)", len(c.ids), len(c.expiry))
+	}
+}
+
+func TestAssertionIDCacheLimit(t *testing.T) {
+	now := time.Now()
+	var c assertionIDCache
+	for i := range maxAssertionIDs {
+		if err := c.use(strconv.Itoa(i), now.Add(time.Minute), now); err != nil {
+			t.Fatalf("use %d: %v", i, err)
+		}
+	}
+
+	if err := c.use("one-too-many", now.Add(time.Minute), now); !errors.Is(err, errAssertionIDCacheFull) {
+		t.Errorf("expected a full cache to refuse new ids, got %v", err)
+	}
+	if err := c.use("0", now.Add(time.Minute), now); !errors.Is(err, errAssertionIDUsed) {
+		t.Errorf("expected a full cache to keep refusing replays, got %v", err)
+	}
+
+	// Room frees up as ids expire
+	later := now.Add(2 * time.Minute)
+	if err := c.use("one-too-many", later.Add(time.Minute), later); err != nil {
+		t.Errorf("expected expired ids to make room, got %v", err)
+	}
+	if len(c.ids) != 1 {
+		t.Errorf("expected only the new id held, got %d", len(c.ids))
+	}
+}
+
+func TestClientAssertionFromJWKSURI(t *testing.T) {
+	now := time.Now()
+	key, public := newAssertionKey(t, "k1")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(jwkSet{Keys: []jwk{public}})
+	}))
+	defer server.Close()
+
+	w := newOAuthTestWrapper(now)
+	w.jwksClient = newJWKSClient(server.Client().Transport)
+	client := &ClientRegistrationResponse{ClientID: "jwt-client", TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKSURI: server.URL}
+	assertion := signAssertion(t, key, "k1", map[string]any{
+		"iss": "jwt-client", "sub": "jwt-client", "aud": "http://localhost:8080/token",
+		"exp": now.Add(time.Minute).Unix(), "jti": "from-uri",
+	})
+
+	if err := w.verifyClientAssertion(context.Background(), client, clientAssertionTypeJWT, assertion); err != nil {
+		t.Errorf("expected the assertion to verify against the fetched keys: %v", err)
+	}
+	if got := assertionIssuer(assertion); got != "jwt-client" {
+		t.Errorf("assertionIssuer() = %q", got)
+	}
+}
+
+func TestJWKSURIRedirectRefused(t *testing.T) {
+	var followed atomic.Bool
+	internal := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	}))
+	defer internal.Close()
+	server := httptest.NewTLSServer(http.RedirectHandler(internal.URL+"/jwks.json", http.StatusFound))
+	defer server.Close()
+
+	now := time.Now()
+	key, _ := newAssertionKey(t, "k1")
+	w := newOAuthTestWrapper(now)
+	w.jwksClient = newJWKSClient(server.Client().Transport)
+	client := &ClientRegistrationResponse{ClientID: "jwt-client", TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKSURI: server.URL}
+	assertion := signAssertion(t, key, "k1", map[string]any{
+		"iss": "jwt-client", "sub": "jwt-client", "aud": "http://localhost:8080/token",
+		"exp": now.Add(time.Minute).Unix(), "jti": "redirected",
+	})
+
+	if err := w.verifyClientAssertion(context.Background(), client, clientAssertionTypeJWT, assertion); err == nil {
+		t.Error("expected a redirecting jwks_uri to fail")
+	}
+	if followed.Load() {
+		t.Error("the redirect must not be followed")
+	}
+}
+
+func TestJWKSURICache(t *testing.T) {
+	key, public := newAssertionKey(t, "k1")
+	var fetches atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(rw).Encode(jwkSet{Keys: []jwk{public}})
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.now = func() time.Time { return now } // follows now as the test advances it
+	w.jwksClient = newJWKSClient(server.Client().Transport)
+	client := &ClientRegistrationResponse{ClientID: "jwt-client", TokenEndpointAuthMethod: authMethodPrivateKeyJWT, JWKSURI: server.URL}
+	verify := func(kid string) {
+		t.Helper()
+		assertion := signAssertion(t, key, kid, map[string]any{
+			"iss": "jwt-client", "sub": "jwt-client", "aud": "http://localhost:8080/token",
+			"exp": now.Add(time.Minute).Unix(), "jti": strconv.FormatInt(now.UnixNano(), 10) + kid,
+		})
+		w.verifyClientAssertion(context.Background(), client, clientAssertionTypeJWT, assertion)
+	}
+	wantFetches := func(want int32, why string) {
+		t.Helper()
+		if got := fetches.Load(); got != want {
+			t.Errorf("%s: expected %d fetches, got %d", why, want, got)
+		}
+	}
+
+	verify("k1")
+	verify("k1")
+	wantFetches(1, "a known kid is served from the cache")
+
+	verify("rotated")
+	wantFetches(1, "an unknown kid right after a fetch waits for the refetch interval")
+	now = now.Add(jwksRefetchInterval)
+	verify("rotated")
+	wantFetches(2, "an unknown kid refetches once the refetch interval has passed")
+
+	now = now.Add(jwksCacheTTL)
+	verify("k1")
+	wantFetches(3, "cached keys expire")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// MCP transports the wrapper serves side by side, with the paths clients use. Each is proxied to
+// the same path on the MCP server.
+const (
+	// HTTP+SSE: a GET /sse event stream, whose endpoint event names where to POST messages
+	transportSSE    = "sse"
+	sseEndpoint     = "/sse"
+	messageEndpoint = "/message"
+
+	// Streamable HTTP: POST messages, GET a server stream and DELETE the session, all on /mcp
+	transportStreamableHTTP = "streamable-http"
+	mcpEndpoint             = "/mcp"
+)
+
+// proxyTransport names the transport a proxied path belongs to, for metrics
+func proxyTransport(path string) string {
+	if path == mcpEndpoint {
+		return transportStreamableHTTP
+	}
+	return transportSSE
+}
+
+// proxyResource is the resource a token must be valid for to use a proxied path. Messages belong to
+// the session opened on /sse, so they are checked against it.
+func (w *OAuthWrapper) proxyResource(path string) string {
+	if path == messageEndpoint {
+		path = sseEndpoint
+	}
+	return w.publicURL + path
+}
+
+// mcpServerName is the key the snippets register the server under in client configs
+const mcpServerName = "slack"
+
+// MCPClientConfig tells users how to point their MCP client at this wrapper
+type MCPClientConfig struct {
+	ServerURL string `json:"server_url"`
+	Transport string `json:"transport"`
+	// StreamableHTTPURL is the same server for clients that speak Streamable HTTP
+	StreamableHTTPURL string         `json:"streamable_http_url"`
+	OAuthMetadataURL  string         `json:"oauth_metadata_url"`
+	Clients           map[string]any `json:"clients"`
+}
+
+// clientConfig builds ready-to-paste snippets for popular clients from the public URL and active transport
+func (w *OAuthWrapper) clientConfig() MCPClientConfig {
+	serverURL := w.publicURL + sseEndpoint
+
+	return MCPClientConfig{
+		ServerURL:         serverURL,
+		Transport:         transportSSE,
+		StreamableHTTPURL: w.publicURL + mcpEndpoint,
+		OAuthMetadataURL:  w.publicURL + "/.well-known/oauth-authorization-server",
+		Clients: map[string]any{
+			// Claude (web and Teams) custom connectors take the URL and run OAuth themselves
+			"claude": map[string]string{"connector_url": serverURL},
+			// Claude Desktop bridges remote servers through mcp-remote, which handles OAuth
+			"claude_desktop": map[string]any{
+				"mcpServers": map[string]any{
+					mcpServerName: map[string]any{
+						"command": "npx",
+						"args":    []string{"-y", "mcp-remote", serverURL, "--transport", "sse-only"},
+					},
+				},
+			},
+			"cursor": map[string]any{
+				"mcpServers": map[string]any{
+					mcpServerName: map[string]string{"url": serverURL},
+				},
+			},
+			"vscode": map[string]any{
+				"servers": map[string]any{
+					mcpServerName: map[string]string{"type": transportSSE, "url": serverURL},
+				},
+			},
+		},
+	}
+}
+
+// Handle the client configuration helper
+func (w *OAuthWrapper) handleClientConfig(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(rw)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(w.clientConfig())
+}
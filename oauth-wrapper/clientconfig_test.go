@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleClientConfig(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.publicURL = "https://mcp.example.com"
+
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var config struct {
+		ServerURL        string `json:"server_url"`
+		Transport        string `json:"transport"`
+		OAuthMetadataURL string `json:"oauth_metadata_url"`
+		Clients          struct {
+			Cursor struct {
+				MCPServers map[string]struct {
+					URL string `json:"url"`
+				} `json:"mcpServers"`
+			} `json:"cursor"`
+			ClaudeDesktop struct {
+				MCPServers map[string]struct {
+					Args []string `json:"args"`
+				} `json:"mcpServers"`
+			} `json:"claude_desktop"`
+		} `json:"clients"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ServerURL != "https://mcp.example.com/sse" || config.Transport != transportSSE {
+		t.Errorf("unexpected server %q over %q", config.ServerURL, config.Transport)
+	}
+	if config.OAuthMetadataURL != "https://mcp.example.com/.well-known/oauth-authorization-server" {
+		t.Errorf("unexpected metadata URL %q", config.OAuthMetadataURL)
+	}
+	if got := config.Clients.Cursor.MCPServers[mcpServerName].URL; got != config.ServerURL {
+		t.Errorf("expected the Cursor snippet to use the server URL, got %q", got)
+	}
+	if args := config.Clients.ClaudeDesktop.MCPServers[mcpServerName].Args; len(args) < 3 || args[2] != config.ServerURL {
+		t.Errorf("expected mcp-remote pointed at the server URL, got %v", args)
+	}
+}
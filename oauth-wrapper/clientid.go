@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// maxClientIDAttempts bounds how often a colliding client ID is regenerated. One collision among
+// 192-bit IDs is already astronomically unlikely; several in a row mean the random source is broken.
+const maxClientIDAttempts = 5
+
+// newClientID generates a client ID no registered client has, checking that it has the expected
+// length and alphabet. The caller must hold w.mu so the ID can't be taken before it is stored.
+func (w *OAuthWrapper) newClientID() (string, error) {
+	for range maxClientIDAttempts {
+		clientID := w.randomString(clientIDLength)
+		if len(clientID) != clientIDLength || !validTokenPrefix(clientID) {
+			return "", fmt.Errorf("generated client ID %q is not %d base64url characters", clientID, clientIDLength)
+		}
+		if _, exists := w.clients[clientID]; !exists {
+			return clientID, nil
+		}
+		slog.Warn("Generated client ID collides with a registered client, generating another")
+	}
+	return "", fmt.Errorf("no unused client ID after %d attempts", maxClientIDAttempts)
+}
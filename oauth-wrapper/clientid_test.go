@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubRandomStrings returns the given strings in turn, repeating the last one
+func stubRandomStrings(values ...string) func(int) string {
+	return func(int) string {
+		value := values[0]
+		if len(values) > 1 {
+			values = values[1:]
+		}
+		return value
+	}
+}
+
+func TestRegistrationRegeneratesCollidingClientID(t *testing.T) {
+	taken := strings.Repeat("a", clientIDLength)
+	fresh := strings.Repeat("b", clientIDLength)
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.clients[taken] = &ClientRegistrationResponse{ClientID: taken, ClientName: "Existing"}
+	w.randomString = stubRandomStrings(taken, fresh)
+
+	body := `{"client_name":"Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"]}`
+	rec := httptest.NewRecorder()
+	w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp ClientRegistrationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ClientID != fresh {
+		t.Errorf("expected the regenerated client ID, got %q", resp.ClientID)
+	}
+	if w.clients[taken].ClientName != "Existing" {
+		t.Error("expected the existing client to be left alone")
+	}
+}
+
+func TestNewClientID(t *testing.T) {
+	taken := strings.Repeat("a", clientIDLength)
+	tests := []struct {
+		name    string
+		values  []string
+		wantErr bool
+	}{
+		{"unused", []string{strings.Repeat("c", clientIDLength)}, false},
+		{"always colliding", []string{taken}, true},
+		{"wrong length", []string{"short"}, true},
+		{"outside the alphabet", []string{strings.Repeat("=", clientIDLength)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWrapper("http://127.0.0.1:13080")
+			w.clients[taken] = &ClientRegistrationResponse{ClientID: taken}
+			w.randomString = stubRandomStrings(tt.values...)
+			if _, err := w.newClientID(); (err != nil) != tt.wantErr {
+				t.Errorf("newClientID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Registration reports a broken generator instead of overwriting a client
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.clients[taken] = &ClientRegistrationResponse{ClientID: taken, ClientName: "Existing"}
+	w.randomString = stubRandomStrings(taken)
+	body := `{"client_name":"Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"]}`
+	rec := httptest.NewRecorder()
+	w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+	if rec.Code != http.StatusInternalServerError || decodeJSONError(t, rec)["error"] != "server_error" {
+		t.Errorf("expected 500 server_error, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(w.clients) != 1 || w.clients[taken].ClientName != "Existing" {
+		t.Error("expected the existing client to be left alone")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+)
+
+// maxClientImportBytes bounds an import body, which holds many registrations at once
+const maxClientImportBytes = 10 << 20
+
+// ExportedClient is a client registration as moved between deployments. The secret only travels as
+// a SHA-256 hash, which the importing wrapper verifies presented secrets against.
+type ExportedClient struct {
+	ClientRegistrationResponse
+	ClientSecretHash string `json:"client_secret_hash,omitempty"`
+}
+
+// ClientExport is the document exchanged by the export and import endpoints
+type ClientExport struct {
+	Clients []ExportedClient `json:"clients"`
+}
+
+// ClientImportResult reports what an import changed
+type ClientImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+// hashClientSecret hashes a client secret for export. Secrets are long random strings, so an
+// unsalted hash can't be reversed by guessing.
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretMatches checks a presented secret against the client's secret, or its hash for imported
+// clients, in constant time either way
+func (c *ClientRegistrationResponse) secretMatches(secret string) bool {
+	if c.ClientSecretHash != "" {
+		return subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)), []byte(c.ClientSecretHash)) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(c.ClientSecret)) == 1
+}
+
+// Handle the admin export of every client registration, secrets hashed
+func (w *OAuthWrapper) handleAdminClientExport(rw http.ResponseWriter, r *http.Request) {
+	w.mu.RLock()
+	export := ClientExport{Clients: make([]ExportedClient, 0, len(w.clients))}
+	for _, client := range w.clients {
+		exported := ExportedClient{ClientRegistrationResponse: *client, ClientSecretHash: client.ClientSecretHash}
+		if client.ClientSecret != "" {
+			exported.ClientSecretHash = hashClientSecret(client.ClientSecret)
+		}
+		exported.ClientSecret = ""
+		export.Clients = append(export.Clients, exported)
+	}
+	w.mu.RUnlock()
+	sort.Slice(export.Clients, func(i, j int) bool {
+		return export.Clients[i].ClientIDIssuedAt < export.Clients[j].ClientIDIssuedAt
+	})
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(export)
+}
+
+// Handle the admin import of client registrations. Every entry is validated before any is stored,
+// and entries replace existing clients with the same client_id, so repeating an import is harmless.
+func (w *OAuthWrapper) handleAdminClientImport(rw http.ResponseWriter, r *http.Request) {
+	var export ClientExport
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxClientImportBytes)).Decode(&export); err != nil {
+		if isBodyTooLarge(err) {
+			writeJSONError(rw, http.StatusRequestEntityTooLarge, "invalid_request", "Request body too large")
+			return
+		}
+		writeJSONError(rw, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+
+	var errs []error
+	seen := make(map[string]bool, len(export.Clients))
+	for i, client := range export.Clients {
+		if seen[client.ClientID] {
+			errs = append(errs, fmt.Errorf("clients[%d]: duplicate client_id %q", i, client.ClientID))
+			continue
+		}
+		seen[client.ClientID] = true
+		if w.isStatic(client.ClientID) {
+			errs = append(errs, fmt.Errorf("clients[%d]: client_id %q is a static client and can't be replaced", i, client.ClientID))
+			continue
+		}
+		if err := w.validateImportedClient(&client); err != nil {
+			errs = append(errs, fmt.Errorf("clients[%d]: %w", i, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	var result ClientImportResult
+	w.mu.Lock()
+	created := 0
+	for _, client := range export.Clients {
+		if _, exists := w.clients[client.ClientID]; !exists {
+			created++
+		}
+	}
+	if w.maxClients > 0 && len(w.clients)+created > w.maxClients {
+		w.mu.Unlock()
+		writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "Import would exceed the maximum number of registered clients")
+		return
+	}
+	for _, client := range export.Clients {
+		stored := client.ClientRegistrationResponse
+		stored.ClientSecretHash = client.ClientSecretHash
+		stored.Static = false
+		if _, exists := w.clients[client.ClientID]; exists {
+			result.Updated++
+		} else {
+			result.Created++
+		}
+		w.clients[client.ClientID] = &stored
+	}
+	registeredClients.Set(int64(len(w.clients)))
+	w.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Imported clients", "created", result.Created, "updated", result.Updated)
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(result)
+}
+
+// validateImportedClient applies the registration rules to an imported client, and requires
+// confidential clients to carry a secret hash instead of a secret
+func (w *OAuthWrapper) validateImportedClient(client *ExportedClient) error {
+	if client.ClientID == "" || !validTokenPrefix(client.ClientID) {
+		return fmt.Errorf("client_id %q must be non-empty and only contain letters, digits, _ and -", client.ClientID)
+	}
+	if client.ClientSecret != "" {
+		return errors.New("client_secret must not be imported in plain text, use client_secret_hash")
+	}
+
+	req := ClientRegistrationRequest{
+		ClientName:              client.ClientName,
+		RedirectURIs:            client.RedirectURIs,
+		GrantTypes:              client.GrantTypes,
+		ResponseTypes:           client.ResponseTypes,
+		TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+		JWKS:                    client.JWKS,
+		JWKSURI:                 client.JWKSURI,
+		ClientURI:               client.ClientURI,
+		LogoURI:                 client.LogoURI,
+		Contacts:                client.Contacts,
+		Metadata:                client.Metadata,
+		Extensions:              client.Extensions,
+	}
+	if err := validateRegistration(&req); err != nil {
+		return err
+	}
+	if err := w.checkGrantTypes(client.GrantTypes); err != nil {
+		return err
+	}
+	if err := w.checkRedirectSchemes(client.RedirectURIs); err != nil {
+		return err
+	}
+	if err := w.checkRedirectHosts(client.RedirectURIs); err != nil {
+		return err
+	}
+
+	confidential := client.TokenEndpointAuthMethod != "none" && client.TokenEndpointAuthMethod != authMethodPrivateKeyJWT
+	if hash, err := hex.DecodeString(client.ClientSecretHash); confidential && (err != nil || len(hash) != sha256.Size) {
+		return errors.New("confidential clients need a client_secret_hash of 64 hex characters")
+	}
+	if !confidential && client.ClientSecretHash != "" {
+		return errors.New("client_secret_hash is only used by confidential clients")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// adminRequest sends an admin-authenticated request through the routes of w
+func adminRequest(w *OAuthWrapper, method, path string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestClientExportImportRoundTrip(t *testing.T) {
+	now := time.Now()
+	src := newOAuthTestWrapper(now)
+	src.secrets.Store(&secrets{AdminToken: "admin"})
+	src.clients["client"].ClientName = "Claude"
+	src.clients["public"] = &ClientRegistrationResponse{
+		ClientID:                "public",
+		ClientName:              "Inspector",
+		RedirectURIs:            []string{testRedirectURI},
+		GrantTypes:              supportedGrantTypes,
+		ResponseTypes:           supportedResponseTypes,
+		TokenEndpointAuthMethod: "none",
+		ClientIDIssuedAt:        now.Unix() + 1,
+	}
+
+	rec := adminRequest(src, http.MethodGet, "/admin/clients/export", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), `"secret"`) {
+		t.Fatal("the export must not contain plaintext secrets")
+	}
+	export := rec.Body.String()
+
+	dst := newTestWrapper("http://127.0.0.1:13080")
+	dst.secrets.Store(&secrets{AdminToken: "admin"})
+	rec = adminRequest(dst, http.MethodPost, "/admin/clients/import", strings.NewReader(export))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var result ClientImportResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 2 || result.Updated != 0 {
+		t.Errorf("expected 2 created clients, got %+v", result)
+	}
+
+	// The imported confidential client still authenticates with its original secret
+	client := dst.clients["client"]
+	if client == nil || !client.secretMatches("secret") || client.secretMatches("wrong") {
+		t.Errorf("expected the imported client to verify its original secret, got %+v", client)
+	}
+
+	// Importing the same document again changes nothing
+	rec = adminRequest(dst, http.MethodPost, "/admin/clients/import", strings.NewReader(export))
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 0 || result.Updated != 2 || len(dst.clients) != 2 {
+		t.Errorf("expected a repeated import to update both clients, got %+v with %d clients", result, len(dst.clients))
+	}
+}
+
+func TestClientImportValidation(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.secrets.Store(&secrets{AdminToken: "admin"})
+	hash := hashClientSecret("secret")
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"plaintext secret", `{"clients":[{"client_id":"a","client_name":"A","client_secret":"secret","redirect_uris":["` + testRedirectURI + `"]}]}`},
+		{"missing secret hash", `{"clients":[{"client_id":"a","client_name":"A","redirect_uris":["` + testRedirectURI + `"]}]}`},
+		{"invalid client id", `{"clients":[{"client_id":"a b","client_name":"A","client_secret_hash":"` + hash + `","redirect_uris":["` + testRedirectURI + `"]}]}`},
+		{"duplicate client id", `{"clients":[{"client_id":"a","client_name":"A","client_secret_hash":"` + hash + `","redirect_uris":["` + testRedirectURI + `"]},{"client_id":"a","client_name":"A","client_secret_hash":"` + hash + `","redirect_uris":["` + testRedirectURI + `"]}]}`},
+		{"one bad entry among good ones", `{"clients":[{"client_id":"a","client_name":"A","client_secret_hash":"` + hash + `","redirect_uris":["` + testRedirectURI + `"]},{"client_id":"b","client_name":"B","client_secret_hash":"` + hash + `","redirect_uris":[]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(w, http.MethodPost, "/admin/clients/import", strings.NewReader(tt.body))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body)
+			}
+			if len(w.clients) != 0 {
+				t.Errorf("a rejected import must not store any client, got %d", len(w.clients))
+			}
+		})
+	}
+}
+
+func TestSecretMatches(t *testing.T) {
+	live := &ClientRegistrationResponse{ClientSecret: "secret"}
+	hashed := &ClientRegistrationResponse{ClientSecretHash: hashClientSecret("secret")}
+	for name, client := range map[string]*ClientRegistrationResponse{"live": live, "hashed": hashed} {
+		if !client.secretMatches("secret") {
+			t.Errorf("%s: expected the right secret to match", name)
+		}
+		for _, wrong := range []string{"", "secre", "secret2", "SECRET"} {
+			if client.secretMatches(wrong) {
+				t.Errorf("%s: expected %q not to match", name, wrong)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPKey carries the resolved client address in the request context
+type clientIPKey struct{}
+
+// clientIP returns the address of the client that sent r, as resolved by resolveClientIP
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// clientIPFrom returns the client address of the request owning ctx, if any
+func clientIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// resolveClientIP works out the real client address once per request and stores it in the context
+// for clientIP and the logger
+func (w *OAuthWrapper) resolveClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ip := forwardedClientIP(r, w.trustedProxyHops)
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+	})
+}
+
+// forwardedClientIP picks the client address out of X-Forwarded-For when the wrapper sits behind
+// trustedHops proxies. Each proxy appends the address it received the request from, so the entry
+// trustedHops from the right was written by our outermost proxy; anything left of it is
+// client-controlled. With no trusted hops the header is ignored, so it can't be spoofed.
+func forwardedClientIP(r *http.Request, trustedHops int) string {
+	if trustedHops <= 0 {
+		return remoteIP(r)
+	}
+
+	var entries []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			entries = append(entries, strings.TrimSpace(entry))
+		}
+	}
+	if len(entries) < trustedHops {
+		return remoteIP(r)
+	}
+
+	addr, err := netip.ParseAddr(entries[len(entries)-trustedHops])
+	if err != nil {
+		return remoteIP(r)
+	}
+	return addr.Unmap().String()
+}
+
+// remoteIP is the address of the peer on the other end of the connection
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
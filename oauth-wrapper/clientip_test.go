@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		forwarded   []string
+		trustedHops int
+		want        string
+	}{
+		{"trust off ignores header", "10.0.0.1:4000", []string{"203.0.113.7"}, 0, "10.0.0.1"},
+		{"one hop", "10.0.0.1:4000", []string{"203.0.113.7"}, 1, "203.0.113.7"},
+		{"spoofed entries left of the proxy are skipped", "10.0.0.1:4000", []string{"1.2.3.4, 203.0.113.7"}, 1, "203.0.113.7"},
+		{"two hops", "10.0.0.1:4000", []string{"1.2.3.4, 203.0.113.7, 10.0.0.2"}, 2, "203.0.113.7"},
+		{"multiple headers", "10.0.0.1:4000", []string{"1.2.3.4", "203.0.113.7"}, 1, "203.0.113.7"},
+		{"fewer entries than hops", "10.0.0.1:4000", []string{"203.0.113.7"}, 2, "10.0.0.1"},
+		{"garbage entry", "10.0.0.1:4000", []string{"not-an-ip"}, 1, "10.0.0.1"},
+		{"no header", "10.0.0.1:4000", nil, 1, "10.0.0.1"},
+		{"ipv6", "[::1]:4000", []string{"2001:db8::1"}, 1, "2001:db8::1"},
+		{"mapped ipv4", "10.0.0.1:4000", []string{"::ffff:203.0.113.7"}, 1, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := forwardedClientIP(r, tt.trustedHops); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.trustedProxyHops = 1
+
+	var got string
+	handler := w.resolveClientIP(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got = clientIP(r)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:4000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got != "203.0.113.7" {
+		t.Errorf("expected the forwarded client IP, got %q", got)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Bounds on the descriptive metadata a client may register, so registrations stay small
+const (
+	maxClientMetadataEntries     = 32
+	maxClientMetadataKeyLength   = 64
+	maxClientMetadataValueLength = 1024
+	maxClientContacts            = 10
+	maxClientContactLength       = 256
+	maxClientExtensionBytes      = 4096
+)
+
+// registrationFields are the JSON names ClientRegistrationRequest decodes itself; anything else a
+// client sends is kept in Extensions
+var registrationFields = sync.OnceValue(func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeFor[clientRegistrationFields]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+})
+
+// clientRegistrationFields has ClientRegistrationRequest's fields without its UnmarshalJSON
+type clientRegistrationFields ClientRegistrationRequest
+
+// UnmarshalJSON decodes the registration and preserves fields this server doesn't know in
+// Extensions, so they are stored and echoed back rather than silently dropped
+func (req *ClientRegistrationRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*clientRegistrationFields)(req)); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	req.Extensions = nil
+	for name, value := range all {
+		if registrationFields()[name] {
+			continue
+		}
+		if req.Extensions == nil {
+			req.Extensions = make(map[string]json.RawMessage)
+		}
+		req.Extensions[name] = value
+	}
+	return nil
+}
+
+// validateClientMetadata checks the descriptive fields a client registers: client_uri and
+// logo_uri must be web URLs, contacts and metadata are bounded, and unknown fields are limited in size
+func validateClientMetadata(req *ClientRegistrationRequest) error {
+	for name, uri := range map[string]string{"client_uri": req.ClientURI, "logo_uri": req.LogoURI} {
+		if uri == "" {
+			continue
+		}
+		if u, err := url.Parse(uri); err != nil || !isWebScheme(u.Scheme) || u.Host == "" {
+			return fmt.Errorf("%s %q must be an http or https URL", name, uri)
+		}
+	}
+
+	if len(req.Contacts) > maxClientContacts {
+		return fmt.Errorf("contacts must list at most %d entries", maxClientContacts)
+	}
+	for _, contact := range req.Contacts {
+		if strings.TrimSpace(contact) == "" || len(contact) > maxClientContactLength {
+			return fmt.Errorf("contacts entries must be non-empty and at most %d characters", maxClientContactLength)
+		}
+	}
+
+	if len(req.Metadata) > maxClientMetadataEntries {
+		return fmt.Errorf("metadata must have at most %d entries", maxClientMetadataEntries)
+	}
+	for key, value := range req.Metadata {
+		if key == "" || len(key) > maxClientMetadataKeyLength {
+			return fmt.Errorf("metadata keys must be non-empty and at most %d characters", maxClientMetadataKeyLength)
+		}
+		if len(value) > maxClientMetadataValueLength {
+			return fmt.Errorf("metadata value for %q must be at most %d characters", key, maxClientMetadataValueLength)
+		}
+	}
+
+	size := 0
+	for name, value := range req.Extensions {
+		size += len(name) + len(value)
+	}
+	if size > maxClientExtensionBytes {
+		return errors.New("unrecognized client metadata fields are too large")
+	}
+	return nil
+}
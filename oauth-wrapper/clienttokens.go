@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// What happens when a client already holds its maximum of live access tokens
+const (
+	clientTokenLimitReject      = "reject"
+	clientTokenLimitEvictOldest = "evict-oldest"
+)
+
+var supportedClientTokenLimits = []string{clientTokenLimitReject, clientTokenLimitEvictOldest}
+
+// liveClientTokens returns the client's unexpired tokens, oldest first, dropping expired ones on the way
+func (w *OAuthWrapper) liveClientTokens(clientID string) []string {
+	now := w.now()
+	type issued struct {
+		token     string
+		createdAt time.Time
+	}
+	var live []issued
+	for _, token := range w.accessTokens.ClientTokens(clientID) {
+		at, ok := w.accessTokens.Get(token)
+		if !ok {
+			continue
+		}
+		if at.expired(now, w.tokenIdleTTL, w.clockSkew) {
+			w.accessTokens.Delete(token)
+			continue
+		}
+		live = append(live, issued{token, at.CreatedAt})
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].createdAt.Before(live[j].createdAt) })
+
+	tokens := make([]string, len(live))
+	for i, l := range live {
+		tokens[i] = l.token
+	}
+	return tokens
+}
+
+// hasClientTokenCapacity reports whether the client may be issued another token. Under the
+// evict-oldest strategy it always may; the oldest tokens make room once the new one is issued.
+func (w *OAuthWrapper) hasClientTokenCapacity(clientID string) bool {
+	if w.maxTokensPerClient <= 0 || w.clientTokenLimit == clientTokenLimitEvictOldest {
+		return true
+	}
+	return len(w.liveClientTokens(clientID)) < w.maxTokensPerClient
+}
+
+// evictOldestClientTokens revokes the client's oldest tokens until it is back within its limit
+func (w *OAuthWrapper) evictOldestClientTokens(clientID string) {
+	if w.maxTokensPerClient <= 0 || w.clientTokenLimit != clientTokenLimitEvictOldest {
+		return
+	}
+	live := w.liveClientTokens(clientID)
+	excess := len(live) - w.maxTokensPerClient
+	if excess <= 0 {
+		return
+	}
+	for _, token := range live[:excess] {
+		w.accessTokens.Delete(token)
+	}
+	accessTokensGauge.Set(int64(w.accessTokens.Len()))
+	slog.Info("Evicted oldest access tokens over the per-client limit", "client_id", clientID, "count", excess, "max_tokens_per_client", w.maxTokensPerClient)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// issueToken runs the code flow for the test client and returns the new access token
+func issueToken(t *testing.T, w *OAuthWrapper) (string, error) {
+	t.Helper()
+	redirect, err := w.authorize(authorizeRequest{ClientID: "client", RedirectURI: testRedirectURI, ResponseType: "code"})
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: redirect.Query().Get("code"), ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI})
+	if err != nil {
+		return "", err
+	}
+	return resp.AccessToken, nil
+}
+
+func TestClientTokenLimitReject(t *testing.T) {
+	w := newOAuthTestWrapper(time.Now())
+	w.maxTokensPerClient, w.clientTokenLimit = 2, clientTokenLimitReject
+
+	for range 2 {
+		if _, err := issueToken(t, w); err != nil {
+			t.Fatalf("expected issuance within the limit, got %v", err)
+		}
+	}
+	_, err := issueToken(t, w)
+	wantOAuthError(t, err, http.StatusTooManyRequests, "invalid_request")
+
+	// Tokens expired by the wrapper's clock don't count against the limit
+	later := time.Now().Add(w.tokenTTL + w.clockSkew + time.Minute)
+	w.now = func() time.Time { return later }
+	if _, err := issueToken(t, w); err != nil {
+		t.Errorf("expected issuance once the old tokens expired, got %v", err)
+	}
+}
+
+func TestClientTokenLimitEvictOldest(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.maxTokensPerClient, w.clientTokenLimit = 2, clientTokenLimitEvictOldest
+
+	var tokens []string
+	for i := range 3 {
+		// Issue each token a second later than the previous one so their age is unambiguous
+		issuedAt := now.Add(time.Duration(i) * time.Second)
+		w.now = func() time.Time { return issuedAt }
+		token, err := issueToken(t, w)
+		if err != nil {
+			t.Fatalf("expected evict-oldest to always issue, got %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if _, ok := w.accessTokens.Get(tokens[0]); ok {
+		t.Error("expected the oldest token to be evicted")
+	}
+	for _, token := range tokens[1:] {
+		if _, ok := w.accessTokens.Get(token); !ok {
+			t.Error("expected the newer tokens to survive")
+		}
+	}
+
+	w.secrets.Store(&secrets{AdminToken: "admin"})
+	rec := adminRequest(w, http.MethodGet, "/admin/clients/client/sessions", nil)
+	var sessions AdminClientSessions
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if sessions.ActiveTokens != 2 {
+		t.Errorf("expected 2 active tokens in the admin view, got %d", sessions.ActiveTokens)
+	}
+}
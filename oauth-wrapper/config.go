@@ -0,0 +1,920 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the resolved wrapper configuration.
+// Each setting comes from its command-line flag when given explicitly,
+// otherwise from its environment variable, otherwise from the config file (-config),
+// otherwise from the built-in default.
+type Config struct {
+	// Env is the deployment profile: development (lenient defaults) or production, which enforces
+	// an https public URL, a registration token, https redirect URIs and expiring client secrets
+	Env string
+	// Port the wrapper listens on (-port, PORT, OAUTH_WRAPPER_PORT)
+	Port string
+	// PublicURL is where clients reach the wrapper; used as the issuer and in metadata (-public-url)
+	PublicURL string
+	// BasePath prefixes every route, and the issuer and endpoint URLs, when the wrapper is served
+	// under a subpath of a shared gateway, e.g. /oauth (-base-path)
+	BasePath string
+	// AdminAddr is an optional separate listen address for /metrics and other admin endpoints;
+	// when empty they are served on the main port
+	AdminAddr string
+	// EnablePprof serves /debug/pprof on the admin listener; requires AdminAddr
+	EnablePprof bool
+	// MCPHost and MCPPort locate the MCP server's SSE transport
+	MCPHost string
+	MCPPort string
+	// MCPURL is derived from MCPHost and MCPPort, or is the first of MCPBackends
+	MCPURL string
+	// MCPBackends lists MCP server replicas to balance new sessions across; defaults to MCPURL alone
+	MCPBackends []string
+	// LBStrategy picks the backend for a new session: round-robin or least-connections
+	LBStrategy string
+	// BackendHealthInterval is how often each backend is probed; failing ones leave the rotation
+	BackendHealthInterval time.Duration
+	// HealthPath and HealthMode control how /ready probes the MCP server
+	HealthPath string
+	HealthMode string
+	// BackendWaitTimeout is how long to poll the MCP server's health at startup (0 = don't wait),
+	// every BackendWaitInterval
+	BackendWaitTimeout  time.Duration
+	BackendWaitInterval time.Duration
+	// SSEReadyWait holds SSE requests arriving while no backend is ready for up to this long,
+	// instead of failing them (0 = don't hold)
+	SSEReadyWait time.Duration
+	// ProtocolVersions restricts the MCP-Protocol-Version clients may send; empty passes any through
+	ProtocolVersions []string
+	// SessionAffinityTTL forgets which backend holds an MCP session after this long without requests
+	SessionAffinityTTL time.Duration
+	// ProxyRetries retries an SSE connection refused by the MCP server, backing off from
+	// ProxyRetryBackoff and doubling each time (0 = no retries)
+	ProxyRetries      int
+	ProxyRetryBackoff time.Duration
+	// MessageRetries retries an MCP message whose connection to the MCP server could not be made,
+	// backing off from MessageRetryBackoff and doubling each time (0 = no retries)
+	MessageRetries      int
+	MessageRetryBackoff time.Duration
+	// SlackToken is the Slack user OAuth token (xoxp-); it takes precedence over SlackBotToken
+	SlackToken string
+	// SlackBotToken is the Slack bot token (xoxb-); at least one of the two is required unless
+	// SlackTokenCommand is set
+	SlackBotToken string
+	// SlackTokenCommand prints the Slack token, for tokens kept in a secret manager; it is run again
+	// at most every SlackTokenRefresh and takes the place of SlackToken and SlackBotToken
+	SlackTokenCommand string
+	SlackTokenRefresh time.Duration
+	// SSEAPIKey is sent to the MCP server as a Bearer token, if set
+	SSEAPIKey string
+	// RegistrationToken is the initial access token required by /register; empty means open registration
+	RegistrationToken string
+	// StaticClientsFile declares clients registered at startup, in the client export format
+	StaticClientsFile string
+	// RegistrationWebhook receives a JSON notice of every new client registration; loaded like a
+	// secret since webhook URLs often embed one
+	RegistrationWebhook string
+	// NotifyChannel is the Slack channel told about client registrations and token revocations
+	NotifyChannel string
+	// AdminToken is the Bearer token required by /admin/* endpoints; empty disables them
+	AdminToken string
+	// StatelessCodes seals authorization codes with CodeKey instead of storing them, so any replica
+	// sharing the key can redeem them
+	StatelessCodes bool
+	CodeKey        string
+	// ClientSecretTTL is how long issued client secrets stay valid (0 = forever; production defaults to 90 days)
+	ClientSecretTTL time.Duration
+	// TokenTTL is the lifetime of issued access tokens, a hard cap even when they are in use
+	TokenTTL time.Duration
+	// TokenPrefix starts every issued access token (followed by at_) so leaked tokens are easy to scan for
+	TokenPrefix string
+	// CodeLength, TokenLength and SecretLength are the random characters in authorization codes,
+	// tokens (after the prefix) and client secrets; each carries 6 bits of entropy
+	CodeLength   int
+	TokenLength  int
+	SecretLength int
+	// TokenIdleTTL expires tokens unused for this long, sliding with each use (0 = disabled)
+	TokenIdleTTL time.Duration
+	// MinTTL and MaxTTL bound the token, token idle and client secret TTLs, so a typo like 24s or
+	// 24000h fails at startup instead of issuing credentials that are useless or never expire
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// SSERequiredScope is the scope an access token needs to open /sse (empty = any token)
+	SSERequiredScope string
+	// ClockSkew still accepts tokens and codes this long past their expiry, for clients whose clocks run behind
+	ClockSkew time.Duration
+	// MaxSSEPerToken caps concurrent SSE streams per access token (0 = unlimited)
+	MaxSSEPerToken int
+	// MaxBackendConnections caps proxied SSE streams across all tokens (0 = unlimited)
+	MaxBackendConnections int
+	// SSEIdleTimeout closes SSE streams with no traffic in either direction (0 = never)
+	SSEIdleTimeout time.Duration
+	// SSEHeartbeatInterval injects an SSE comment into streams with no events for this long (0 = never)
+	SSEHeartbeatInterval time.Duration
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout configure the listeners' http.Server
+	// (0 = no limit). Proxied MCP streams are exempt; messages keep the read timeout for their upload.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// MaxClients and MaxTokens cap in-memory state (0 = unlimited)
+	MaxClients int
+	MaxTokens  int
+	// MaxTokensPerClient caps live access tokens per client (0 = unlimited); ClientTokenLimit says
+	// whether issuance past it is rejected or evicts the client's oldest token
+	MaxTokensPerClient int
+	ClientTokenLimit   string
+	// MaxBodyBytes caps request bodies on JSON and form endpoints
+	MaxBodyBytes int64
+	// MaxMessageBytes caps MCP message bodies proxied to the backend on /message and /mcp
+	MaxMessageBytes int64
+	// Resources lists the RFC 8707 resource URIs tokens may be issued for
+	Resources []string
+	// TokenAudience lists the audiences tokens are issued for unless resource indicators narrow them;
+	// the proxy accepts tokens for the first
+	TokenAudience []string
+	// OIDC advertises OpenID Connect fields in the discovery document
+	OIDC bool
+	// BindTokenOrigin rejects /sse requests whose Origin differs from the token's redirect URI origin
+	BindTokenOrigin bool
+	// DPoP binds tokens requested with a DPoP proof to the proof's key (RFC 9449); other tokens stay bearer tokens
+	DPoP bool
+	// ContentSecurityPolicy and ReferrerPolicy are sent with HTML responses; empty omits the header
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+	// RedirectURIMatch is "exact" (the default) or "prefix", which also accepts redirect URIs below
+	// a registered one on the same scheme and host
+	RedirectURIMatch string
+	// AllowedRedirectHosts restricts the hosts of registered redirect URIs to these exact hosts and
+	// "*.example.com" subdomain wildcards; empty allows any host
+	AllowedRedirectHosts []string
+	// TrustProxy takes the client IP from X-Forwarded-For, counting TrustedProxyHops proxies
+	// in front of the wrapper; otherwise the header is ignored
+	TrustProxy       bool
+	TrustedProxyHops int
+	// RequireHTTPS refuses requests that didn't arrive over HTTPS, going by X-Forwarded-Proto from
+	// trusted proxies when the wrapper doesn't terminate TLS itself; requires TrustProxy then
+	RequireHTTPS bool
+	// TLSCertFile and TLSKeyFile make the wrapper serve HTTPS itself. TLSClientCAFile turns on
+	// mTLS: clients may present a certificate, which must chain to one of these CAs.
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	// CertBoundTokens binds tokens issued to a client that presented a certificate at /token to
+	// that certificate (RFC 8705), which /sse then requires; needs TLSClientCAFile
+	CertBoundTokens bool
+	// CallbackMode is how the unused /oauth/callback answers: "echo" (default) reports the state and
+	// parameters it received, "not-found" and "not-implemented" refuse with 404 or 501
+	CallbackMode string
+	// ExpectedTeamID is the Slack team the token must belong to (checked with auth.test) before
+	// anything is proxied; TeamCheckInterval re-checks it periodically, 0 only at startup
+	ExpectedTeamID    string
+	TeamCheckInterval time.Duration
+	// RequireEntropyAudit refuses to start when generated tokens fail the startup entropy audit,
+	// instead of only logging a warning
+	RequireEntropyAudit bool
+	// SlowRequestThreshold logs a warning for requests that take at least this long; event streams
+	// are exempt. 0 disables the log.
+	SlowRequestThreshold time.Duration
+	// LandingPage serves a page at / naming the service and linking its public endpoints, with
+	// LandingTitle as the name and an optional LandingMessage; off, / is a 404
+	LandingPage    bool
+	LandingTitle   string
+	LandingMessage string
+	// EnabledGrants limits the grant types /token accepts and the metadata advertises to a subset
+	// of the supported ones; empty enables them all
+	EnabledGrants []string
+
+	// CheckConfig validates the configuration and exits instead of serving; CheckBackends also
+	// requires every MCP backend to pass its health check. Both are command-line only.
+	CheckConfig   bool
+	CheckBackends bool
+	// SelfTest runs the OAuth flow against a stub MCP server and exits instead of serving; also
+	// command-line only
+	SelfTest bool
+}
+
+// LogValue renders the configuration with secrets redacted
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("port", c.Port),
+		slog.String("env", c.Env),
+		slog.String("public_url", c.PublicURL),
+		slog.String("base_path", c.BasePath),
+		slog.String("admin_addr", c.AdminAddr),
+		slog.Bool("enable_pprof", c.EnablePprof),
+		slog.String("mcp_url", c.MCPURL),
+		slog.Any("mcp_backends", c.MCPBackends),
+		slog.String("lb_strategy", c.LBStrategy),
+		slog.Duration("backend_health_interval", c.BackendHealthInterval),
+		slog.String("health_path", c.HealthPath),
+		slog.String("health_mode", c.HealthMode),
+		slog.Duration("backend_wait_timeout", c.BackendWaitTimeout),
+		slog.Duration("backend_wait_interval", c.BackendWaitInterval),
+		slog.Duration("sse_ready_wait", c.SSEReadyWait),
+		slog.Any("protocol_versions", c.ProtocolVersions),
+		slog.Duration("session_affinity_ttl", c.SessionAffinityTTL),
+		slog.Int("proxy_retries", c.ProxyRetries),
+		slog.Duration("proxy_retry_backoff", c.ProxyRetryBackoff),
+		slog.Int("message_retries", c.MessageRetries),
+		slog.Duration("message_retry_backoff", c.MessageRetryBackoff),
+		slog.String("slack_token", redact(c.SlackToken)),
+		slog.String("slack_bot_token", redact(c.SlackBotToken)),
+		slog.String("slack_token_command", redact(c.SlackTokenCommand)),
+		slog.Duration("slack_token_refresh", c.SlackTokenRefresh),
+		slog.String("sse_api_key", redact(c.SSEAPIKey)),
+		slog.String("registration_token", redact(c.RegistrationToken)),
+		slog.String("static_clients_file", c.StaticClientsFile),
+		slog.String("registration_webhook", redact(c.RegistrationWebhook)),
+		slog.String("notify_channel", c.NotifyChannel),
+		slog.String("admin_token", redact(c.AdminToken)),
+		slog.Bool("stateless_codes", c.StatelessCodes),
+		slog.String("code_key", redact(c.CodeKey)),
+		slog.Duration("client_secret_ttl", c.ClientSecretTTL),
+		slog.Duration("token_ttl", c.TokenTTL),
+		slog.Duration("token_idle_ttl", c.TokenIdleTTL),
+		slog.Duration("min_ttl", c.MinTTL),
+		slog.Duration("max_ttl", c.MaxTTL),
+		slog.Duration("clock_skew", c.ClockSkew),
+		slog.String("sse_required_scope", c.SSERequiredScope),
+		slog.String("token_prefix", c.TokenPrefix),
+		slog.Int("code_length", c.CodeLength),
+		slog.Int("token_length", c.TokenLength),
+		slog.Int("secret_length", c.SecretLength),
+		slog.Int("max_sse_per_token", c.MaxSSEPerToken),
+		slog.Int("max_backend_connections", c.MaxBackendConnections),
+		slog.Duration("sse_idle_timeout", c.SSEIdleTimeout),
+		slog.Duration("sse_heartbeat_interval", c.SSEHeartbeatInterval),
+		slog.Duration("read_header_timeout", c.ReadHeaderTimeout),
+		slog.Duration("read_timeout", c.ReadTimeout),
+		slog.Duration("write_timeout", c.WriteTimeout),
+		slog.Duration("idle_timeout", c.IdleTimeout),
+		slog.Int("max_clients", c.MaxClients),
+		slog.Int("max_tokens", c.MaxTokens),
+		slog.Int("max_tokens_per_client", c.MaxTokensPerClient),
+		slog.String("client_token_limit", c.ClientTokenLimit),
+		slog.Int64("max_body_bytes", c.MaxBodyBytes),
+		slog.Int64("max_message_bytes", c.MaxMessageBytes),
+		slog.Any("resources", c.Resources),
+		slog.Any("token_audience", c.TokenAudience),
+		slog.Bool("oidc", c.OIDC),
+		slog.Bool("bind_token_origin", c.BindTokenOrigin),
+		slog.Bool("dpop", c.DPoP),
+		slog.String("content_security_policy", c.ContentSecurityPolicy),
+		slog.String("referrer_policy", c.ReferrerPolicy),
+		slog.String("redirect_uri_match", c.RedirectURIMatch),
+		slog.Any("allowed_redirect_hosts", c.AllowedRedirectHosts),
+		slog.Bool("trust_proxy", c.TrustProxy),
+		slog.Bool("require_https", c.RequireHTTPS),
+		slog.String("tls_cert_file", c.TLSCertFile),
+		slog.String("tls_key_file", c.TLSKeyFile),
+		slog.String("tls_client_ca_file", c.TLSClientCAFile),
+		slog.Bool("cert_bound_tokens", c.CertBoundTokens),
+		slog.String("callback_mode", c.CallbackMode),
+		slog.String("expected_team_id", c.ExpectedTeamID),
+		slog.Duration("team_check_interval", c.TeamCheckInterval),
+		slog.Bool("require_entropy_audit", c.RequireEntropyAudit),
+		slog.Duration("slow_request_threshold", c.SlowRequestThreshold),
+		slog.Bool("landing_page", c.LandingPage),
+		slog.String("landing_title", c.LandingTitle),
+		slog.String("landing_message", c.LandingMessage),
+		slog.Any("enabled_grants", c.EnabledGrants),
+		slog.Int("trusted_proxy_hops", c.TrustedProxyHops),
+	)
+}
+
+// Slack token types, by the variable they came from
+const (
+	slackTokenUser = "user"
+	slackTokenBot  = "bot"
+)
+
+// SlackCredential returns the Slack token in effect and its type. A user token wins over a bot
+// token because the MCP server's search and history tools need user scopes.
+func (c *Config) SlackCredential() (token, tokenType string) {
+	if c.SlackToken != "" {
+		return c.SlackToken, slackTokenUser
+	}
+	return c.SlackBotToken, slackTokenBot
+}
+
+// loadConfig resolves the configuration from command-line arguments and the environment
+func loadConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	l := newConfigLoader("oauth-wrapper")
+
+	l.fs.BoolVar(&cfg.CheckConfig, "check-config", false, "Validate the configuration, print a redacted summary and exit (non-zero on errors) without serving")
+	l.fs.BoolVar(&cfg.CheckBackends, "check-backends", false, "With -check-config, also fail unless every MCP backend passes its health check")
+	l.fs.BoolVar(&cfg.SelfTest, "selftest", false, "Run register, authorize, token and /sse against a stub MCP server, report each step and exit (non-zero on failure) without serving")
+	l.stringVar(&cfg.Port, "port", "8080", "Port to listen on", "PORT", "OAUTH_WRAPPER_PORT")
+	l.stringVar(&cfg.Env, "env", envDevelopment, "Deployment profile: development, or production to enforce safe settings", "SLACK_MCP_OAUTH_ENV")
+	l.stringVar(&cfg.PublicURL, "public-url", "", "Public URL where the wrapper is reachable", "OAUTH_WRAPPER_PUBLIC_URL", "RUNWAY_APP_URL")
+	l.stringVar(&cfg.BasePath, "base-path", "", "Path prefix for all routes when served under a subpath, e.g. /oauth (default: none)", "SLACK_MCP_OAUTH_BASE_PATH")
+	l.stringVar(&cfg.AdminAddr, "admin-addr", "", "Separate listen address (e.g. 127.0.0.1:9090) for metrics and admin endpoints", "SLACK_MCP_OAUTH_ADMIN_ADDR")
+	l.boolVar(&cfg.EnablePprof, "enable-pprof", false, "Serve /debug/pprof on the admin listener (requires -admin-addr)", "SLACK_MCP_OAUTH_ENABLE_PPROF")
+	l.stringVar(&cfg.MCPHost, "mcp-host", "127.0.0.1", "MCP server host", "SLACK_MCP_HOST")
+	l.stringVar(&cfg.MCPPort, "mcp-port", "13080", "MCP server port", "SLACK_MCP_PORT")
+	l.stringSliceVar(&cfg.MCPBackends, "mcp-backends", "Comma-separated MCP server URLs to load balance across (overrides -mcp-host and -mcp-port)", "SLACK_MCP_OAUTH_MCP_BACKENDS")
+	l.stringVar(&cfg.LBStrategy, "lb-strategy", lbRoundRobin, "How new sessions are spread across MCP backends: round-robin or least-connections", "SLACK_MCP_OAUTH_LB_STRATEGY")
+	l.durationVar(&cfg.BackendHealthInterval, "backend-health-interval", 10*time.Second, "How often MCP backends are health checked", "SLACK_MCP_OAUTH_BACKEND_HEALTH_INTERVAL")
+	l.stringVar(&cfg.HealthPath, "health-path", "/health", "MCP server path used for health checks", "SLACK_MCP_HEALTH_PATH")
+	l.stringVar(&cfg.HealthMode, "health-mode", healthModeHTTP, "MCP health check mode: http (GET, expect 200) or jsonrpc (POST an MCP ping)", "SLACK_MCP_HEALTH_MODE")
+	l.durationVar(&cfg.BackendWaitTimeout, "backend-wait-timeout", 30*time.Second, "How long to wait for the MCP server to pass its health check at startup (0 = don't wait)", "SLACK_MCP_OAUTH_BACKEND_WAIT_TIMEOUT")
+	l.durationVar(&cfg.BackendWaitInterval, "backend-wait-interval", 500*time.Millisecond, "Initial interval between MCP server health checks while waiting for it, backing off up to 5s", "SLACK_MCP_OAUTH_BACKEND_WAIT_INTERVAL")
+	l.durationVar(&cfg.SSEReadyWait, "sse-ready-wait", 0, "How long an SSE request waits for the MCP server to be ready before failing with 503 (0 = don't wait)", "SLACK_MCP_OAUTH_SSE_READY_WAIT")
+	l.stringSliceVar(&cfg.ProtocolVersions, "protocol-versions", "Comma-separated MCP protocol versions clients may request via MCP-Protocol-Version (default: any)", "SLACK_MCP_OAUTH_PROTOCOL_VERSIONS")
+	l.durationVar(&cfg.SessionAffinityTTL, "session-affinity-ttl", 30*time.Minute, "How long an idle MCP session stays pinned to its backend", "SLACK_MCP_OAUTH_SESSION_AFFINITY_TTL")
+	l.intVar(&cfg.ProxyRetries, "proxy-retries", 2, "Retries for an SSE connection refused by the MCP server (0 = none)", "SLACK_MCP_OAUTH_PROXY_RETRIES")
+	l.durationVar(&cfg.ProxyRetryBackoff, "proxy-retry-backoff", 200*time.Millisecond, "Initial delay between SSE connection retries, doubled each attempt", "SLACK_MCP_OAUTH_PROXY_RETRY_BACKOFF")
+	l.intVar(&cfg.MessageRetries, "message-retries", 1, "Retries for an MCP message when the MCP server can't be connected to, before any of it is sent (0 = none)", "SLACK_MCP_OAUTH_MESSAGE_RETRIES")
+	l.durationVar(&cfg.MessageRetryBackoff, "message-retry-backoff", 100*time.Millisecond, "Initial delay between MCP message retries, doubled each attempt", "SLACK_MCP_OAUTH_MESSAGE_RETRY_BACKOFF")
+	l.secretVar(&cfg.SlackToken, "slack-token", "Slack user OAuth token (xoxp-)", "SLACK_MCP_XOXP_TOKEN")
+	l.secretVar(&cfg.SlackBotToken, "slack-bot-token", "Slack bot token (xoxb-), used when no user token is set", "SLACK_MCP_XOXB_TOKEN")
+	l.stringVar(&cfg.SlackTokenCommand, "slack-token-command", "", "Shell command printing the Slack token, used instead of -slack-token / -slack-bot-token", "SLACK_MCP_OAUTH_SLACK_TOKEN_COMMAND")
+	l.durationVar(&cfg.SlackTokenRefresh, "slack-token-refresh", 5*time.Minute, "How long a token from -slack-token-command is reused before the command runs again", "SLACK_MCP_OAUTH_SLACK_TOKEN_REFRESH")
+	l.secretVar(&cfg.SSEAPIKey, "sse-api-key", "API key sent to the MCP server's SSE transport", "SLACK_MCP_SSE_API_KEY")
+	l.secretVar(&cfg.RegistrationToken, "registration-token", "Initial access token required for client registration", "SLACK_MCP_OAUTH_REGISTRATION_TOKEN")
+	l.stringVar(&cfg.StaticClientsFile, "static-clients-file", "", "JSON file of clients to register at startup, in the /admin/clients/export format; client_secret may be given in plain text", "SLACK_MCP_OAUTH_STATIC_CLIENTS_FILE")
+	l.secretVar(&cfg.RegistrationWebhook, "registration-webhook", "URL notified with a JSON POST whenever a client registers", "SLACK_MCP_OAUTH_REGISTRATION_WEBHOOK")
+	l.stringVar(&cfg.NotifyChannel, "notify-channel", "", "Slack channel ID or name to post client registrations and token revocations to", "SLACK_MCP_OAUTH_NOTIFY_CHANNEL")
+	l.secretVar(&cfg.AdminToken, "admin-token", "Bearer token required for /admin endpoints (unset disables them)", "SLACK_MCP_OAUTH_ADMIN_TOKEN")
+	l.boolVar(&cfg.StatelessCodes, "stateless-codes", false, "Encrypt authorization codes with -code-key instead of storing them, so replicas sharing the key can redeem each other's codes", "SLACK_MCP_OAUTH_STATELESS_CODES")
+	l.secretVar(&cfg.CodeKey, "code-key", "Key that seals stateless authorization codes, at least 32 characters and the same on every replica", "SLACK_MCP_OAUTH_CODE_KEY")
+	l.durationVar(&cfg.ClientSecretTTL, "client-secret-ttl", 0, "Lifetime of issued client secrets (0 = never expire; production defaults to 90 days)", "SLACK_MCP_OAUTH_CLIENT_SECRET_TTL")
+	l.durationVar(&cfg.TokenTTL, "token-ttl", 24*time.Hour, "Lifetime of issued access tokens", "SLACK_MCP_OAUTH_TOKEN_TTL")
+	l.intVar(&cfg.CodeLength, "code-length", defaultCodeLength, "Random characters in authorization codes", "SLACK_MCP_OAUTH_CODE_LENGTH")
+	l.intVar(&cfg.TokenLength, "token-length", defaultTokenLength, "Random characters in issued tokens, after the prefix", "SLACK_MCP_OAUTH_TOKEN_LENGTH")
+	l.intVar(&cfg.SecretLength, "secret-length", defaultSecretLength, "Random characters in client secrets", "SLACK_MCP_OAUTH_SECRET_LENGTH")
+	l.stringVar(&cfg.TokenPrefix, "token-prefix", "slkmcp_", "Prefix for issued access tokens, followed by at_", "SLACK_MCP_OAUTH_TOKEN_PREFIX")
+	l.durationVar(&cfg.TokenIdleTTL, "token-idle-ttl", 0, "Expire access tokens unused for this long; each use extends it up to -token-ttl (0 = disabled)", "SLACK_MCP_OAUTH_TOKEN_IDLE_TTL")
+	l.durationVar(&cfg.MinTTL, "min-ttl", time.Minute, "Shortest token, token idle or client secret TTL accepted", "SLACK_MCP_OAUTH_MIN_TTL")
+	l.durationVar(&cfg.MaxTTL, "max-ttl", 365*24*time.Hour, "Longest token, token idle or client secret TTL accepted", "SLACK_MCP_OAUTH_MAX_TTL")
+	l.stringVar(&cfg.SSERequiredScope, "sse-required-scope", "", "Scope an access token must have been granted to open /sse, e.g. mcp:stream (empty = any token)", "SLACK_MCP_OAUTH_SSE_REQUIRED_SCOPE")
+	l.durationVar(&cfg.ClockSkew, "clock-skew", defaultClockSkew, "Keep accepting access tokens and authorization codes this long after they expire, to tolerate client clock skew", "SLACK_MCP_OAUTH_CLOCK_SKEW")
+	l.intVar(&cfg.MaxSSEPerToken, "max-sse-per-token", 0, "Max concurrent SSE connections per access token (0 = unlimited)", "SLACK_MCP_OAUTH_MAX_SSE_PER_TOKEN")
+	l.intVar(&cfg.MaxBackendConnections, "max-backend-connections", 0, "Max concurrent proxied SSE connections across all tokens; more get 503 (0 = unlimited)", "SLACK_MCP_OAUTH_MAX_BACKEND_CONNECTIONS")
+	l.durationVar(&cfg.SSEIdleTimeout, "sse-idle-timeout", 0, "Close a proxied SSE connection after this long with no traffic in either direction (0 = never)", "SLACK_MCP_OAUTH_SSE_IDLE_TIMEOUT")
+	l.durationVar(&cfg.SSEHeartbeatInterval, "sse-heartbeat-interval", 0, "Send an SSE comment heartbeat on a proxied stream after this long without events, so intermediaries keep it open (0 = never)", "SLACK_MCP_OAUTH_SSE_HEARTBEAT_INTERVAL")
+	l.durationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", 10*time.Second, "Max time to read a request's headers (0 = no limit)", "SLACK_MCP_OAUTH_READ_HEADER_TIMEOUT")
+	l.durationVar(&cfg.ReadTimeout, "read-timeout", 30*time.Second, "Max time to read a whole request; proxied MCP streams are exempt (0 = no limit)", "SLACK_MCP_OAUTH_READ_TIMEOUT")
+	l.durationVar(&cfg.WriteTimeout, "write-timeout", 30*time.Second, "Max time to write a response; proxied MCP requests are exempt (0 = no limit)", "SLACK_MCP_OAUTH_WRITE_TIMEOUT")
+	l.durationVar(&cfg.IdleTimeout, "idle-timeout", 2*time.Minute, "Close keep-alive connections idle between requests for this long (0 = no limit)", "SLACK_MCP_OAUTH_IDLE_TIMEOUT")
+	l.intVar(&cfg.MaxClients, "max-clients", 10000, "Max registered clients held in memory (0 = unlimited)", "SLACK_MCP_OAUTH_MAX_CLIENTS")
+	l.intVar(&cfg.MaxTokens, "max-tokens", 100000, "Max access tokens held in memory (0 = unlimited)", "SLACK_MCP_OAUTH_MAX_TOKENS")
+	l.intVar(&cfg.MaxTokensPerClient, "max-tokens-per-client", 0, "Max live access tokens per client (0 = unlimited)", "SLACK_MCP_OAUTH_MAX_TOKENS_PER_CLIENT")
+	l.stringVar(&cfg.ClientTokenLimit, "client-token-limit", clientTokenLimitReject, "What a client past -max-tokens-per-client gets: reject (an error) or evict-oldest (its oldest token is revoked)", "SLACK_MCP_OAUTH_CLIENT_TOKEN_LIMIT")
+	l.int64Var(&cfg.MaxBodyBytes, "max-body-bytes", 8<<10, "Max request body size for JSON and form endpoints", "SLACK_MCP_OAUTH_MAX_BODY_BYTES")
+	l.int64Var(&cfg.MaxMessageBytes, "max-message-bytes", 4<<20, "Max MCP message body size proxied on /message and /mcp; larger ones get 413", "SLACK_MCP_OAUTH_MAX_MESSAGE_BYTES")
+	l.stringSliceVar(&cfg.Resources, "resources", "Comma-separated resource URIs (RFC 8707) clients may request tokens for", "SLACK_MCP_OAUTH_RESOURCES")
+	l.stringSliceVar(&cfg.TokenAudience, "token-audience", "Comma-separated audience URIs issued tokens carry; clients may narrow them with resource=, and the proxy accepts tokens for the first", "SLACK_MCP_OAUTH_TOKEN_AUDIENCE")
+	l.boolVar(&cfg.OIDC, "oidc", false, "Advertise OpenID Connect fields in /.well-known/openid-configuration", "SLACK_MCP_OAUTH_OIDC")
+	l.stringVar(&cfg.ContentSecurityPolicy, "content-security-policy", defaultContentSecurityPolicy, "Content-Security-Policy header for HTML responses (empty = don't send)", "SLACK_MCP_OAUTH_CONTENT_SECURITY_POLICY")
+	l.stringVar(&cfg.ReferrerPolicy, "referrer-policy", defaultReferrerPolicy, "Referrer-Policy header for HTML responses (empty = don't send)", "SLACK_MCP_OAUTH_REFERRER_POLICY")
+	l.stringVar(&cfg.RedirectURIMatch, "redirect-uri-match", redirectMatchExact, "How redirect_uri is matched against registered URIs: exact, or prefix to allow paths below them on the same scheme and host", "SLACK_MCP_OAUTH_REDIRECT_URI_MATCH")
+	l.stringSliceVar(&cfg.AllowedRedirectHosts, "allowed-redirect-hosts", "Comma-separated hosts clients may register redirect URIs on, e.g. claude.ai,*.example.com (default: any)", "SLACK_MCP_OAUTH_ALLOWED_REDIRECT_HOSTS")
+	l.boolVar(&cfg.TrustProxy, "trust-proxy", false, "Take the client IP from X-Forwarded-For; only enable behind a proxy that sets it", "SLACK_MCP_OAUTH_TRUST_PROXY")
+	l.boolVar(&cfg.RequireHTTPS, "require-https", false, "Redirect browser endpoints to HTTPS and reject other plain HTTP requests, going by X-Forwarded-Proto (requires -trust-proxy unless -tls-cert-file is set)", "SLACK_MCP_OAUTH_REQUIRE_HTTPS")
+	l.stringVar(&cfg.TLSCertFile, "tls-cert-file", "", "PEM certificate (chain) to serve HTTPS with; requires -tls-key-file (default: plain HTTP)", "SLACK_MCP_OAUTH_TLS_CERT_FILE")
+	l.stringVar(&cfg.TLSKeyFile, "tls-key-file", "", "PEM private key for -tls-cert-file", "SLACK_MCP_OAUTH_TLS_KEY_FILE")
+	l.stringVar(&cfg.TLSClientCAFile, "tls-client-ca-file", "", "PEM CA certificates that verify TLS client certificates (mTLS); clients without one are still served", "SLACK_MCP_OAUTH_TLS_CLIENT_CA_FILE")
+	l.boolVar(&cfg.CertBoundTokens, "cert-bound-tokens", false, "Bind tokens to the TLS client certificate presented at /token and require it on /sse (RFC 8705; requires -tls-client-ca-file)", "SLACK_MCP_OAUTH_CERT_BOUND_TOKENS")
+	l.stringVar(&cfg.CallbackMode, "callback-mode", callbackModeEcho, "How the unused /oauth/callback answers: echo (report what it received), not-found or not-implemented", "SLACK_MCP_OAUTH_CALLBACK_MODE")
+	l.stringVar(&cfg.ExpectedTeamID, "expected-team-id", "", "Slack team ID the token must belong to; /sse and /ready fail until auth.test confirms it (default: not checked)", "SLACK_MCP_EXPECTED_TEAM_ID")
+	l.durationVar(&cfg.TeamCheckInterval, "team-check-interval", 0, "How often to re-check the Slack token's team with -expected-team-id (0 = only at startup)", "SLACK_MCP_OAUTH_TEAM_CHECK_INTERVAL")
+	l.boolVar(&cfg.RequireEntropyAudit, "require-entropy-audit", false, "Refuse to start, rather than warn, when generated tokens fail the startup entropy audit", "SLACK_MCP_OAUTH_REQUIRE_ENTROPY_AUDIT")
+	l.durationVar(&cfg.SlowRequestThreshold, "slow-request-threshold", 2*time.Second, "Log a warning for requests taking at least this long, event streams excepted (0 = never)", "SLACK_MCP_OAUTH_SLOW_REQUEST_THRESHOLD")
+	l.boolVar(&cfg.LandingPage, "landing-page", true, "Serve a landing page at / with the service name, version and links to the public endpoints (off = 404)", "SLACK_MCP_OAUTH_LANDING_PAGE")
+	l.stringVar(&cfg.LandingTitle, "landing-title", defaultLandingTitle, "Service name shown on the landing page", "SLACK_MCP_OAUTH_LANDING_TITLE")
+	l.stringVar(&cfg.LandingMessage, "landing-message", "", "Optional message shown on the landing page, e.g. who to contact about this deployment", "SLACK_MCP_OAUTH_LANDING_MESSAGE")
+	l.stringSliceVar(&cfg.EnabledGrants, "enabled-grants", "Comma-separated grant types /token accepts, e.g. authorization_code (default: every supported grant)", "SLACK_MCP_OAUTH_ENABLED_GRANTS")
+	l.intVar(&cfg.TrustedProxyHops, "trusted-proxy-hops", 1, "Number of trusted proxies in front of the wrapper that append to X-Forwarded-For", "SLACK_MCP_OAUTH_TRUSTED_PROXY_HOPS")
+	l.boolVar(&cfg.BindTokenOrigin, "bind-token-origin", false, "Reject /sse requests whose Origin header differs from the origin of the redirect URI the token was issued through", "SLACK_MCP_OAUTH_BIND_TOKEN_ORIGIN")
+	l.boolVar(&cfg.DPoP, "dpop", false, "Bind tokens requested with a DPoP proof to the proof's key and require a matching proof on /sse", "SLACK_MCP_OAUTH_DPOP")
+
+	if err := l.parse(args); err != nil {
+		return nil, err
+	}
+
+	// Validate everything so a bad deployment reports every problem at once
+	var errs []error
+	errs = append(errs, l.errs...)
+
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = "http://localhost:" + cfg.Port
+	}
+	if cfg.BasePath != "" && !validBasePath(cfg.BasePath) {
+		errs = append(errs, fmt.Errorf("base path %q must start with / and contain only plain path segments, without a trailing /", cfg.BasePath))
+	}
+
+	if cfg.AdminAddr != "" {
+		if _, port, err := net.SplitHostPort(cfg.AdminAddr); err != nil {
+			errs = append(errs, fmt.Errorf("admin address %q must be host:port: %w", cfg.AdminAddr, err))
+		} else if port == cfg.Port {
+			errs = append(errs, fmt.Errorf("admin address %q must not use the main port %s", cfg.AdminAddr, cfg.Port))
+		}
+	}
+
+	if cfg.EnablePprof && cfg.AdminAddr == "" {
+		errs = append(errs, fmt.Errorf("pprof is only served on the admin listener; set SLACK_MCP_OAUTH_ADMIN_ADDR to enable it"))
+	}
+
+	switch {
+	case cfg.SlackToken == "" && cfg.SlackBotToken == "" && cfg.SlackTokenCommand == "":
+		errs = append(errs, fmt.Errorf("a Slack token is required: set SLACK_MCP_XOXP_TOKEN (user) or SLACK_MCP_XOXB_TOKEN (bot), their _FILE variants, -slack-token / -slack-bot-token, or SLACK_MCP_OAUTH_SLACK_TOKEN_COMMAND"))
+	case strings.HasPrefix(cfg.SlackToken, "xoxb-"):
+		errs = append(errs, fmt.Errorf("SLACK_MCP_XOXP_TOKEN holds a bot token; set it as SLACK_MCP_XOXB_TOKEN instead"))
+	case cfg.SlackBotToken != "" && !strings.HasPrefix(cfg.SlackBotToken, "xoxb-"):
+		errs = append(errs, fmt.Errorf("SLACK_MCP_XOXB_TOKEN must be a bot token starting with xoxb-"))
+	}
+
+	if len(cfg.MCPBackends) == 0 {
+		cfg.MCPURL = fmt.Sprintf("http://%s:%s", cfg.MCPHost, cfg.MCPPort)
+		if _, err := url.Parse(cfg.MCPURL); err != nil {
+			errs = append(errs, fmt.Errorf("invalid MCP server URL %q (check SLACK_MCP_HOST and SLACK_MCP_PORT): %w", cfg.MCPURL, err))
+		}
+		cfg.MCPBackends = []string{cfg.MCPURL}
+	} else {
+		for i, backend := range cfg.MCPBackends {
+			u, err := url.Parse(backend)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("MCP backend %q must be an http(s) URL", backend))
+				continue
+			}
+			cfg.MCPBackends[i] = strings.TrimSuffix(backend, "/")
+		}
+		cfg.MCPURL = cfg.MCPBackends[0]
+	}
+	if cfg.StatelessCodes && len(cfg.CodeKey) < minCodeKeyLength {
+		errs = append(errs, fmt.Errorf("stateless codes need a code key (SLACK_MCP_OAUTH_CODE_KEY) of at least %d characters", minCodeKeyLength))
+	}
+	if cfg.MaxBackendConnections < 0 {
+		errs = append(errs, fmt.Errorf("max backend connections must not be negative, got %d", cfg.MaxBackendConnections))
+	}
+	if cfg.MaxTokensPerClient < 0 {
+		errs = append(errs, fmt.Errorf("max tokens per client must not be negative, got %d", cfg.MaxTokensPerClient))
+	}
+	if !slices.Contains(supportedClientTokenLimits, cfg.ClientTokenLimit) {
+		errs = append(errs, fmt.Errorf("client token limit %q must be one of %s", cfg.ClientTokenLimit, strings.Join(supportedClientTokenLimits, ", ")))
+	}
+	if !slices.Contains(supportedLBStrategies, cfg.LBStrategy) {
+		errs = append(errs, fmt.Errorf("load balancing strategy %q must be one of %s", cfg.LBStrategy, strings.Join(supportedLBStrategies, ", ")))
+	}
+	if cfg.BackendHealthInterval <= 0 {
+		errs = append(errs, fmt.Errorf("backend health interval must be positive, got %s", cfg.BackendHealthInterval))
+	}
+	if cfg.SlackTokenRefresh <= 0 {
+		errs = append(errs, fmt.Errorf("slack token refresh must be positive, got %s", cfg.SlackTokenRefresh))
+	}
+
+	if !strings.HasPrefix(cfg.HealthPath, "/") {
+		errs = append(errs, fmt.Errorf("health path %q must start with /", cfg.HealthPath))
+	}
+	if cfg.TeamCheckInterval < 0 {
+		errs = append(errs, fmt.Errorf("team check interval must not be negative, got %s", cfg.TeamCheckInterval))
+	}
+	for _, grantType := range cfg.EnabledGrants {
+		if !slices.Contains(supportedGrantTypes, grantType) {
+			errs = append(errs, fmt.Errorf("enabled grant %q must be one of %s", grantType, strings.Join(supportedGrantTypes, ", ")))
+		}
+	}
+	if cfg.SlowRequestThreshold < 0 {
+		errs = append(errs, fmt.Errorf("slow request threshold must not be negative, got %s", cfg.SlowRequestThreshold))
+	}
+	if !slices.Contains(supportedCallbackModes, cfg.CallbackMode) {
+		errs = append(errs, fmt.Errorf("callback mode %q must be one of %s", cfg.CallbackMode, strings.Join(supportedCallbackModes, ", ")))
+	}
+	if !slices.Contains(supportedHealthModes, cfg.HealthMode) {
+		errs = append(errs, fmt.Errorf("health mode %q must be one of %s", cfg.HealthMode, strings.Join(supportedHealthModes, ", ")))
+	}
+
+	for i, resource := range cfg.Resources {
+		u, err := url.Parse(resource)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("resource %q must be an absolute URI without a fragment", resource))
+			continue
+		}
+		cfg.Resources[i] = normalizeResource(resource)
+	}
+	for i, audience := range cfg.TokenAudience {
+		u, err := url.Parse(audience)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("token audience %q must be an absolute URI without a fragment", audience))
+			continue
+		}
+		cfg.TokenAudience[i] = normalizeResource(audience)
+	}
+
+	if cfg.RegistrationWebhook != "" {
+		if u, err := url.Parse(cfg.RegistrationWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("registration webhook must be an http(s) URL"))
+		}
+	}
+
+	if cfg.MaxBodyBytes <= 0 {
+		errs = append(errs, fmt.Errorf("max body size must be positive, got %d", cfg.MaxBodyBytes))
+	}
+	if cfg.MaxMessageBytes <= 0 {
+		errs = append(errs, fmt.Errorf("max message size must be positive, got %d", cfg.MaxMessageBytes))
+	}
+
+	if cfg.BackendWaitTimeout < 0 || cfg.BackendWaitInterval <= 0 {
+		errs = append(errs, fmt.Errorf("backend wait timeout must not be negative and its interval must be positive, got %s and %s", cfg.BackendWaitTimeout, cfg.BackendWaitInterval))
+	}
+	if cfg.SSEReadyWait < 0 {
+		errs = append(errs, fmt.Errorf("SSE ready wait must not be negative, got %s", cfg.SSEReadyWait))
+	}
+	if cfg.SessionAffinityTTL <= 0 {
+		errs = append(errs, fmt.Errorf("session affinity TTL must be positive, got %s", cfg.SessionAffinityTTL))
+	}
+	if cfg.ProxyRetries < 0 || cfg.ProxyRetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("proxy retries and backoff must not be negative, got %d and %s", cfg.ProxyRetries, cfg.ProxyRetryBackoff))
+	}
+	if cfg.MessageRetries < 0 || cfg.MessageRetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("message retries and backoff must not be negative, got %d and %s", cfg.MessageRetries, cfg.MessageRetryBackoff))
+	}
+	if cfg.ReferrerPolicy != "" && !slices.Contains(supportedReferrerPolicies, cfg.ReferrerPolicy) {
+		errs = append(errs, fmt.Errorf("referrer policy %q must be one of %s", cfg.ReferrerPolicy, strings.Join(supportedReferrerPolicies, ", ")))
+	}
+	if strings.ContainsAny(cfg.ContentSecurityPolicy, "\r\n") {
+		errs = append(errs, errors.New("content security policy must be a single line"))
+	}
+	if !slices.Contains(supportedRedirectMatchModes, cfg.RedirectURIMatch) {
+		errs = append(errs, fmt.Errorf("redirect URI match %q must be one of %s", cfg.RedirectURIMatch, strings.Join(supportedRedirectMatchModes, ", ")))
+	}
+	for i, host := range cfg.AllowedRedirectHosts {
+		domain := strings.TrimPrefix(host, "*.")
+		if domain == "" || strings.ContainsAny(domain, "*/:@ ") {
+			errs = append(errs, fmt.Errorf("allowed redirect host %q must be a host name, optionally prefixed with *.", host))
+			continue
+		}
+		cfg.AllowedRedirectHosts[i] = strings.ToLower(host)
+	}
+	if cfg.TrustedProxyHops < 1 {
+		errs = append(errs, fmt.Errorf("trusted proxy hops must be at least 1, got %d", cfg.TrustedProxyHops))
+	}
+	if cfg.RequireHTTPS && !cfg.TrustProxy && cfg.TLSCertFile == "" {
+		errs = append(errs, errors.New("require HTTPS needs trust proxy: without a TLS certificate the wrapper doesn't terminate TLS, so only a trusted X-Forwarded-Proto can show a request used HTTPS"))
+	}
+	switch {
+	case (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == ""):
+		errs = append(errs, errors.New("TLS cert file and TLS key file must be set together"))
+	case cfg.TLSCertFile != "":
+		if _, err := serverTLSConfig(cfg); err != nil {
+			errs = append(errs, err)
+		}
+	case cfg.TLSClientCAFile != "":
+		errs = append(errs, errors.New("TLS client CA file needs TLS cert file and TLS key file: client certificates are only seen when the wrapper terminates TLS"))
+	}
+	if cfg.CertBoundTokens && cfg.TLSClientCAFile == "" {
+		errs = append(errs, errors.New("certificate-bound tokens need TLS client CA file (mTLS)"))
+	}
+
+	if cfg.SSEIdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("SSE idle timeout must not be negative, got %s", cfg.SSEIdleTimeout))
+	}
+	if cfg.SSEHeartbeatInterval < 0 {
+		errs = append(errs, fmt.Errorf("SSE heartbeat interval must not be negative, got %s", cfg.SSEHeartbeatInterval))
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{{"read header", cfg.ReadHeaderTimeout}, {"read", cfg.ReadTimeout}, {"write", cfg.WriteTimeout}, {"idle", cfg.IdleTimeout}} {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Errorf("%s timeout must not be negative, got %s", timeout.name, timeout.value))
+		}
+	}
+
+	if cfg.TokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("token TTL must be positive, got %s", cfg.TokenTTL))
+	}
+
+	for _, length := range []struct {
+		name  string
+		value int
+	}{{"code", cfg.CodeLength}, {"token", cfg.TokenLength}, {"secret", cfg.SecretLength}} {
+		if length.value < minRandomLength || length.value > maxRandomLength {
+			errs = append(errs, fmt.Errorf("%s length must be between %d and %d characters, got %d", length.name, minRandomLength, maxRandomLength, length.value))
+		}
+	}
+	if !validTokenPrefix(cfg.TokenPrefix) {
+		errs = append(errs, fmt.Errorf("token prefix %q may only contain letters, digits, _ and -", cfg.TokenPrefix))
+	}
+
+	if cfg.TokenIdleTTL < 0 {
+		errs = append(errs, fmt.Errorf("token idle TTL must not be negative, got %s", cfg.TokenIdleTTL))
+	}
+	if cfg.SSERequiredScope != "" && !validScopeToken(cfg.SSERequiredScope) {
+		errs = append(errs, fmt.Errorf("SSE required scope %q must be a single scope without spaces, quotes or backslashes", cfg.SSERequiredScope))
+	}
+	if cfg.ClockSkew < 0 {
+		errs = append(errs, fmt.Errorf("clock skew must not be negative, got %s", cfg.ClockSkew))
+	}
+	if cfg.ClientSecretTTL < 0 {
+		errs = append(errs, fmt.Errorf("client secret TTL must not be negative, got %s", cfg.ClientSecretTTL))
+	}
+
+	if !slices.Contains(supportedEnvs, cfg.Env) {
+		errs = append(errs, fmt.Errorf("env %q must be one of %s", cfg.Env, strings.Join(supportedEnvs, ", ")))
+	}
+	errs = append(errs, cfg.applyProfile()...)
+	// After the profile, which may have defaulted the client secret TTL
+	errs = append(errs, cfg.checkTTLBounds()...)
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configLoader binds settings to flags, environment variables and config file keys,
+// and resolves them after parsing
+type configLoader struct {
+	fs         *flag.FlagSet
+	set        map[string]bool
+	configPath *string
+	file       map[string]string
+	resolvers  []func() error
+	// errs collects every invalid value instead of stopping at the first
+	errs []error
+}
+
+func newConfigLoader(name string) *configLoader {
+	l := &configLoader{
+		fs:  flag.NewFlagSet(name, flag.ContinueOnError),
+		set: make(map[string]bool),
+	}
+	l.configPath = l.fs.String("config", "", envUsage("JSON config file whose keys are the flag names", []string{configFileEnv}))
+	return l
+}
+
+// commandLineOnly flags choose how the wrapper runs rather than configure it, so they can't be set
+// from the config file
+var commandLineOnly = map[string]bool{"config": true, "check-config": true, "check-backends": true, "selftest": true}
+
+// configFileEnv names the config file when -config isn't given
+const configFileEnv = "SLACK_MCP_OAUTH_CONFIG"
+
+// parse reads the flags and the config file, then resolves every registered setting
+func (l *configLoader) parse(args []string) error {
+	if err := l.fs.Parse(args); err != nil {
+		return err
+	}
+	l.fs.Visit(func(f *flag.Flag) {
+		l.set[f.Name] = true
+	})
+
+	path := *l.configPath
+	if !l.set["config"] {
+		path = os.Getenv(configFileEnv)
+	}
+	if path != "" {
+		file, err := l.readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		l.file = file
+	}
+
+	for _, resolve := range l.resolvers {
+		if err := resolve(); err != nil {
+			l.errs = append(l.errs, err)
+		}
+	}
+	return nil
+}
+
+// readConfigFile loads a JSON object of flag names to values. Numbers and booleans may be
+// given as JSON literals, lists as arrays; unknown keys are rejected to catch typos.
+func (l *configLoader) readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("config file %s is not a JSON object: %w", path, err)
+	}
+
+	var errs []error
+	file := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if commandLineOnly[key] || l.fs.Lookup(key) == nil {
+			errs = append(errs, fmt.Errorf("config file %s: unknown setting %q", path, key))
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			file[key] = v
+		case json.Number:
+			file[key] = v.String()
+		case bool:
+			file[key] = strconv.FormatBool(v)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					errs = append(errs, fmt.Errorf("config file %s: %q must be a list of strings", path, key))
+					break
+				}
+				items = append(items, s)
+			}
+			file[key] = strings.Join(items, ",")
+		default:
+			errs = append(errs, fmt.Errorf("config file %s: %q has an unsupported value", path, key))
+		}
+	}
+	return file, errors.Join(errs...)
+}
+
+// lookup returns the raw value of a setting and where it came from, or ok=false if unset
+func (l *configLoader) lookup(name, flagValue string, envs []string) (value, source string, ok bool) {
+	if l.set[name] {
+		return flagValue, "-" + name, true
+	}
+	for _, env := range envs {
+		if v := os.Getenv(env); v != "" {
+			return v, env, true
+		}
+	}
+	if v, ok := l.file[name]; ok {
+		return v, "config file key " + strconv.Quote(name), true
+	}
+	return "", "", false
+}
+
+func envUsage(usage string, envs []string) string {
+	return fmt.Sprintf("%s (env %s)", usage, strings.Join(envs, ", "))
+}
+
+func (l *configLoader) stringVar(p *string, name, def, usage string, envs ...string) {
+	v := l.fs.String(name, "", envUsage(usage, envs))
+	l.resolvers = append(l.resolvers, func() error {
+		*p = def
+		if value, _, ok := l.lookup(name, *v, envs); ok {
+			*p = value
+		}
+		return nil
+	})
+}
+
+// secretVar is like stringVar but also honors NAME_FILE, which takes precedence over the inline NAME
+func (l *configLoader) secretVar(p *string, name, usage, env string) {
+	v := l.fs.String(name, "", envUsage(usage, []string{env, env + "_FILE"}))
+	l.resolvers = append(l.resolvers, func() error {
+		if l.set[name] {
+			*p = *v
+			return nil
+		}
+		secret, err := getEnvSecret(env)
+		if secret == "" && err == nil {
+			secret = l.file[name]
+		}
+		*p = secret
+		return err
+	})
+}
+
+// stringSliceVar reads a comma-separated list, dropping empty entries
+func (l *configLoader) stringSliceVar(p *[]string, name, usage string, envs ...string) {
+	v := l.fs.String(name, "", envUsage(usage, envs))
+	l.resolvers = append(l.resolvers, func() error {
+		*p = nil
+		value, _, ok := l.lookup(name, *v, envs)
+		if !ok {
+			return nil
+		}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	})
+}
+
+func (l *configLoader) boolVar(p *bool, name string, def bool, usage string, envs ...string) {
+	v := l.fs.Bool(name, def, envUsage(usage, envs))
+	l.resolvers = append(l.resolvers, func() error {
+		*p = def
+		if l.set[name] {
+			*p = *v
+			return nil
+		}
+		value, source, ok := l.lookup(name, "", envs)
+		if !ok {
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %w", source, err)
+		}
+		*p = b
+		return nil
+	})
+}
+
+func (l *configLoader) intVar(p *int, name string, def int, usage string, envs ...string) {
+	v := l.fs.String(name, "", envUsage(usage, envs))
+	l.resolvers = append(l.resolvers, func() error {
+		*p = def
+		value, source, ok := l.lookup(name, *v, envs)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer: %w", source, err)
+		}
+		*p = n
+		return nil
+	})
+}
+
+func (l *configLoader) int64Var(p *int64, name string, def int64, usage string, envs ...string) {
+	v := l.fs.String(name, "", envUsage(usage, envs))
+	l.resolvers = append(l.resolvers, func() error {
+		*p = def
+		value, source, ok := l.lookup(name, *v, envs)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer: %w", source, err)
+		}
+		*p = n
+		return nil
+	})
+}
+
+func (l *configLoader) durationVar(p *time.Duration, name string, def time.Duration, usage string, envs ...string) {
+	v := l.fs.String(name, "", envUsage(usage, envs))
+	l.resolvers = append(l.resolvers, func() error {
+		*p = def
+		value, source, ok := l.lookup(name, *v, envs)
+		if !ok {
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration like 30s or 24h: %w", source, err)
+		}
+		*p = d
+		return nil
+	})
+}
+
+// Read a secret from the file named by NAME_FILE, falling back to the NAME variable itself
+func getEnvSecret(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// redact hides secret values in logs while still showing whether they are set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// checkTTLBounds holds the configured lifetimes to [MinTTL, MaxTTL]. Disabled (zero) and negative
+// values are left to their own checks.
+func (c *Config) checkTTLBounds() []error {
+	if c.MinTTL <= 0 || c.MaxTTL < c.MinTTL {
+		return []error{fmt.Errorf("TTL bounds must satisfy 0 < min TTL <= max TTL, got %s and %s", c.MinTTL, c.MaxTTL)}
+	}
+	var errs []error
+	for _, ttl := range []struct {
+		name  string
+		value time.Duration
+	}{{"token TTL", c.TokenTTL}, {"token idle TTL", c.TokenIdleTTL}, {"client secret TTL", c.ClientSecretTTL}} {
+		if ttl.value > 0 && (ttl.value < c.MinTTL || ttl.value > c.MaxTTL) {
+			errs = append(errs, fmt.Errorf("%s must be between %s and %s (SLACK_MCP_OAUTH_MIN_TTL and SLACK_MCP_OAUTH_MAX_TTL), got %s", ttl.name, c.MinTTL, c.MaxTTL, ttl.value))
+		}
+	}
+	return errs
+}
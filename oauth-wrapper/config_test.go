@@ -0,0 +1,326 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	t.Setenv("SLACK_MCP_HOST", "mcp.internal")
+	t.Setenv("SLACK_MCP_OAUTH_TOKEN_TTL", "2h")
+
+	cfg, err := loadConfig([]string{"-mcp-host", "flag.internal", "-port", "9090"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	if cfg.MCPHost != "flag.internal" {
+		t.Errorf("flag should override env, got MCPHost=%q", cfg.MCPHost)
+	}
+	if cfg.TokenTTL != 2*time.Hour {
+		t.Errorf("env should override default, got TokenTTL=%s", cfg.TokenTTL)
+	}
+	if cfg.MCPPort != "13080" {
+		t.Errorf("expected default MCP port, got %q", cfg.MCPPort)
+	}
+	if cfg.PublicURL != "http://localhost:9090" {
+		t.Errorf("expected public URL derived from port, got %q", cfg.PublicURL)
+	}
+	if cfg.SlackToken != "xoxp-env" {
+		t.Errorf("expected Slack token from env, got %q", cfg.SlackToken)
+	}
+}
+
+func TestLoadConfigSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("  xoxp-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	t.Setenv("SLACK_MCP_XOXP_TOKEN_FILE", path)
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.SlackToken != "xoxp-file" {
+		t.Errorf("expected trimmed token from file, got %q", cfg.SlackToken)
+	}
+
+	t.Setenv("SLACK_MCP_XOXP_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := loadConfig(nil); err == nil {
+		t.Error("expected an error for an unreadable secret file")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"mcp-host": "file.internal", "mcp-port": "14000", "max-clients": 50, "oidc": true, "resources": ["https://a.example/sse", "https://b.example/sse"]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	t.Setenv("SLACK_MCP_PORT", "15000")
+
+	cfg, err := loadConfig([]string{"-config", path, "-mcp-host", "flag.internal"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.MCPHost != "flag.internal" {
+		t.Errorf("flag should override the file, got MCPHost=%q", cfg.MCPHost)
+	}
+	if cfg.MCPPort != "15000" {
+		t.Errorf("env should override the file, got MCPPort=%q", cfg.MCPPort)
+	}
+	if cfg.MaxClients != 50 || !cfg.OIDC || len(cfg.Resources) != 2 {
+		t.Errorf("expected values from the file, got MaxClients=%d OIDC=%v Resources=%v", cfg.MaxClients, cfg.OIDC, cfg.Resources)
+	}
+}
+
+func TestLoadConfigExampleFile(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	t.Setenv("SLACK_MCP_OAUTH_CONFIG", "config.example.json")
+	if _, err := loadConfig(nil); err != nil {
+		t.Fatalf("example config should load: %v", err)
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"max-tokens": "lots", "token-ttl": "0s", "health-mode": "grpc"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadConfig([]string{"-config", path})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"max-tokens", "SLACK_MCP_XOXP_TOKEN", "token TTL", "health mode"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got:\n%v", want, err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"mcp_host": "typo"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), "mcp_host") {
+		t.Errorf("expected an unknown-key error, got %v", err)
+	}
+}
+
+func TestLoadConfigSlackTokens(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXB_TOKEN", "xoxb-bot")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("a bot token alone should be accepted: %v", err)
+	}
+	if token, tokenType := cfg.SlackCredential(); token != "xoxb-bot" || tokenType != slackTokenBot {
+		t.Errorf("expected the bot token, got %q (%s)", token, tokenType)
+	}
+
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-user")
+	cfg, err = loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if token, tokenType := cfg.SlackCredential(); token != "xoxp-user" || tokenType != slackTokenUser {
+		t.Errorf("expected the user token to take precedence, got %q (%s)", token, tokenType)
+	}
+
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxb-misplaced")
+	if _, err := loadConfig(nil); err == nil {
+		t.Error("expected an error for a bot token in SLACK_MCP_XOXP_TOKEN")
+	}
+
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "")
+	t.Setenv("SLACK_MCP_XOXB_TOKEN", "xoxp-misplaced")
+	if _, err := loadConfig(nil); err == nil {
+		t.Error("expected an error for a non-bot token in SLACK_MCP_XOXB_TOKEN")
+	}
+
+	t.Setenv("SLACK_MCP_XOXB_TOKEN", "")
+	if _, err := loadConfig([]string{"-slack-token-command", "cat /run/secrets/slack"}); err != nil {
+		t.Errorf("a token command should stand in for a static token: %v", err)
+	}
+}
+
+func TestLoadConfigInvalidValues(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+
+	if _, err := loadConfig([]string{"-max-sse-per-token", "many"}); err == nil {
+		t.Error("expected an error for a non-integer limit")
+	}
+	if _, err := loadConfig([]string{"-token-ttl", "forever"}); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+	if _, err := loadConfig([]string{"-health-mode", "grpc"}); err == nil {
+		t.Error("expected an error for an unknown health mode")
+	}
+	if _, err := loadConfig([]string{"-admin-addr", "9090"}); err == nil {
+		t.Error("expected an error for an admin address without a host")
+	}
+	if _, err := loadConfig([]string{"-admin-addr", ":8080"}); err == nil {
+		t.Error("expected an error for an admin address on the main port")
+	}
+	if _, err := loadConfig([]string{"-enable-pprof"}); err == nil {
+		t.Error("expected an error for pprof without an admin address")
+	}
+	if _, err := loadConfig([]string{"-token-prefix", "bad prefix!"}); err == nil {
+		t.Error("expected an error for a token prefix with unsafe characters")
+	}
+	if _, err := loadConfig([]string{"-health-path", "health"}); err == nil {
+		t.Error("expected an error for a relative health path")
+	}
+	if _, err := loadConfig([]string{"-mcp-backends", "http://a:13080,b:13080"}); err == nil {
+		t.Error("expected an error for a backend that isn't an http(s) URL")
+	}
+	if _, err := loadConfig([]string{"-token-length", "16"}); err == nil {
+		t.Error("expected an error for a token length below the security floor")
+	}
+	if _, err := loadConfig([]string{"-lb-strategy", "random"}); err == nil {
+		t.Error("expected an error for an unknown load balancing strategy")
+	}
+	if _, err := loadConfig([]string{"-registration-webhook", "hooks.example.com/new-client"}); err == nil {
+		t.Error("expected an error for a registration webhook that isn't an http(s) URL")
+	}
+	if _, err := loadConfig([]string{"-allowed-redirect-hosts", "https://claude.ai"}); err == nil {
+		t.Error("expected an error for an allowed redirect host with a scheme")
+	}
+	if _, err := loadConfig([]string{"-referrer-policy", "never"}); err == nil {
+		t.Error("expected an error for an unknown referrer policy")
+	}
+	if _, err := loadConfig([]string{"-sse-heartbeat-interval", "-1s"}); err == nil {
+		t.Error("expected an error for a negative heartbeat interval")
+	}
+	if _, err := loadConfig([]string{"-sse-required-scope", "mcp:stream mcp:read"}); err == nil {
+		t.Error("expected an error for more than one required scope")
+	}
+	if _, err := loadConfig([]string{"-stateless-codes", "-code-key", "short"}); err == nil {
+		t.Error("expected an error for stateless codes with a short code key")
+	}
+	if _, err := loadConfig([]string{"-max-backend-connections", "-1"}); err == nil {
+		t.Error("expected an error for a negative backend connection limit")
+	}
+	if _, err := loadConfig([]string{"-base-path", "/oauth/"}); err == nil {
+		t.Error("expected an error for a base path with a trailing slash")
+	}
+	if _, err := loadConfig([]string{"-require-https"}); err == nil {
+		t.Error("expected an error for require HTTPS without trust proxy")
+	}
+	if _, err := loadConfig([]string{"-callback-mode", "exchange"}); err == nil {
+		t.Error("expected an error for an unknown callback mode")
+	}
+	if _, err := loadConfig([]string{"-team-check-interval", "-1m"}); err == nil {
+		t.Error("expected an error for a negative team check interval")
+	}
+	if _, err := loadConfig([]string{"-tls-cert-file", "cert.pem"}); err == nil {
+		t.Error("expected an error for a TLS certificate without a key")
+	}
+	if _, err := loadConfig([]string{"-tls-cert-file", "missing-cert.pem", "-tls-key-file", "missing-key.pem"}); err == nil {
+		t.Error("expected an error for unreadable TLS files")
+	}
+	if _, err := loadConfig([]string{"-tls-client-ca-file", "ca.pem"}); err == nil {
+		t.Error("expected an error for a TLS client CA without a server certificate")
+	}
+	if _, err := loadConfig([]string{"-cert-bound-tokens"}); err == nil {
+		t.Error("expected an error for certificate-bound tokens without mTLS")
+	}
+	if _, err := loadConfig([]string{"-slow-request-threshold", "-1s"}); err == nil {
+		t.Error("expected an error for a negative slow request threshold")
+	}
+	if _, err := loadConfig([]string{"-token-audience", "slack-mcp"}); err == nil {
+		t.Error("expected an error for a token audience that isn't an absolute URI")
+	}
+	if _, err := loadConfig([]string{"-enabled-grants", "authorization_code,password"}); err == nil {
+		t.Error("expected an error for an unknown grant type")
+	}
+	if _, err := loadConfig([]string{"-min-ttl", "1h", "-max-ttl", "1m"}); err == nil {
+		t.Error("expected an error for a min TTL above the max TTL")
+	}
+	if _, err := loadConfig([]string{"-write-timeout", "-1s"}); err == nil {
+		t.Error("expected an error for a negative write timeout")
+	}
+	if _, err := loadConfig([]string{"-max-message-bytes", "0"}); err == nil {
+		t.Error("expected an error for a zero max message size")
+	}
+	if _, err := loadConfig([]string{"-slack-token-refresh", "0s"}); err == nil {
+		t.Error("expected an error for a zero Slack token refresh")
+	}
+	if _, err := loadConfig([]string{"-message-retries", "-1"}); err == nil {
+		t.Error("expected an error for negative message retries")
+	}
+	if _, err := loadConfig([]string{"-client-token-limit", "evict-newest"}); err == nil {
+		t.Error("expected an error for an unknown client token limit strategy")
+	}
+	if _, err := loadConfig([]string{"-clock-skew", "-1s"}); err == nil {
+		t.Error("expected an error for a negative clock skew")
+	}
+}
+
+func TestLoadConfigMCPBackends(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(cfg.MCPBackends) != 1 || cfg.MCPBackends[0] != "http://127.0.0.1:13080" {
+		t.Errorf("expected the host and port as the only backend, got %v", cfg.MCPBackends)
+	}
+
+	t.Setenv("SLACK_MCP_OAUTH_MCP_BACKENDS", "http://mcp-1:13080/, http://mcp-2:13080")
+	cfg, err = loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if strings.Join(cfg.MCPBackends, " ") != "http://mcp-1:13080 http://mcp-2:13080" || cfg.MCPURL != "http://mcp-1:13080" {
+		t.Errorf("unexpected backends %v and MCP URL %q", cfg.MCPBackends, cfg.MCPURL)
+	}
+}
+
+func TestLoadConfigTTLBounds(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"defaults", nil, true},
+		{"token TTL at the minimum", []string{"-token-ttl", "1m"}, true},
+		{"token TTL below the minimum", []string{"-token-ttl", "59s"}, false},
+		{"token TTL at the maximum", []string{"-token-ttl", "8760h"}, true},
+		{"token TTL above the maximum", []string{"-token-ttl", "8760h0m1s"}, false},
+		{"idle TTL below the minimum", []string{"-token-idle-ttl", "24s"}, false},
+		{"disabled idle TTL", []string{"-token-idle-ttl", "0s"}, true},
+		{"secret TTL above the maximum", []string{"-client-secret-ttl", "24000h"}, false},
+		{"never-expiring secrets", []string{"-client-secret-ttl", "0s"}, true},
+		{"raised maximum", []string{"-client-secret-ttl", "24000h", "-max-ttl", "24000h"}, true},
+		{"lowered minimum", []string{"-token-ttl", "10s", "-min-ttl", "10s"}, true},
+		{"zero minimum", []string{"-min-ttl", "0s"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(tt.args)
+			if tt.ok && err != nil {
+				t.Errorf("expected %v to load, got %v", tt.args, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("expected %v to be rejected", tt.args)
+			}
+		})
+	}
+
+	// The production default secret TTL is checked too, after the profile fills it in
+	t.Setenv("SLACK_MCP_OAUTH_ENV", envProduction)
+	t.Setenv("SLACK_MCP_OAUTH_PUBLIC_URL", "https://mcp.example.com")
+	t.Setenv("SLACK_MCP_OAUTH_REGISTRATION_TOKEN", "registration-token")
+	if _, err := loadConfig([]string{"-max-ttl", "720h"}); err == nil || !strings.Contains(err.Error(), "client secret TTL") {
+		t.Errorf("expected the 90 day production secret TTL to exceed a 30 day maximum, got %v", err)
+	}
+}
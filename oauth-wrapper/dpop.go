@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DPoP sender-constrained tokens (RFC 9449): a token issued against a DPoP proof is bound to the
+// proof's key, and every request using it must carry a fresh proof signed by that key.
+
+const (
+	dpopHeader    = "DPoP"
+	dpopProofType = "dpop+jwt"
+	// dpopProofMaxAge is how old a proof's iat may be; proofs are meant to be created per request
+	dpopProofMaxAge = time.Minute
+)
+
+// DPoP proofs are signed with the same algorithms as client assertions
+var supportedDPoPAlgs = supportedAssertionAlgs
+
+// dpopClaims are the claims a DPoP proof must carry
+type dpopClaims struct {
+	ID       string `json:"jti"`
+	Method   string `json:"htm"`
+	URI      string `json:"htu"`
+	IssuedAt int64  `json:"iat"`
+	// AccessTokenHash is required on requests that present an access token
+	AccessTokenHash string `json:"ath,omitempty"`
+}
+
+// dpopProofFrom returns the request's single DPoP proof, or "" if it has none
+func dpopProofFrom(h http.Header) (string, error) {
+	proofs := h.Values(dpopHeader)
+	if len(proofs) > 1 {
+		return "", errors.New("only one DPoP proof may be sent")
+	}
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	return proofs[0], nil
+}
+
+// verifyDPoPProof validates a proof for a request to targetURL and returns the thumbprint of the key
+// that signed it. accessToken is the token the request presents, or "" at the token endpoint.
+func (w *OAuthWrapper) verifyDPoPProof(proof, method, targetURL, accessToken string) (string, error) {
+	parts := strings.Split(proof, ".")
+	if len(parts) != 3 {
+		return "", errors.New("DPoP proof is not a JWT")
+	}
+
+	var header struct {
+		Type string `json:"typ"`
+		Alg  string `json:"alg"`
+		JWK  *jwk   `json:"jwk"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", fmt.Errorf("DPoP proof header: %w", err)
+	}
+	switch {
+	case header.Type != dpopProofType:
+		return "", fmt.Errorf("DPoP proof typ must be %s", dpopProofType)
+	case !slices.Contains(supportedDPoPAlgs, header.Alg):
+		return "", fmt.Errorf("DPoP proof alg %q is not supported, use one of %s", header.Alg, strings.Join(supportedDPoPAlgs, ", "))
+	case header.JWK == nil:
+		return "", errors.New("DPoP proof header must carry the public jwk")
+	}
+	if _, err := header.JWK.publicKey(); err != nil {
+		return "", fmt.Errorf("DPoP proof jwk: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !verifyJWTSignature([]jwk{*header.JWK}, header.Alg, "", parts[0]+"."+parts[1], signature) {
+		return "", errors.New("DPoP proof signature is invalid")
+	}
+
+	var claims dpopClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("DPoP proof claims: %w", err)
+	}
+	now := w.now()
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	switch {
+	case claims.Method != method:
+		return "", fmt.Errorf("DPoP proof htm must be %s", method)
+	case !sameTargetURI(claims.URI, targetURL):
+		return "", fmt.Errorf("DPoP proof htu must be %s", targetURL)
+	case claims.IssuedAt == 0 || issuedAt.After(now.Add(assertionClockSkew)) || now.After(issuedAt.Add(dpopProofMaxAge+assertionClockSkew)):
+		return "", errors.New("DPoP proof iat is missing or not recent")
+	case claims.ID == "":
+		return "", errors.New("DPoP proof must have a jti")
+	case accessToken != "" && claims.AccessTokenHash != accessTokenHash(accessToken):
+		return "", errors.New("DPoP proof ath does not match the access token")
+	}
+
+	thumbprint := header.JWK.thumbprint()
+	if err := w.dpopProofIDs.use(thumbprint+" "+claims.ID, issuedAt.Add(dpopProofMaxAge+assertionClockSkew), now); err != nil {
+		return "", fmt.Errorf("DPoP proof %w", err)
+	}
+	return thumbprint, nil
+}
+
+// sameTargetURI compares a proof's htu with the request URI, ignoring query and fragment
+func sameTargetURI(htu, target string) bool {
+	a, errA := url.Parse(htu)
+	b, errB := url.Parse(target)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.Path == b.Path
+}
+
+// accessTokenHash is the ath value for a token: the base64url SHA-256 of its ASCII form
+func accessTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint: the SHA-256 of the required members in lexical order
+func (k jwk) thumbprint() string {
+	var members []byte
+	switch k.Kty {
+	case "RSA":
+		members, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N})
+	default:
+		members, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y})
+	}
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// checkDPoPBinding enforces the token's type on a resource request: each token must be sent with the
+// scheme of its type, and DPoP-bound tokens only with a proof from the bound key
+func (w *OAuthWrapper) checkDPoPBinding(r *http.Request, token string, accessToken *AccessToken, scheme string) *oauthError {
+	if tokenType := accessToken.TokenType(); scheme != tokenType {
+		if tokenType == tokenTypeBearer {
+			return &oauthError{http.StatusUnauthorized, "invalid_token", "Token is not DPoP-bound"}
+		}
+		return &oauthError{http.StatusUnauthorized, "invalid_token", "DPoP-bound tokens must be sent with the DPoP authorization scheme"}
+	}
+	if accessToken.DPoPThumbprint == "" {
+		return nil
+	}
+
+	proof, err := dpopProofFrom(r.Header)
+	if err == nil && proof == "" {
+		err = errors.New("a DPoP proof is required")
+	}
+	var thumbprint string
+	if err == nil {
+		thumbprint, err = w.verifyDPoPProof(proof, r.Method, w.publicURL+r.URL.Path, token)
+	}
+	if err == nil && thumbprint != accessToken.DPoPThumbprint {
+		err = errors.New("DPoP proof is not signed by the key the token is bound to")
+	}
+	if err != nil {
+		return &oauthError{http.StatusUnauthorized, "invalid_dpop_proof", err.Error()}
+	}
+	return nil
+}
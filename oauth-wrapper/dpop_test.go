@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signDPoPProof builds an ES256 DPoP proof carrying the public key in its header
+func signDPoPProof(t *testing.T, key *ecdsa.PrivateKey, public jwk, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]any{"typ": dpopProofType, "alg": "ES256", "jwk": public})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1
+	key := jwk{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+		Kid: "ignored",
+	}
+	if got := key.thumbprint(); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("thumbprint() = %q", got)
+	}
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	key, public := newAssertionKey(t, "")
+	privateJWK := public
+	privateJWK.D = base64.RawURLEncoding.EncodeToString(key.D.Bytes())
+
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"jti": "proof-1",
+			"htm": http.MethodGet,
+			"htu": "http://localhost:8080/sse",
+			"iat": now.Unix(),
+			"ath": accessTokenHash("token"),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(map[string]any)
+		jwk     jwk
+		wantErr bool
+	}{
+		{"valid", func(map[string]any) {}, public, false},
+		{"htu with query", func(c map[string]any) { c["htu"] = "http://LOCALHOST:8080/sse?x=1" }, public, false},
+		{"wrong method", func(c map[string]any) { c["htm"] = http.MethodPost }, public, true},
+		{"wrong uri", func(c map[string]any) { c["htu"] = "http://localhost:8080/token" }, public, true},
+		{"stale", func(c map[string]any) { c["iat"] = now.Add(-5 * time.Minute).Unix() }, public, true},
+		{"future", func(c map[string]any) { c["iat"] = now.Add(5 * time.Minute).Unix() }, public, true},
+		{"missing jti", func(c map[string]any) { delete(c, "jti") }, public, true},
+		{"wrong ath", func(c map[string]any) { c["ath"] = accessTokenHash("other") }, public, true},
+		{"private key in header", func(map[string]any) {}, privateJWK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWrapper("http://127.0.0.1:13080")
+			w.now = func() time.Time { return now }
+			claims := validClaims()
+			tt.modify(claims)
+			proof := signDPoPProof(t, key, tt.jwk, claims)
+
+			thumbprint, err := w.verifyDPoPProof(proof, http.MethodGet, "http://localhost:8080/sse", "token")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyDPoPProof() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && thumbprint != public.thumbprint() {
+				t.Errorf("expected the key's thumbprint, got %q", thumbprint)
+			}
+		})
+	}
+
+	// A proof is accepted only once
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.now = func() time.Time { return now }
+	proof := signDPoPProof(t, key, public, validClaims())
+	if _, err := w.verifyDPoPProof(proof, http.MethodGet, "http://localhost:8080/sse", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.verifyDPoPProof(proof, http.MethodGet, "http://localhost:8080/sse", "token"); err == nil {
+		t.Error("expected a reused jti to be rejected")
+	}
+}
+
+func TestDPoPBoundToken(t *testing.T) {
+	now := time.Now()
+	key, public := newAssertionKey(t, "")
+	otherKey, otherPublic := newAssertionKey(t, "")
+	w := newOAuthTestWrapper(now)
+	w.dpop = true
+	w.authCodes["code"] = &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, ExpiresAt: now.Add(time.Minute)}
+
+	resp, err := w.exchangeCode(tokenRequest{
+		GrantType:    "authorization_code",
+		Code:         "code",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURI:  testRedirectURI,
+		DPoPProof: signDPoPProof(t, key, public, map[string]any{
+			"jti": "token-proof", "htm": http.MethodPost, "htu": "http://localhost:8080/token", "iat": now.Unix(),
+		}),
+	})
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	if resp.TokenType != "DPoP" {
+		t.Errorf("expected a DPoP token, got %q", resp.TokenType)
+	}
+	if at, _ := w.accessTokens.Get(resp.AccessToken); at.DPoPThumbprint != public.thumbprint() {
+		t.Fatalf("expected the token bound to the proof key, got %q", at.DPoPThumbprint)
+	}
+
+	authenticate := func(scheme string, signer *ecdsa.PrivateKey, signerPublic jwk, jti string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", scheme+" "+resp.AccessToken)
+		if signer != nil {
+			req.Header.Set(dpopHeader, signDPoPProof(t, signer, signerPublic, map[string]any{
+				"jti": jti, "htm": http.MethodGet, "htu": "http://localhost:8080/sse", "iat": now.Unix(), "ath": accessTokenHash(resp.AccessToken),
+			}))
+		}
+		rec := httptest.NewRecorder()
+		w.authenticate(rec, req, "")
+		return rec
+	}
+
+	if rec := authenticate("DPoP", key, public, "sse-1"); rec.Code != http.StatusOK {
+		t.Errorf("expected a matching proof to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := authenticate("dpop", key, public, "sse-1b"); rec.Code != http.StatusOK {
+		t.Errorf("expected the scheme to be matched case-insensitively, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := authenticate("Bearer", key, public, "sse-2"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the bearer scheme to be rejected, got %d", rec.Code)
+	}
+	if rec := authenticate("DPoP", nil, jwk{}, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected a missing proof to be rejected, got %d", rec.Code)
+	}
+	rec := authenticate("DPoP", otherKey, otherPublic, "sse-3")
+	if rec.Code != http.StatusUnauthorized || decodeJSONError(t, rec)["error"] != "invalid_dpop_proof" {
+		t.Errorf("expected a proof from another key to be rejected, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("expected a DPoP challenge")
+	}
+}
+
+func TestDPoPMetadata(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	if w.metadata().DPoPSigningAlgs != nil {
+		t.Error("DPoP algorithms must not be advertised when DPoP is off")
+	}
+	w.dpop = true
+	if algs := w.metadata().DPoPSigningAlgs; len(algs) == 0 {
+		t.Error("expected dpop_signing_alg_values_supported when DPoP is on")
+	}
+}
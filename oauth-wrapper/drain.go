@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// DrainStatus reports whether the wrapper is draining and how many SSE streams are still open
+type DrainStatus struct {
+	Draining       bool  `json:"draining"`
+	SSEConnections int64 `json:"sse_connections"`
+}
+
+// Handle the admin drain call: new sessions are refused until undrain, while open ones keep
+// running, so a restart can wait for sse_connections to reach zero
+func (w *OAuthWrapper) handleAdminDrain(rw http.ResponseWriter, r *http.Request) {
+	w.setDraining(r, true)
+	w.writeDrainStatus(rw)
+}
+
+// Handle the admin undrain call, accepting new SSE connections again
+func (w *OAuthWrapper) handleAdminUndrain(rw http.ResponseWriter, r *http.Request) {
+	w.setDraining(r, false)
+	w.writeDrainStatus(rw)
+}
+
+func (w *OAuthWrapper) setDraining(r *http.Request, draining bool) {
+	if w.draining.Swap(draining) != draining {
+		slog.InfoContext(r.Context(), "Draining state changed", "draining", draining, "sse_connections", sseConnections.value.Load())
+	}
+}
+
+func (w *OAuthWrapper) writeDrainStatus(rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(DrainStatus{Draining: w.draining.Load(), SSEConnections: sseConnections.value.Load()})
+}
+
+// opensSession reports whether r starts a new MCP session, the only requests draining refuses:
+// messages and Streamable HTTP requests for a session already open must keep it working
+func opensSession(r *http.Request) bool {
+	if r.URL.Path == mcpEndpoint {
+		return r.Header.Get(mcpSessionIDHeader) == ""
+	}
+	return r.Method == http.MethodGet
+}
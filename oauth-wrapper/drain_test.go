@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminDrain(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.secrets.Store(&secrets{AdminToken: "admin"})
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	if code := getStatus(w.routes(), "/ready"); code != http.StatusOK {
+		t.Fatalf("expected 200 before draining, got %d", code)
+	}
+
+	rec := adminRequest(w, http.MethodPost, "/admin/drain", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var status DrainStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Draining {
+		t.Error("expected the response to report draining")
+	}
+
+	if code := getStatus(w.routes(), "/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected /ready to fail while draining, got %d", code)
+	}
+	requestsBefore := proxyRequestsTotal.values[transportSSE]
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a new SSE connection to get 503 with Retry-After, got %d", rec.Code)
+	}
+	if at, _ := w.accessTokens.Get("token"); at.useCount.Load() != 0 || proxyRequestsTotal.values[transportSSE] != requestsBefore {
+		t.Error("a refused connection must not count as a token use or a proxied request")
+	}
+	if w.sseConns["token"] != 0 {
+		t.Error("a refused connection must not hold an SSE slot")
+	}
+	req = httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a new Streamable HTTP session to get 503, got %d", rec.Code)
+	}
+
+	if rec := adminRequest(w, http.MethodPost, "/admin/undrain", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if code := getStatus(w.routes(), "/ready"); code != http.StatusOK {
+		t.Errorf("expected 200 after undraining, got %d", code)
+	}
+}
+
+func TestDrainKeepsOpenSessionsWorking(t *testing.T) {
+	canceled := make(chan time.Time, 1)
+	backend := sseBackend(t, 0, canceled)
+	w := newTestWrapper(backend.URL)
+	openSSE(t, w)
+	w.draining.Store(true)
+
+	for _, tt := range []struct {
+		method, path, session string
+	}{
+		{http.MethodPost, "/message?sessionId=abc", ""},
+		{http.MethodPost, "/mcp", "abc"},
+		{http.MethodDelete, "/mcp", "abc"},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		if tt.session != "" {
+			req.Header.Set(mcpSessionIDHeader, tt.session)
+		}
+		rec := httptest.NewRecorder()
+		w.handleSSEProxy(rec, req)
+		if rec.Code/100 != 2 {
+			t.Errorf("%s %s: expected an open session to keep working while draining, got %d", tt.method, tt.path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The startup entropy audit draws this many strings of defaultTokenLength characters
+const entropyAuditCount = 256
+
+// entropyChiSquareLimit bounds the chi-square statistic of the character counts over the 64
+// symbols of the base64url alphabet. Uniform output lands near 63 (the degrees of freedom) with a
+// standard deviation of about 11, so this only trips on output that is plainly not random.
+const entropyChiSquareLimit = 150
+
+// base64URLAlphabet is every character generateRandomString can produce
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// auditRandomStrings draws count strings from generate and checks they look like CSPRNG output:
+// the requested length, only base64url characters, no repeats, and characters spread evenly over
+// the alphabet. It is a safety net against regressions such as truncated encodings or a broken
+// random source, not a statistical test suite.
+func auditRandomStrings(generate func(int) string, count, length int) error {
+	seen := make(map[string]bool, count)
+	var counts [len(base64URLAlphabet)]int
+	total := 0
+	for range count {
+		s := generate(length)
+		if len(s) != length {
+			return fmt.Errorf("generated %d characters, want %d", len(s), length)
+		}
+		if seen[s] {
+			return errors.New("generated the same string twice")
+		}
+		seen[s] = true
+		for _, c := range s {
+			i := strings.IndexRune(base64URLAlphabet, c)
+			if i < 0 {
+				return fmt.Errorf("generated %q, which isn't a base64url character", c)
+			}
+			counts[i]++
+			total++
+		}
+	}
+
+	expected := float64(total) / float64(len(counts))
+	chiSquare := 0.0
+	for _, observed := range counts {
+		d := float64(observed) - expected
+		chiSquare += d * d / expected
+	}
+	if chiSquare > entropyChiSquareLimit {
+		return fmt.Errorf("characters are unevenly distributed (chi-square %.0f over %d characters, limit %d)", chiSquare, total, entropyChiSquareLimit)
+	}
+	return nil
+}
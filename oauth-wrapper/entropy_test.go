@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRandomStringPassesEntropyAudit(t *testing.T) {
+	for _, length := range []int{minRandomLength, defaultTokenLength, maxRandomLength} {
+		if err := auditRandomStrings(generateRandomString, entropyAuditCount, length); err != nil {
+			t.Errorf("length %d: %v", length, err)
+		}
+	}
+}
+
+func TestEntropyAuditCatchesDegradedOutput(t *testing.T) {
+	n := 0
+	tests := map[string]func(int) string{
+		"repeats": func(length int) string { return strings.Repeat("A", length) },
+		"wrong length": func(length int) string {
+			return generateRandomString(length)[:length-1]
+		},
+		"padding": func(length int) string {
+			n++
+			return fmt.Sprintf("%0*d", length-1, n) + "="
+		},
+		// Unique, but every character comes from the same few symbols, like a counter
+		"skewed": func(length int) string {
+			n++
+			return fmt.Sprintf("%0*d", length, n)
+		},
+		// A zeroed buffer after a failed read, truncated the way generateRandomString does
+		"zero bytes with a unique suffix": func(length int) string {
+			n++
+			s := base64.URLEncoding.EncodeToString(make([]byte, length))[:length-8]
+			return s + fmt.Sprintf("%08x", n)
+		},
+	}
+	for name, generate := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := auditRandomStrings(generate, entropyAuditCount, defaultTokenLength); err == nil {
+				t.Error("expected the audit to fail")
+			}
+		})
+	}
+
+	// Evenly spread pseudo-random output passes, so the audit isn't tripping on noise
+	r := rand.New(rand.NewPCG(1, 2))
+	uniform := func(length int) string {
+		b := make([]byte, length)
+		for i := range b {
+			b[i] = base64URLAlphabet[r.IntN(len(base64URLAlphabet))]
+		}
+		return string(b)
+	}
+	if err := auditRandomStrings(uniform, entropyAuditCount, defaultTokenLength); err != nil {
+		t.Errorf("expected uniform output to pass: %v", err)
+	}
+}
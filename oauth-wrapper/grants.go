@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// grantEnabled reports whether this deployment accepts the grant type at /token. Operators may
+// enable a subset of supportedGrantTypes; by default every supported grant is enabled.
+func (w *OAuthWrapper) grantEnabled(grantType string) bool {
+	return slices.Contains(w.enabledGrants, grantType)
+}
+
+// checkGrantTypes rejects registrations asking for a grant type this deployment has disabled;
+// validateRegistration has already rejected the ones it doesn't support at all
+func (w *OAuthWrapper) checkGrantTypes(grantTypes []string) error {
+	for _, grantType := range grantTypes {
+		if !w.grantEnabled(grantType) {
+			return fmt.Errorf("grant_type %q is not enabled on this server", grantType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnabledGrants(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	if !slices.Equal(w.enabledGrants, supportedGrantTypes) {
+		t.Fatalf("expected every supported grant enabled by default, got %v", w.enabledGrants)
+	}
+
+	// authorization_code is the only supported grant, so disabling it stands in for any disabled grant
+	w.enabledGrants = []string{}
+	if grants := w.metadata().GrantTypesSupported; len(grants) != 0 {
+		t.Errorf("expected disabled grants left out of the metadata, got %v", grants)
+	}
+
+	w.authCodes["code"] = &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, ExpiresAt: now.Add(time.Minute)}
+	_, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: "code", RedirectURI: testRedirectURI, ClientID: "client", ClientSecret: "secret"})
+	wantOAuthError(t, err, http.StatusBadRequest, "unsupported_grant_type")
+	if _, ok := w.authCodes["code"]; !ok {
+		t.Error("a rejected grant must not consume the code")
+	}
+
+	body := `{"client_name":"Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"],"grant_types":["authorization_code"]}`
+	rec := httptest.NewRecorder()
+	w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest || decodeJSONError(t, rec)["error"] != "invalid_client_metadata" {
+		t.Errorf("expected registration for a disabled grant to be rejected, got %d: %s", rec.Code, rec.Body)
+	}
+}
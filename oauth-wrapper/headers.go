@@ -0,0 +1,77 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+)
+
+// Defaults for the browser security headers on HTML responses. The pages the wrapper serves are
+// static text, so the policy allows nothing beyond inline styles.
+const (
+	defaultContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+	defaultReferrerPolicy        = "no-referrer"
+)
+
+// supportedReferrerPolicies are the Referrer-Policy values browsers understand
+var supportedReferrerPolicies = []string{
+	"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+	"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url",
+}
+
+// securityHeaders adds browser hardening headers to HTML responses. They are decided when the
+// response starts, from its Content-Type, so JSON APIs and the SSE stream are left alone.
+func (w *OAuthWrapper) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&htmlHeaderWriter{ResponseWriter: rw, w: w}, r)
+	})
+}
+
+// htmlHeaderWriter sets the security headers just before an HTML response's header is written
+type htmlHeaderWriter struct {
+	http.ResponseWriter
+	w       *OAuthWrapper
+	started bool
+}
+
+func (hw *htmlHeaderWriter) start() {
+	if hw.started {
+		return
+	}
+	hw.started = true
+
+	h := hw.Header()
+	if mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mediaType != "text/html" {
+		return
+	}
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Frame-Options", "DENY")
+	if hw.w.contentSecurityPolicy != "" {
+		h.Set("Content-Security-Policy", hw.w.contentSecurityPolicy)
+	}
+	if hw.w.referrerPolicy != "" {
+		h.Set("Referrer-Policy", hw.w.referrerPolicy)
+	}
+}
+
+func (hw *htmlHeaderWriter) WriteHeader(status int) {
+	hw.start()
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *htmlHeaderWriter) Write(b []byte) (int, error) {
+	hw.start()
+	return hw.ResponseWriter.Write(b)
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (hw *htmlHeaderWriter) Flush() {
+	hw.start()
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (hw *htmlHeaderWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
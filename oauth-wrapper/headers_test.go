@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeadersOnHTMLOnly(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.contentSecurityPolicy, w.referrerPolicy = defaultContentSecurityPolicy, defaultReferrerPolicy
+
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+	for header, want := range map[string]string{
+		"Content-Security-Policy": defaultContentSecurityPolicy,
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         "no-referrer",
+		"X-Frame-Options":         "DENY",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("expected %s %q on the HTML page, got %q", header, want, got)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/oauth-authorization-server", nil))
+	if rec.Header().Get("Content-Security-Policy") != "" || rec.Header().Get("X-Frame-Options") != "" {
+		t.Error("JSON responses should not get the HTML security headers")
+	}
+}
+
+func TestSecurityHeadersCanBeDisabled(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Security-Policy") != "" || rec.Header().Get("Referrer-Policy") != "" {
+		t.Error("expected no CSP or Referrer-Policy when they are configured empty")
+	}
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("nosniff is always sent with HTML")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Ways of checking that the MCP backend is up
+const (
+	healthModeHTTP    = "http"    // GET the health path and expect 200
+	healthModeJSONRPC = "jsonrpc" // POST an MCP ping to the health path and expect a JSON-RPC result
+)
+
+var supportedHealthModes = []string{healthModeHTTP, healthModeJSONRPC}
+
+// healthCheckTimeout bounds a single backend health probe
+const healthCheckTimeout = 5 * time.Second
+
+var mcpPingRequest = []byte(`{"jsonrpc":"2.0","id":"oauth-wrapper-health","method":"ping"}`)
+
+// checkMCPHealth passes when at least one MCP backend passes its health check
+func (w *OAuthWrapper) checkMCPHealth(ctx context.Context) error {
+	var errs []error
+	for _, backendURL := range w.backendURLs() {
+		err := w.checkBackendHealth(ctx, backendURL)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// healthProbe lets concurrent callers share one in-flight health check, so a burst of requests
+// waiting on a cold backend turns into a single probe rather than one each
+type healthProbe struct {
+	mu      sync.Mutex
+	current *probeResult
+}
+
+type probeResult struct {
+	done chan struct{}
+	err  error
+}
+
+// probeMCPHealth runs checkMCPHealth, or joins the one already in flight. The probe isn't tied to
+// any caller, so a caller giving up doesn't fail it for the others.
+func (w *OAuthWrapper) probeMCPHealth(ctx context.Context) error {
+	p := &w.healthProbe
+	p.mu.Lock()
+	result := p.current
+	if result == nil {
+		result = &probeResult{done: make(chan struct{})}
+		p.current = result
+		go func() {
+			result.err = w.checkMCPHealth(context.WithoutCancel(ctx))
+			p.mu.Lock()
+			p.current = nil
+			p.mu.Unlock()
+			close(result.done)
+		}()
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-result.done:
+		return result.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkBackendHealth probes one MCP backend using the configured mode
+func (w *OAuthWrapper) checkBackendHealth(ctx context.Context, backendURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var req *http.Request
+	var err error
+	if w.healthMode == healthModeJSONRPC {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, backendURL+w.healthPath, bytes.NewReader(mcpPingRequest))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "application/json")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, backendURL+w.healthPath, nil)
+	}
+	if err != nil {
+		return err
+	}
+	// Health checks aren't made on behalf of any token
+	if credential := w.mcpCredential(nil); credential != "" {
+		req.Header.Set("Authorization", credential)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	if w.healthMode != healthModeJSONRPC {
+		return nil
+	}
+
+	var pong struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      any             `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pong); err != nil {
+		return fmt.Errorf("ping response is not JSON-RPC: %w", err)
+	}
+	if pong.Error != nil {
+		return fmt.Errorf("ping failed: %d %s", pong.Error.Code, pong.Error.Message)
+	}
+	if pong.JSONRPC != "2.0" || pong.ID != "oauth-wrapper-health" || pong.Result == nil {
+		return fmt.Errorf("ping response is not a JSON-RPC result for our request")
+	}
+	return nil
+}
+
+// Readiness endpoint: 200 only when the MCP backend passes its health check, the Slack token is
+// for the expected workspace and the wrapper isn't draining
+func (w *OAuthWrapper) handleReady(rw http.ResponseWriter, r *http.Request) {
+	if w.draining.Load() {
+		writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "Draining connections")
+		return
+	}
+	if !w.started.Load() {
+		writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "Waiting for the MCP server to start")
+		return
+	}
+	if !w.teamVerified() {
+		writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", w.teamCheckStatus())
+		return
+	}
+	if err := w.probeMCPHealth(r.Context()); err != nil {
+		writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "MCP server is not ready: "+err.Error())
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rw, "OK")
+}
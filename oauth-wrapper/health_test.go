@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleReady(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/health":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPost && r.URL.Path == "/mcp":
+			var req struct {
+				ID     any    `json:"id"`
+				Method string `json:"method"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Method != "ping" {
+				http.Error(rw, "unexpected method", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(rw).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": map[string]any{}})
+		case r.Method == http.MethodPost && r.URL.Path == "/broken":
+			io.WriteString(rw, `{"jsonrpc":"2.0","id":"oauth-wrapper-health","error":{"code":-32601,"message":"Method not found"}}`)
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name       string
+		mode       string
+		path       string
+		wantStatus int
+	}{
+		{"http ok", healthModeHTTP, "/health", http.StatusOK},
+		{"http wrong path", healthModeHTTP, "/missing", http.StatusServiceUnavailable},
+		{"jsonrpc ping ok", healthModeJSONRPC, "/mcp", http.StatusOK},
+		{"jsonrpc error response", healthModeJSONRPC, "/broken", http.StatusServiceUnavailable},
+		{"jsonrpc against plain health", healthModeJSONRPC, "/health", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWrapper(backend.URL)
+			w.healthMode = tt.mode
+			w.healthPath = tt.path
+
+			rec := httptest.NewRecorder()
+			w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseHeartbeat is an SSE comment line, which clients ignore but intermediaries see as traffic
+var sseHeartbeat = []byte(": ping\n\n")
+
+// heartbeatWriter injects SSE heartbeats into a proxied event stream after interval without any
+// event from the backend, so proxies and load balancers don't time out a quiet but healthy stream.
+// Heartbeats are only written between events, never into the middle of one, and only once the
+// response has started as text/event-stream. Writes and flushes are serialized with the proxy's.
+type heartbeatWriter struct {
+	http.ResponseWriter
+	interval time.Duration
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	stream   bool // the response is an event stream
+	boundary bool // everything written so far ends on an event boundary
+	stopped  bool
+}
+
+// newHeartbeatWriter starts injecting heartbeats into rw; a zero interval disables them
+func newHeartbeatWriter(rw http.ResponseWriter, interval time.Duration) *heartbeatWriter {
+	hw := &heartbeatWriter{ResponseWriter: rw, interval: interval, boundary: true}
+	if interval > 0 {
+		hw.timer = time.AfterFunc(interval, hw.beat)
+	}
+	return hw
+}
+
+func (hw *heartbeatWriter) beat() {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if hw.stopped {
+		return
+	}
+	if hw.stream && hw.boundary {
+		if _, err := hw.ResponseWriter.Write(sseHeartbeat); err != nil {
+			return
+		}
+		http.NewResponseController(hw.ResponseWriter).Flush()
+		sseHeartbeatsTotal.Inc()
+	}
+	hw.timer.Reset(hw.interval)
+}
+
+// stop ends heartbeats; none is written once it returns
+func (hw *heartbeatWriter) stop() {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.stopped = true
+	if hw.timer != nil {
+		hw.timer.Stop()
+	}
+}
+
+func (hw *heartbeatWriter) WriteHeader(status int) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	mediaType, _, _ := mime.ParseMediaType(hw.Header().Get("Content-Type"))
+	hw.stream = status == http.StatusOK && mediaType == "text/event-stream"
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *heartbeatWriter) Write(b []byte) (int, error) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	n, err := hw.ResponseWriter.Write(b)
+	if n > 0 {
+		hw.boundary = bytes.HasSuffix(b[:n], []byte("\n\n")) || bytes.HasSuffix(b[:n], []byte("\r\n\r\n")) || bytes.HasSuffix(b[:n], []byte("\r\r"))
+		if hw.timer != nil && !hw.stopped {
+			hw.timer.Reset(hw.interval)
+		}
+	}
+	return n, err
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (hw *heartbeatWriter) Flush() {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	http.NewResponseController(hw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (hw *heartbeatWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatWriterOnlyBetweenEvents(t *testing.T) {
+	start := func(written string) string {
+		rec := httptest.NewRecorder()
+		hw := newHeartbeatWriter(rec, 10*time.Millisecond)
+		hw.Header().Set("Content-Type", "text/event-stream")
+		hw.WriteHeader(http.StatusOK)
+		hw.Write([]byte(written))
+		time.Sleep(50 * time.Millisecond)
+		hw.stop()
+		return rec.Body.String()
+	}
+
+	if body := start("event: message\ndata: {}\n\n"); !strings.HasPrefix(body, "event: message\ndata: {}\n\n: ping\n\n") {
+		t.Errorf("expected heartbeats after a complete event, got %q", body)
+	}
+	if body := start("data: partial"); strings.Contains(body, "ping") {
+		t.Errorf("expected no heartbeat inside an unfinished event, got %q", body)
+	}
+
+	// Non-stream responses, like proxy errors, are left alone
+	rec := httptest.NewRecorder()
+	hw := newHeartbeatWriter(rec, 10*time.Millisecond)
+	hw.Header().Set("Content-Type", "application/json")
+	hw.WriteHeader(http.StatusBadGateway)
+	time.Sleep(50 * time.Millisecond)
+	hw.stop()
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no heartbeat in a JSON response, got %q", rec.Body)
+	}
+}
+
+func TestSSEProxyInjectsHeartbeats(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sse" {
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(rw, "event: endpoint\ndata: /message\n\n")
+		rw.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.sseHeartbeatInterval = 20 * time.Millisecond
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	wrapperServer := httptest.NewServer(http.HandlerFunc(w.handleSSEProxy))
+	defer wrapperServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, wrapperServer.URL+"/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(lines) < 4 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if want := []string{"event: endpoint", "data: /message", "", ": ping"}; strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected the backend event followed by a heartbeat, got %q", lines)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// browserPaths are the endpoints users reach in a browser; plain HTTP requests to them are
+// redirected to HTTPS rather than rejected
+var browserPaths = []string{"/authorize", "/oauth/callback", "/logout"}
+
+// probePaths stay reachable over plain HTTP so health checks keep working behind TLS termination
+var probePaths = []string{"/health", "/ready"}
+
+// requestIsHTTPS reports whether the client reached us over TLS: directly, or through trusted proxies
+// that say so in X-Forwarded-Proto. The header is read like X-Forwarded-For, taking the entry written
+// by the outermost trusted proxy (or the only entry, when proxies overwrite it); without trusted
+// proxies it is ignored, since any client could send it.
+func requestIsHTTPS(r *http.Request, trustedHops int) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if trustedHops <= 0 {
+		return false
+	}
+	var entries []string
+	for _, header := range r.Header.Values("X-Forwarded-Proto") {
+		for _, entry := range strings.Split(header, ",") {
+			entries = append(entries, strings.TrimSpace(entry))
+		}
+	}
+	if len(entries) == 0 {
+		return false
+	}
+	return strings.EqualFold(entries[max(len(entries)-trustedHops, 0)], "https")
+}
+
+// requireHTTPS refuses requests that arrived over plain HTTP: browser endpoints are redirected to
+// their https URL, everything else gets a JSON error so no token or secret is accepted in the clear.
+// Health and readiness probes are exempt.
+func (w *OAuthWrapper) requireHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, w.basePath)
+		if requestIsHTTPS(r, w.trustedProxyHops) || slices.Contains(probePaths, path) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if slices.Contains(browserPaths, path) && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			http.Redirect(rw, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+		slog.WarnContext(r.Context(), "Rejected plain HTTP request", "method", r.Method, "path", r.URL.Path)
+		writeJSONError(rw, http.StatusForbidden, "invalid_request", "HTTPS is required; this request arrived over plain HTTP")
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIsHTTPS(t *testing.T) {
+	tests := []struct {
+		name        string
+		tls         bool
+		proto       []string
+		trustedHops int
+		want        bool
+	}{
+		{"direct TLS", true, nil, 0, true},
+		{"plain", false, nil, 1, false},
+		{"untrusted header", false, []string{"https"}, 0, false},
+		{"trusted https", false, []string{"https"}, 1, true},
+		{"trusted http", false, []string{"http"}, 1, false},
+		{"outermost of two proxies", false, []string{"https, http"}, 2, true},
+		{"spoofed entry before the trusted proxy", false, []string{"https, http"}, 1, false},
+		{"overwritten by one of two proxies", false, []string{"HTTPS"}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/token", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for _, proto := range tt.proto {
+				req.Header.Add("X-Forwarded-Proto", proto)
+			}
+			if got := requestIsHTTPS(req, tt.trustedHops); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireHTTPS(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.trustedProxyHops = 1
+	w.requireTLS = true
+	handler := w.routes()
+
+	serve := func(method, target, proto string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if proto != "" {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/authorize?client_id=client&state=xyz", "http")
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://example.com/authorize?client_id=client&state=xyz" {
+		t.Errorf("expected a redirect to https, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = serve(http.MethodPost, "/token", "http")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected plain HTTP token requests to be rejected, got %d", rec.Code)
+	}
+	if body := decodeJSONError(t, rec); body["error"] != "invalid_request" || !strings.Contains(body["error_description"], "HTTPS") {
+		t.Errorf("expected an invalid_request error naming HTTPS, got %v", body)
+	}
+
+	if rec := serve(http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected probes over plain HTTP to be exempt, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/.well-known/oauth-authorization-server", "https"); rec.Code != http.StatusOK {
+		t.Errorf("expected HTTPS requests through the proxy to pass, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// idleTimer cancels a proxied connection once no bytes have flowed in either direction for the timeout
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newIdleTimer calls onIdle after timeout without activity; a zero timeout never fires
+func newIdleTimer(timeout time.Duration, onIdle func()) *idleTimer {
+	t := &idleTimer{timeout: timeout}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, onIdle)
+	}
+	return t
+}
+
+// touch records activity and restarts the countdown
+func (t *idleTimer) touch() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// idleResponseWriter resets the idle timer on every event or heartbeat written to the client
+type idleResponseWriter struct {
+	http.ResponseWriter
+	idle *idleTimer
+}
+
+func (iw *idleResponseWriter) Write(b []byte) (int, error) {
+	n, err := iw.ResponseWriter.Write(b)
+	if n > 0 {
+		iw.idle.touch()
+	}
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController, which the proxy uses to flush events
+func (iw *idleResponseWriter) Unwrap() http.ResponseWriter {
+	return iw.ResponseWriter
+}
+
+// idleReadCloser resets the idle timer on every byte read from the client
+type idleReadCloser struct {
+	io.ReadCloser
+	idle *idleTimer
+}
+
+func (ir *idleReadCloser) Read(p []byte) (int, error) {
+	n, err := ir.ReadCloser.Read(p)
+	if n > 0 {
+		ir.idle.touch()
+	}
+	return n, err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sseBackend streams heartbeats every interval (never, if zero) until the request is canceled
+func sseBackend(t *testing.T, interval time.Duration, canceled chan<- time.Time) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sse" {
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(rw, "event: endpoint\ndata: /message\n\n")
+		rw.(http.Flusher).Flush()
+
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-tick:
+				fmt.Fprint(rw, ": ping\n\n")
+				rw.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				canceled <- time.Now()
+				return
+			}
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// openSSE opens a proxied SSE stream and drains it in the background until the test ends
+func openSSE(t *testing.T, w *OAuthWrapper) {
+	t.Helper()
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	wrapperServer := httptest.NewServer(http.HandlerFunc(w.handleSSEProxy))
+	t.Cleanup(wrapperServer.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, wrapperServer.URL+"/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	go io.Copy(io.Discard, resp.Body)
+}
+
+func TestSSEIdleTimeoutClosesQuietStream(t *testing.T) {
+	canceled := make(chan time.Time, 1)
+	backend := sseBackend(t, 0, canceled)
+
+	w := newTestWrapper(backend.URL)
+	w.sseIdleTimeout = 50 * time.Millisecond
+	openSSE(t, w)
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("quiet SSE stream was not closed after the idle timeout")
+	}
+}
+
+func TestSSEIdleTimeoutResetsOnHeartbeat(t *testing.T) {
+	canceled := make(chan time.Time, 1)
+	backend := sseBackend(t, 20*time.Millisecond, canceled)
+
+	w := newTestWrapper(backend.URL)
+	w.sseIdleTimeout = 100 * time.Millisecond
+	openSSE(t, w)
+
+	select {
+	case <-canceled:
+		t.Fatal("SSE stream with regular heartbeats was closed as idle")
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestSSEIdleTimeoutZeroDisables(t *testing.T) {
+	timer := newIdleTimer(0, func() { t.Error("idle callback fired with the timeout disabled") })
+	timer.touch()
+	timer.stop()
+}
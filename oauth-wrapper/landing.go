@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// defaultLandingTitle names the service on the landing page unless configured otherwise
+const defaultLandingTitle = "Slack MCP OAuth wrapper"
+
+// LandingPage is what GET / shows: enough for an operator to see the deployment is up and find the
+// public endpoints, and nothing that isn't already public
+type LandingPage struct {
+	Service string            `json:"service"`
+	Version string            `json:"version"`
+	Message string            `json:"message,omitempty"`
+	Links   map[string]string `json:"links"`
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Service}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto">
+<h1>{{.Service}}</h1>
+<p>Version {{.Version}}</p>
+{{with .Message}}<p>{{.}}</p>{{end}}
+<ul>
+<li><a href="{{index .Links "metadata"}}">OAuth authorization server metadata</a></li>
+<li><a href="{{index .Links "health"}}">Health</a></li>
+<li><a href="{{index .Links "ready"}}">Readiness</a></li>
+<li><a href="{{index .Links "config"}}">MCP client configuration</a></li>
+</ul>
+</body></html>
+`))
+
+// Handle the landing page: HTML for browsers, JSON otherwise
+func (w *OAuthWrapper) handleLanding(rw http.ResponseWriter, r *http.Request) {
+	page := LandingPage{
+		Service: w.landingTitle,
+		Version: Version,
+		Message: w.landingMessage,
+		Links: map[string]string{
+			"metadata": w.publicURL + "/.well-known/oauth-authorization-server",
+			"health":   w.publicURL + "/health",
+			"ready":    w.publicURL + "/ready",
+			"config":   w.publicURL + "/config",
+		},
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		landingTemplate.Execute(rw, page)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(page)
+}
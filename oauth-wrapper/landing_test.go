@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLandingPage(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.landingPage, w.landingTitle, w.landingMessage = true, "Acme Slack MCP", "Contact <ops@example.com>"
+	get := func(w *OAuthWrapper, path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		w.routes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(w, "/", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON landing page, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var page LandingPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Service != "Acme Slack MCP" || page.Version != Version || page.Message != "Contact <ops@example.com>" {
+		t.Errorf("unexpected landing page %+v", page)
+	}
+	if page.Links["metadata"] != "http://localhost:8080/.well-known/oauth-authorization-server" || page.Links["health"] != "http://localhost:8080/health" {
+		t.Errorf("unexpected links %v", page.Links)
+	}
+
+	rec = get(w, "/", "text/html,application/xhtml+xml")
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(body, "<h1>Acme Slack MCP</h1>") {
+		t.Errorf("expected an HTML landing page for browsers, got:\n%s", body)
+	}
+	if !strings.Contains(body, "Contact &lt;ops@example.com&gt;") {
+		t.Errorf("expected the message to be escaped, got:\n%s", body)
+	}
+	if rec.Header().Get("X-Frame-Options") != "DENY" {
+		t.Error("expected the HTML security headers")
+	}
+
+	if rec := get(w, "/unknown", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected other paths to stay 404, got %d", rec.Code)
+	}
+
+	w.landingPage = false
+	if rec := get(w, "/", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected / to 404 with the landing page off, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sessionCookieName is reserved for a browser session once there is a consent screen. Nothing
+// sets it yet; logout clears it so a future session can't outlive a logout.
+const sessionCookieName = "oauth_wrapper_session"
+
+// Handle logout: revoke the caller's token, clear the session cookie, and optionally redirect back to the client
+func (w *OAuthWrapper) handleLogout(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		if isBodyTooLarge(err) {
+			writeJSONError(rw, http.StatusRequestEntityTooLarge, "invalid_request", "Request body too large")
+			return
+		}
+		writeJSONError(rw, http.StatusBadRequest, "invalid_request", "Invalid form data")
+		return
+	}
+
+	// Browsers can't set headers on a navigation, so also accept the token in a POST form body, but
+	// never in the URL, where it would end up in logs and Referer headers
+	token, ok := bearerToken(r)
+	if !ok {
+		token = r.PostForm.Get("token")
+	}
+	clientID := r.Form.Get("client_id")
+	accessToken, hasToken := w.accessTokens.Get(token)
+	if hasToken {
+		clientID = accessToken.ClientID
+	}
+
+	// Only redirect to a URI the client registered, so logout can't be used as an open redirect
+	var redirectURL *url.URL
+	if redirectURI := r.Form.Get("post_logout_redirect_uri"); redirectURI != "" {
+		w.mu.RLock()
+		client, exists := w.clients[clientID]
+		w.mu.RUnlock()
+		if !exists || !w.redirectURIAllowed(client.RedirectURIs, redirectURI) {
+			writeJSONError(rw, http.StatusBadRequest, "invalid_request", "post_logout_redirect_uri is not registered for this client")
+			return
+		}
+		u, err := url.Parse(redirectURI)
+		if err != nil {
+			writeJSONError(rw, http.StatusBadRequest, "invalid_request", "post_logout_redirect_uri could not be parsed")
+			return
+		}
+		if state := r.Form.Get("state"); state != "" {
+			q := u.Query()
+			q.Set("state", state)
+			u.RawQuery = q.Encode()
+		}
+		redirectURL = u
+	}
+
+	if hasToken {
+		w.accessTokens.Delete(token)
+		accessTokensGauge.Set(int64(w.accessTokens.Len()))
+		slog.InfoContext(r.Context(), "Access token revoked by logout", "client_id", clientID)
+		w.notifySlack(fmt.Sprintf("Access token of *%s* revoked by logout at %s", slackEscape(w.clientName(clientID)), w.now().UTC().Format(time.RFC3339)))
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(w.publicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	rw.Header().Set("Cache-Control", "no-store")
+
+	if redirectURL != nil {
+		http.Redirect(rw, r, redirectURL.String(), http.StatusFound)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(rw, "<!DOCTYPE html><html><head><title>Signed out</title></head><body><p>You have been signed out. You can close this window.</p></body></html>")
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]string{"status": "logged_out"})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleLogout(t *testing.T) {
+	const redirectURI = "https://claude.ai/api/mcp/auth_callback"
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		accept       string
+		wantStatus   int
+		wantLocation string
+		wantRevoked  bool
+	}{
+		{
+			name:        "json for api callers",
+			form:        url.Values{"token": {"token"}},
+			wantStatus:  http.StatusOK,
+			wantRevoked: true,
+		},
+		{
+			name:        "html for browsers",
+			form:        url.Values{"token": {"token"}},
+			accept:      "text/html",
+			wantStatus:  http.StatusOK,
+			wantRevoked: true,
+		},
+		{
+			name:         "registered redirect",
+			form:         url.Values{"token": {"token"}, "post_logout_redirect_uri": {redirectURI}, "state": {"xyz"}},
+			wantStatus:   http.StatusFound,
+			wantLocation: redirectURI + "?state=xyz",
+			wantRevoked:  true,
+		},
+		{
+			name:       "unregistered redirect",
+			form:       url.Values{"token": {"token"}, "post_logout_redirect_uri": {"https://evil.example/"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "redirect without a token uses client_id",
+			form:         url.Values{"client_id": {"client"}, "post_logout_redirect_uri": {redirectURI}},
+			wantStatus:   http.StatusFound,
+			wantLocation: redirectURI,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWrapper("http://127.0.0.1:13080")
+			w.clients["client"] = &ClientRegistrationResponse{ClientID: "client", RedirectURIs: []string{redirectURI}}
+			w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+			req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			w.routes().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("expected Location %q, got %q", tt.wantLocation, got)
+			}
+			if _, exists := w.accessTokens.Get("token"); exists == tt.wantRevoked {
+				t.Errorf("expected token revoked=%v", tt.wantRevoked)
+			}
+			if tt.wantStatus != http.StatusBadRequest && !strings.Contains(rec.Header().Get("Set-Cookie"), sessionCookieName+"=;") {
+				t.Errorf("expected the session cookie to be cleared, got %q", rec.Header().Get("Set-Cookie"))
+			}
+			if tt.accept == "text/html" && !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("expected an HTML page, got %q", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestHandleLogoutIgnoresTokenInURL(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logout?token=token", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if _, exists := w.accessTokens.Get("token"); !exists {
+		t.Error("a token in the query string must not be accepted")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w.routes().ServeHTTP(httptest.NewRecorder(), req)
+	if _, exists := w.accessTokens.Get("token"); exists {
+		t.Error("expected GET with a Bearer header to revoke the token")
+	}
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,26 +29,69 @@ type OAuth2Metadata struct {
 	ResponseTypesSupported            []string `json:"response_types_supported"`
 	GrantTypesSupported               []string `json:"grant_types_supported"`
 	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgs      []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	DPoPSigningAlgs                   []string `json:"dpop_signing_alg_values_supported,omitempty"`
+	CertBoundAccessTokens             bool     `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+}
+
+// OpenID Connect discovery document: the OAuth metadata plus OIDC fields when OIDC mode is on
+type OpenIDConfiguration struct {
+	OAuth2Metadata
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                          string   `json:"jwks_uri,omitempty"`
+	SubjectTypesSupported            []string `json:"subject_types_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	EndSessionEndpoint               string   `json:"end_session_endpoint,omitempty"`
 }
 
 // Client registration request from Claude Teams
 type ClientRegistrationRequest struct {
-	ClientName    string   `json:"client_name"`
-	RedirectURIs  []string `json:"redirect_uris"`
-	GrantTypes    []string `json:"grant_types,omitempty"`
-	ResponseTypes []string `json:"response_types,omitempty"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	// Keys for private_key_jwt: inline or published at a URL
+	JWKS    *jwkSet `json:"jwks,omitempty"`
+	JWKSURI string  `json:"jwks_uri,omitempty"`
+	// Descriptive metadata (RFC 7591) and free-form key/value pairs for inventory and ownership
+	ClientURI string            `json:"client_uri,omitempty"`
+	LogoURI   string            `json:"logo_uri,omitempty"`
+	Contacts  []string          `json:"contacts,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// Extensions holds the fields this server doesn't recognize, see UnmarshalJSON
+	Extensions map[string]json.RawMessage `json:"-"`
 }
 
 // Client registration response
 type ClientRegistrationResponse struct {
 	ClientID                string   `json:"client_id"`
-	ClientSecret            string   `json:"client_secret"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
 	ClientName              string   `json:"client_name"`
 	RedirectURIs            []string `json:"redirect_uris"`
 	GrantTypes              []string `json:"grant_types"`
 	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	JWKS                    *jwkSet  `json:"jwks,omitempty"`
+	JWKSURI                 string   `json:"jwks_uri,omitempty"`
 	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
 	ClientSecretExpiresAt   int      `json:"client_secret_expires_at"`
+	// Descriptive metadata as registered, kept for admin listings
+	ClientURI  string                     `json:"client_uri,omitempty"`
+	LogoURI    string                     `json:"logo_uri,omitempty"`
+	Contacts   []string                   `json:"contacts,omitempty"`
+	Metadata   map[string]string          `json:"metadata,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	// ClientSecretHash replaces ClientSecret for clients imported from another deployment
+	ClientSecretHash string `json:"-"`
+	// Static clients come from the static clients file and can't be replaced by an import
+	Static bool `json:"static,omitempty"`
+}
+
+// isPublic reports whether the client cannot keep a secret and authenticates with PKCE alone
+func (c *ClientRegistrationResponse) isPublic() bool {
+	return c.TokenEndpointAuthMethod == "none"
 }
 
 // Token response
@@ -51,356 +100,1003 @@ type TokenResponse struct {
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
 }
 
+// Grant and response types this server can actually honor
+var (
+	supportedGrantTypes    = []string{"authorization_code"}
+	supportedResponseTypes = []string{"code"}
+	supportedAuthMethods   = []string{"client_secret_post", "client_secret_basic", authMethodPrivateKeyJWT, "none"}
+)
+
+// Upper bound on client_name to keep registrations and logs sane
+const maxClientNameLength = 256
+
 // OAuth wrapper server
 type OAuthWrapper struct {
 	clients      map[string]*ClientRegistrationResponse
 	authCodes    map[string]*AuthCode
-	accessTokens map[string]*AccessToken
+	accessTokens *shardedTokenMap
 	mu           sync.RWMutex
 	mcpURL       string
-	slackToken   string
+	secrets      atomic.Pointer[secrets]
 	publicURL    string
+	adminAddr    string
+	enablePprof  bool
+	tokenTTL     time.Duration
+	tokenIdleTTL time.Duration
+	clockSkew    time.Duration
+	tokenPrefix  string
+
+	// basePath prefixes every route when the wrapper is served under a subpath; publicURL includes it
+	basePath string
+
+	// Active SSE streams per access token
+	sseConns       map[string]int
+	sseMu          sync.Mutex
+	maxSSEPerToken int
+	sseIdleTimeout time.Duration
+	// sseHeartbeatInterval injects heartbeats into streams quiet for this long (0 = never)
+	sseHeartbeatInterval time.Duration
+	// backendSlots caps proxied connections across all tokens; nil is unlimited
+	backendSlots chan struct{}
+
+	// How the MCP backend's health is checked
+	healthPath string
+	healthMode string
+
+	// Startup wait and per-request retries while the MCP backend comes up
+	backendWaitTimeout  time.Duration
+	backendWaitInterval time.Duration
+	proxyRetries        int
+	proxyRetryBackoff   time.Duration
+	messageRetries      int
+	messageRetryBackoff time.Duration
+	// started is set once the startup wait for the backend is over
+	started atomic.Bool
+	// draining refuses new SSE connections while open ones finish, ahead of a planned restart
+	draining atomic.Bool
+	// healthProbe shares in-flight backend health checks between waiting requests
+	healthProbe healthProbe
+	// sseReadyWait is how long an SSE request may wait for a backend to become ready (0 = don't wait)
+	sseReadyWait time.Duration
+
+	// streamKill ends every open SSE stream when all tokens are revoked
+	streamKill streamKillSwitch
+
+	// tickets stand in for access tokens on /sse, once, for clients that can't send headers
+	tickets map[string]*sseTicket
+
+	// Replay protection for private_key_jwt assertions, and the client that fetches jwks_uri and the
+	// keys it fetched
+	assertionIDs assertionIDCache
+	jwksClient   *http.Client
+	jwks         jwksCache
+
+	// Seals authorization codes into the code itself when stateless codes are enabled, and the ids
+	// of the sealed codes already redeemed; nil keeps codes in authCodes
+	codeSealer  *codeSealer
+	usedCodeIDs assertionIDCache
+
+	// Where new client registrations are announced, if anywhere
+	registrationWebhook string
+	webhookClient       *http.Client
+
+	// Posts client lifecycle events to a Slack channel; nil when no channel is configured
+	notifier *slackNotifier
+
+	// Whether /token binds tokens to DPoP proofs, and replay protection for the proofs
+	dpop         bool
+	dpopProofIDs assertionIDCache
+
+	// Security headers sent with HTML responses; empty omits them
+	contentSecurityPolicy string
+	referrerPolicy        string
+
+	// Random characters in generated codes, tokens and client secrets
+	codeLength   int
+	tokenLength  int
+	secretLength int
+
+	// How redirect_uri is matched against registered URIs: exact or prefix
+	redirectMatch string
+	// Hosts clients may register redirect URIs on; empty allows any
+	allowedRedirectHosts []string
+	// httpsRedirects rejects registered redirect URIs that aren't https (or loopback http)
+	httpsRedirects bool
+	// clientSecretTTL bounds the lifetime of issued client secrets (0 = forever)
+	clientSecretTTL time.Duration
+
+	// MCP protocol versions accepted from clients; empty accepts any
+	protocolVersions []string
+
+	// Scope an access token needs to open the SSE proxy; empty lets any token through
+	sseRequiredScope string
+
+	// X-Forwarded-For entries written by trusted proxies; 0 ignores the header
+	trustedProxyHops int
+
+	// requireTLS rejects or redirects requests that didn't arrive over HTTPS
+	requireTLS bool
+
+	// How /oauth/callback answers: echo, not-found or not-implemented
+	callbackMode string
+
+	// Slack Web API base URL and the per-token profiles served by /userinfo
+	slackAPIURL string
+	userInfo    userInfoCache
+	// Source of the Slack token for those calls, asked at request time
+	slackTokens TokenProvider
+
+	// Workspace the Slack token must belong to before anything is proxied, and the last check of it
+	expectedTeamID    string
+	teamCheckInterval time.Duration
+	teamCheck         atomic.Pointer[teamCheckResult]
+
+	// certBoundTokens binds tokens to the TLS client certificate presented at /token (RFC 8705)
+	certBoundTokens bool
+
+	// Audiences issued tokens carry by default; the first is the one the proxy accepts
+	tokenAudience []string
+
+	// Grant types /token accepts, a subset of supportedGrantTypes
+	enabledGrants []string
+
+	// Landing page at /, and what it shows
+	landingPage    bool
+	landingTitle   string
+	landingMessage string
+
+	// slowRequestThreshold is how long a request may take before it is logged as slow, 0 never
+	slowRequestThreshold time.Duration
+
+	// Caps on in-memory state
+	maxClients int
+	maxTokens  int
+
+	// Live access tokens one client may hold, and whether more are refused or replace the oldest
+	maxTokensPerClient int
+	clientTokenLimit   string
+
+	maxBodyBytes int64
+	// maxMessageBytes caps proxied MCP message bodies
+	maxMessageBytes int64
+
+	// Resource indicators clients may request; empty disables audience restriction
+	resources []string
+
+	oidc bool
+
+	bindOrigin bool
+
+	// Clock for code and token lifetimes; replaced in tests
+	now func() time.Time
+	// Source of generated client IDs; replaced in tests
+	randomString func(length int) string
+
+	// Credential sent to the MCP server per access token; defaults to the current SSE API key
+	mcpCredential mcpCredentialFunc
+
+	// Reverse proxy to the MCP server, built once on first use
+	proxy     *httputil.ReverseProxy
+	proxyErr  error
+	proxyOnce sync.Once
+	// MCP servers behind the proxy, how new sessions are spread across them, and which one holds each session
+	mcpBackendURLs        []string
+	lbStrategy            string
+	backendHealthInterval time.Duration
+	backends              []*mcpBackend
+	nextBackend           atomic.Uint64
+	affinity              *sessionAffinity
 }
 
 // AuthCode stores authorization code data
 type AuthCode struct {
-	ClientID    string
-	RedirectURI string
-	ExpiresAt   time.Time
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Audience      []string
+	Scopes        []string
+	IssuedAt      time.Time
+	ExpiresAt     time.Time
 }
 
 // AccessToken stores access token data
 type AccessToken struct {
-	ClientID  string
+	ClientID string
+	// Audience the token was issued for: the configured token audiences, possibly narrowed by
+	// resource indicators. Empty when neither is configured, making the token valid everywhere.
+	Audience  []string
 	ExpiresAt time.Time
+	// Scopes granted at authorization time, empty when the client asked for none
+	Scopes []string
+	// Origin of the redirect URI the token was issued through, when origin binding is enabled
+	BoundOrigin string
+	// DPoPThumbprint is the JWK thumbprint of the key the token is bound to, empty for bearer tokens
+	DPoPThumbprint string
+	// CertThumbprint is the x5t#S256 of the TLS client certificate the token is bound to (RFC 8705)
+	CertThumbprint string
+	CreatedAt      time.Time
+	// lastUsed is the UnixNano time of the latest validated use; updated concurrently by /sse
+	lastUsed atomic.Int64
+	// useCount is the number of requests proxied with the token
+	useCount atomic.Int64
+}
+
+// Token types (RFC 6749 section 7.1), each named after the Authorization scheme the token is sent with
+const (
+	tokenTypeBearer = "Bearer"
+	tokenTypeDPoP   = "DPoP"
+)
+
+// TokenType returns the type the token was issued as: DPoP when bound to a key, Bearer otherwise
+func (at *AccessToken) TokenType() string {
+	if at.DPoPThumbprint != "" {
+		return tokenTypeDPoP
+	}
+	return tokenTypeBearer
+}
+
+// LastUsedAt returns when the token was last used, or the zero time if never
+func (at *AccessToken) LastUsedAt() time.Time {
+	if n := at.lastUsed.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// UseCount returns how many requests have been proxied with the token
+func (at *AccessToken) UseCount() int64 {
+	return at.useCount.Load()
+}
+
+// countUse records a request proxied with the token. Atomics keep this off any lock on the hot path.
+func (at *AccessToken) countUse() {
+	at.useCount.Add(1)
+	tokenUsesTotal.Inc()
+}
+
+// touch records a validated use of the token
+func (at *AccessToken) touch(now time.Time) {
+	at.lastUsed.Store(now.UnixNano())
+}
+
+// defaultClockSkew is how long past expiry tokens and codes are still accepted when no skew is configured
+const defaultClockSkew = 60 * time.Second
+
+// expired reports whether the token is more than skew past its absolute expiry or, when idleTTL
+// is set, has gone unused for longer than idleTTL since it was last used or issued
+func (at *AccessToken) expired(now time.Time, idleTTL, skew time.Duration) bool {
+	if now.After(at.ExpiresAt.Add(skew)) {
+		return true
+	}
+	if idleTTL <= 0 {
+		return false
+	}
+	lastActive := at.LastUsedAt()
+	if lastActive.IsZero() {
+		lastActive = at.CreatedAt
+	}
+	return now.Sub(lastActive) > idleTTL
 }
 
 func main() {
-	// Get configuration from environment
-	port := os.Getenv("PORT")  // Runway sets PORT
-	if port == "" {
-		port = os.Getenv("OAUTH_WRAPPER_PORT")
-		if port == "" {
-			port = "8080"
+	slog.SetDefault(newLogger())
+	slog.Info("OAuth wrapper starting", "version", Version, "commit", CommitHash, "build_time", BuildTime)
+
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
 		}
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	slog.Info("Resolved configuration", "config", cfg)
+	if cfg.Env == envProduction {
+		slog.Info("Running with the production profile: https redirects, a registration token and expiring client secrets are enforced")
+	} else {
+		slog.Info("Running with the development profile; set SLACK_MCP_OAUTH_ENV=production for production deployments")
+	}
+	if token, tokenType := cfg.SlackCredential(); token != "" && tokenType == slackTokenBot {
+		slog.Info("Using a Slack bot token; the MCP server must be started with SLACK_MCP_XOXB_TOKEN too")
 	}
 
-	publicURL := os.Getenv("OAUTH_WRAPPER_PUBLIC_URL")
-	if publicURL == "" {
-		// Try Runway's app URL
-		if runwayURL := os.Getenv("RUNWAY_APP_URL"); runwayURL != "" {
-			publicURL = runwayURL
-		} else {
-			publicURL = "http://localhost:" + port
+	// Every token, code and secret comes from generateRandomString; make sure it still looks random
+	if err := auditRandomStrings(generateRandomString, entropyAuditCount, defaultTokenLength); err != nil {
+		if cfg.RequireEntropyAudit {
+			log.Fatalf("Random token generation failed its entropy audit: %v", err)
 		}
+		slog.Warn("Random token generation failed its entropy audit; issued tokens may be guessable", "error", err)
 	}
 
-	mcpHost := os.Getenv("SLACK_MCP_HOST")
-	if mcpHost == "" {
-		mcpHost = "127.0.0.1"
+	wrapper := newOAuthWrapper(cfg)
+	if cfg.StaticClientsFile != "" {
+		if err := wrapper.loadStaticClients(cfg.StaticClientsFile); err != nil {
+			log.Fatalf("Invalid static clients:\n%v", err)
+		}
+	}
+	if cfg.RegistrationToken == "" {
+		slog.Warn("Open client registration is enabled; set SLACK_MCP_OAUTH_REGISTRATION_TOKEN to require an initial access token")
+	}
+	if len(cfg.AllowedRedirectHosts) == 0 {
+		slog.Warn("Clients may register redirect URIs on any host; set SLACK_MCP_OAUTH_ALLOWED_REDIRECT_HOSTS to restrict them")
 	}
 
-	mcpPort := os.Getenv("SLACK_MCP_PORT")
-	if mcpPort == "" {
-		mcpPort = "13080"
+	// Pre-deploy validation stops here, before binding any port
+	if cfg.CheckConfig {
+		if err := checkConfig(os.Stdout, cfg); err != nil {
+			log.Fatalf("Configuration check failed:\n%v", err)
+		}
+		return
+	}
+	if cfg.SelfTest {
+		if err := selfTest(os.Stdout, cfg); err != nil {
+			log.Fatalf("Self-test failed:\n%v", err)
+		}
+		return
 	}
 
-	slackToken := os.Getenv("SLACK_MCP_XOXP_TOKEN")
-	if slackToken == "" {
-		log.Fatal("SLACK_MCP_XOXP_TOKEN environment variable is required")
+	// Wait for the MCP server in the background; /ready reports 503 until this is done
+	go wrapper.waitForBackend(context.Background())
+	go wrapper.monitorBackends(context.Background())
+	go wrapper.runSlackNotifier(context.Background())
+	go wrapper.runTeamCheck(context.Background())
+
+	// Rotate secrets on SIGHUP without dropping connections
+	go wrapper.watchReload(os.Args[1:], cfg)
+
+	// Admin endpoints get their own listener when configured, sharing the same wrapper state
+	if cfg.AdminAddr != "" {
+		go func() {
+			slog.Info("Admin listening", "addr", cfg.AdminAddr)
+			log.Fatal(newServer(cfg.AdminAddr, wrapper.adminRoutes(), cfg).ListenAndServe())
+		}()
 	}
 
-	wrapper := &OAuthWrapper{
-		clients:      make(map[string]*ClientRegistrationResponse),
-		authCodes:    make(map[string]*AuthCode),
-		accessTokens: make(map[string]*AccessToken),
-		mcpURL:       fmt.Sprintf("http://%s:%s", mcpHost, mcpPort),
-		slackToken:   slackToken,
-		publicURL:    publicURL,
+	// Listen on all interfaces for Railway
+	addr := "0.0.0.0:" + cfg.Port
+	server := newServer(addr, wrapper.routes(), cfg)
+	if cfg.TLSCertFile != "" {
+		tlsConfig, err := serverTLSConfig(cfg)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		server.TLSConfig = tlsConfig
+		slog.Info("Listening with TLS", "addr", addr, "client_certificates", cfg.TLSClientCAFile != "")
+		log.Fatal(server.ListenAndServeTLS("", ""))
 	}
+	slog.Info("Listening", "addr", addr)
+	log.Fatal(server.ListenAndServe())
+}
 
-	// Setup routes
-	http.HandleFunc("/.well-known/oauth-authorization-server", wrapper.handleMetadata)
-	http.HandleFunc("/register", wrapper.handleRegistration)
-	http.HandleFunc("/authorize", wrapper.handleAuthorize)
-	http.HandleFunc("/oauth/callback", wrapper.handleCallback)
-	http.HandleFunc("/token", wrapper.handleToken)
-	http.HandleFunc("/sse", wrapper.handleSSEProxy)
-	http.HandleFunc("/health", wrapper.handleHealth)
+// routes builds the HTTP handler for the public listener
+func (w *OAuthWrapper) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/oauth-authorization-server", allowMethods(http.HandlerFunc(w.handleMetadata), http.MethodGet))
+	mux.Handle("/.well-known/openid-configuration", allowMethods(http.HandlerFunc(w.handleOpenIDConfiguration), http.MethodGet))
+	mux.Handle(protectedResourcePath, allowMethods(http.HandlerFunc(w.handleProtectedResource), http.MethodGet))
+	mux.Handle(protectedResourcePath+"/", allowMethods(http.HandlerFunc(w.handleProtectedResource), http.MethodGet))
+	mux.Handle("/register", allowMethods(w.limitBody(http.HandlerFunc(w.handleRegistration)), http.MethodPost))
+	mux.Handle("/authorize", allowMethods(http.HandlerFunc(w.handleAuthorize), http.MethodGet))
+	mux.Handle("/oauth/callback", allowMethods(http.HandlerFunc(w.handleCallback), http.MethodGet))
+	mux.Handle("/token", allowMethods(w.limitBody(http.HandlerFunc(w.handleToken)), http.MethodPost))
+	mux.Handle("/logout", allowMethods(w.limitBody(http.HandlerFunc(w.handleLogout)), http.MethodGet, http.MethodPost))
+	mux.Handle("/userinfo", allowMethods(http.HandlerFunc(w.handleUserInfo), http.MethodGet, http.MethodPost))
+	mux.Handle("/whoami", allowMethods(http.HandlerFunc(w.handleWhoAmI), http.MethodGet))
+	mux.Handle(sseEndpoint, allowMethods(http.HandlerFunc(w.handleSSEProxy), http.MethodGet))
+	mux.Handle(messageEndpoint, allowMethods(http.HandlerFunc(w.handleSSEProxy), http.MethodPost))
+	mux.Handle(mcpEndpoint, allowMethods(http.HandlerFunc(w.handleSSEProxy), http.MethodGet, http.MethodPost, http.MethodDelete))
+	mux.Handle(ticketEndpoint, allowMethods(http.HandlerFunc(w.handleSSETicket), http.MethodPost))
+	mux.Handle("/config", allowMethods(http.HandlerFunc(w.handleClientConfig), http.MethodGet))
+	mux.Handle("/health", allowMethods(http.HandlerFunc(w.handleHealth), http.MethodGet))
+	mux.Handle("/ready", allowMethods(http.HandlerFunc(w.handleReady), http.MethodGet))
+	mux.Handle("/version", allowMethods(http.HandlerFunc(w.handleVersion), http.MethodGet))
+	if w.landingPage {
+		mux.Handle("/{$}", allowMethods(http.HandlerFunc(w.handleLanding), http.MethodGet))
+	}
 
-	log.Printf("OAuth wrapper server starting on port %s", port)
-	log.Printf("Public URL: %s", publicURL)
-	log.Printf("MCP Server URL: %s", wrapper.mcpURL)
-	
-	// Listen on all interfaces for Railway
-	addr := "0.0.0.0:" + port
-	log.Printf("Listening on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	// Without a separate admin listener, admin routes share the public one
+	if w.adminAddr == "" {
+		w.registerAdminRoutes(mux)
+	}
+
+	handler := http.Handler(mux)
+	if w.basePath != "" {
+		handler = w.underBasePath(mux)
+	}
+	if w.requireTLS {
+		handler = w.requireHTTPS(handler)
+	}
+
+	return requestID(w.resolveClientIP(w.timeRequests(recoverPanics(serverHeader(w.securityHeaders(handler))))))
+}
+
+// newOAuthWrapper creates the wrapper state from the resolved configuration
+func newOAuthWrapper(cfg *Config) *OAuthWrapper {
+	w := &OAuthWrapper{
+		clients:        make(map[string]*ClientRegistrationResponse),
+		authCodes:      make(map[string]*AuthCode),
+		accessTokens:   newShardedTokenMap(),
+		mcpURL:         cfg.MCPURL,
+		publicURL:      cfg.PublicURL + cfg.BasePath,
+		basePath:       cfg.BasePath,
+		adminAddr:      cfg.AdminAddr,
+		enablePprof:    cfg.EnablePprof,
+		tokenTTL:       cfg.TokenTTL,
+		tokenIdleTTL:   cfg.TokenIdleTTL,
+		tokenPrefix:    cfg.TokenPrefix,
+		sseConns:       make(map[string]int),
+		maxSSEPerToken: cfg.MaxSSEPerToken,
+		sseIdleTimeout: cfg.SSEIdleTimeout,
+		healthPath:     cfg.HealthPath,
+		healthMode:     cfg.HealthMode,
+		maxClients:     cfg.MaxClients,
+		maxTokens:      cfg.MaxTokens,
+		maxBodyBytes:   cfg.MaxBodyBytes,
+		resources:      cfg.Resources,
+		oidc:           cfg.OIDC,
+		bindOrigin:     cfg.BindTokenOrigin,
+	}
+	w.backendWaitTimeout, w.backendWaitInterval = cfg.BackendWaitTimeout, cfg.BackendWaitInterval
+	w.sseReadyWait = cfg.SSEReadyWait
+	w.sseHeartbeatInterval = cfg.SSEHeartbeatInterval
+	if cfg.MaxBackendConnections > 0 {
+		w.backendSlots = make(chan struct{}, cfg.MaxBackendConnections)
+	}
+	backendConnectionLimit.Set(int64(cfg.MaxBackendConnections))
+	w.proxyRetries, w.proxyRetryBackoff = cfg.ProxyRetries, cfg.ProxyRetryBackoff
+	w.messageRetries, w.messageRetryBackoff = cfg.MessageRetries, cfg.MessageRetryBackoff
+	w.slackAPIURL = defaultSlackAPIURL
+	w.slackTokens = staticTokenProvider{secrets: w.currentSecrets}
+	if cfg.SlackTokenCommand != "" {
+		w.slackTokens = newCachedTokenProvider(commandTokenProvider{command: cfg.SlackTokenCommand}, cfg.SlackTokenRefresh)
+	}
+	w.jwksClient = newJWKSClient(http.DefaultTransport)
+	w.tickets = make(map[string]*sseTicket)
+	w.dpop = cfg.DPoP
+	if cfg.NotifyChannel != "" {
+		w.notifier = newSlackNotifier(cfg.NotifyChannel)
+	}
+	w.registrationWebhook, w.webhookClient = cfg.RegistrationWebhook, http.DefaultClient
+	w.redirectMatch, w.allowedRedirectHosts = cfg.RedirectURIMatch, cfg.AllowedRedirectHosts
+	w.httpsRedirects, w.clientSecretTTL = cfg.Env == envProduction, cfg.ClientSecretTTL
+	w.clockSkew = cfg.ClockSkew
+	w.sseRequiredScope = cfg.SSERequiredScope
+	w.maxTokensPerClient, w.clientTokenLimit = cfg.MaxTokensPerClient, cfg.ClientTokenLimit
+	if cfg.StatelessCodes {
+		w.codeSealer = newCodeSealer(cfg.CodeKey)
+	}
+	w.codeLength, w.tokenLength, w.secretLength = cfg.CodeLength, cfg.TokenLength, cfg.SecretLength
+	w.protocolVersions = cfg.ProtocolVersions
+	w.contentSecurityPolicy, w.referrerPolicy = cfg.ContentSecurityPolicy, cfg.ReferrerPolicy
+	w.mcpBackendURLs, w.lbStrategy, w.backendHealthInterval = cfg.MCPBackends, cfg.LBStrategy, cfg.BackendHealthInterval
+	w.affinity = newSessionAffinity(cfg.SessionAffinityTTL)
+	if cfg.TrustProxy {
+		w.trustedProxyHops = cfg.TrustedProxyHops
+	}
+	w.requireTLS = cfg.RequireHTTPS
+	w.callbackMode = cfg.CallbackMode
+	w.expectedTeamID, w.teamCheckInterval = cfg.ExpectedTeamID, cfg.TeamCheckInterval
+	w.certBoundTokens = cfg.CertBoundTokens
+	w.slowRequestThreshold = cfg.SlowRequestThreshold
+	w.tokenAudience = cfg.TokenAudience
+	w.landingPage, w.landingTitle, w.landingMessage = cfg.LandingPage, cfg.LandingTitle, cfg.LandingMessage
+	w.enabledGrants = cfg.EnabledGrants
+	w.maxMessageBytes = cfg.MaxMessageBytes
+	if len(w.enabledGrants) == 0 {
+		w.enabledGrants = supportedGrantTypes
+	}
+	w.now = time.Now
+	w.randomString = generateRandomString
+	w.secrets.Store(secretsFromConfig(cfg))
+	w.mcpCredential = w.sseAPIKeyCredential
+	return w
 }
 
 // Handle OAuth metadata endpoint
 func (w *OAuthWrapper) handleMetadata(rw http.ResponseWriter, r *http.Request) {
-	metadata := OAuth2Metadata{
-		Issuer:                w.publicURL,
-		AuthorizationEndpoint: w.publicURL + "/authorize",
-		TokenEndpoint:         w.publicURL + "/token",
-		ResponseTypesSupported: []string{"code"},
-		GrantTypesSupported:    []string{"authorization_code"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "client_secret_basic"},
+	writeCacheableJSON(rw, r, w.metadata())
+}
+
+// Handle OpenID Connect discovery, for clients that look there instead of the OAuth path
+func (w *OAuthWrapper) handleOpenIDConfiguration(rw http.ResponseWriter, r *http.Request) {
+	config := OpenIDConfiguration{OAuth2Metadata: w.metadata()}
+	if w.oidc {
+		config.UserinfoEndpoint = w.publicURL + "/userinfo"
+		config.JWKSURI = w.publicURL + "/.well-known/jwks.json"
+		config.SubjectTypesSupported = []string{"public"}
+		config.IDTokenSigningAlgValuesSupported = []string{"RS256"}
+		config.EndSessionEndpoint = w.publicURL + "/logout"
 	}
+	writeCacheableJSON(rw, r, config)
+}
 
-	rw.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(rw).Encode(metadata)
+// metadata describes this authorization server (RFC 8414)
+func (w *OAuthWrapper) metadata() OAuth2Metadata {
+	metadata := OAuth2Metadata{
+		Issuer:                            w.publicURL,
+		AuthorizationEndpoint:             w.publicURL + "/authorize",
+		TokenEndpoint:                     w.publicURL + "/token",
+		ResponseTypesSupported:            supportedResponseTypes,
+		GrantTypesSupported:               w.enabledGrants,
+		TokenEndpointAuthMethodsSupported: supportedAuthMethods,
+		TokenEndpointAuthSigningAlgs:      supportedAssertionAlgs,
+		CodeChallengeMethodsSupported:     supportedCodeChallengeMethods,
+	}
+	if w.dpop {
+		metadata.DPoPSigningAlgs = supportedDPoPAlgs
+	}
+	metadata.CertBoundAccessTokens = w.certBoundTokens
+	return metadata
 }
 
 // Handle client registration
 func (w *OAuthWrapper) handleRegistration(rw http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	// Protected registration: require the initial access token when one is configured
+	if regToken := w.currentSecrets().RegistrationToken; regToken != "" {
+		token, ok := bearerToken(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(regToken)) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeJSONError(rw, http.StatusUnauthorized, "invalid_token", "A valid initial access token is required to register clients")
+			return
+		}
 	}
 
 	var req ClientRegistrationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			writeJSONError(rw, http.StatusRequestEntityTooLarge, "invalid_request", "Request body too large")
+			return
+		}
 		http.Error(rw, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Generate client credentials
-	clientID := generateRandomString(32)
-	clientSecret := generateRandomString(64)
+	if err := validateRegistration(&req); err != nil {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+	if err := w.checkGrantTypes(req.GrantTypes); err != nil {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+	if err := w.checkRedirectSchemes(req.RedirectURIs); err != nil {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+		return
+	}
+	if err := w.checkRedirectHosts(req.RedirectURIs); err != nil {
+		slog.WarnContext(r.Context(), "Client registration rejected, redirect host not allowed", "redirect_uris", req.RedirectURIs)
+		writeJSONError(rw, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+		return
+	}
+
+	authMethod := req.TokenEndpointAuthMethod
+	if authMethod == "" {
+		authMethod = "client_secret_basic"
+	}
+
+	// Generate the client secret; public and private_key_jwt clients get none. The client ID is
+	// generated when the client is stored, so it can be checked against registered clients.
+	clientSecret := ""
+	secretExpiresAt := 0 // 0 means the secret never expires
+	issuedAt := w.now()
+	if authMethod != "none" && authMethod != authMethodPrivateKeyJWT {
+		clientSecret = generateRandomString(w.secretLength)
+		if w.clientSecretTTL > 0 {
+			secretExpiresAt = int(issuedAt.Add(w.clientSecretTTL).Unix())
+		}
+	}
 
 	response := &ClientRegistrationResponse{
-		ClientID:              clientID,
-		ClientSecret:          clientSecret,
-		ClientName:            req.ClientName,
-		RedirectURIs:          req.RedirectURIs,
-		GrantTypes:            []string{"authorization_code"},
-		ResponseTypes:         []string{"code"},
-		ClientIDIssuedAt:      time.Now().Unix(),
-		ClientSecretExpiresAt: 0, // Never expires
+		ClientSecret:            clientSecret,
+		ClientName:              req.ClientName,
+		RedirectURIs:            req.RedirectURIs,
+		GrantTypes:              negotiateTypes(req.GrantTypes, w.enabledGrants),
+		ResponseTypes:           negotiateTypes(req.ResponseTypes, supportedResponseTypes),
+		TokenEndpointAuthMethod: authMethod,
+		JWKS:                    req.JWKS,
+		JWKSURI:                 req.JWKSURI,
+		ClientIDIssuedAt:        issuedAt.Unix(),
+		ClientSecretExpiresAt:   secretExpiresAt,
+		ClientURI:               req.ClientURI,
+		LogoURI:                 req.LogoURI,
+		Contacts:                req.Contacts,
+		Metadata:                req.Metadata,
+		Extensions:              req.Extensions,
 	}
 
 	// Store client
 	w.mu.Lock()
+	if w.maxClients > 0 && len(w.clients) >= w.maxClients {
+		w.mu.Unlock()
+		slog.WarnContext(r.Context(), "Client registration rejected, limit reached", "max_clients", w.maxClients)
+		writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "Maximum number of registered clients reached")
+		return
+	}
+	clientID, err := w.newClientID()
+	if err != nil {
+		w.mu.Unlock()
+		slog.ErrorContext(r.Context(), "Client registration failed, could not generate a client ID", "error", err)
+		writeJSONError(rw, http.StatusInternalServerError, "server_error", "Could not generate a client ID")
+		return
+	}
+	response.ClientID = clientID
 	w.clients[clientID] = response
+	registeredClients.Set(int64(len(w.clients)))
 	w.mu.Unlock()
 
-	log.Printf("Registered new client: %s (%s)", clientID, req.ClientName)
+	slog.InfoContext(r.Context(), "Registered new client", "client_id", clientID, "client_name", req.ClientName)
+	w.notifyRegistration(r, response)
+	w.notifySlack(fmt.Sprintf("New OAuth client registered: *%s* (`%s`) at %s", slackEscape(req.ClientName), clientID, w.now().UTC().Format(time.RFC3339)))
 
 	rw.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(rw).Encode(response)
 }
 
-// Handle authorization request
-func (w *OAuthWrapper) handleAuthorize(rw http.ResponseWriter, r *http.Request) {
-	clientID := r.URL.Query().Get("client_id")
-	redirectURI := r.URL.Query().Get("redirect_uri")
-	responseType := r.URL.Query().Get("response_type")
-	state := r.URL.Query().Get("state")
+// Validate client metadata so broken registrations are rejected up front
+func validateRegistration(req *ClientRegistrationRequest) error {
+	if strings.TrimSpace(req.ClientName) == "" {
+		return errors.New("client_name is required")
+	}
+	if len(req.ClientName) > maxClientNameLength {
+		return fmt.Errorf("client_name must be at most %d characters", maxClientNameLength)
+	}
 
-	// Validate client
-	w.mu.RLock()
-	client, exists := w.clients[clientID]
-	w.mu.RUnlock()
+	if len(req.RedirectURIs) == 0 {
+		return errors.New("redirect_uris must contain at least one URI")
+	}
+	public := req.TokenEndpointAuthMethod == "none"
+	for _, uri := range req.RedirectURIs {
+		if err := validateRedirectURI(uri, public); err != nil {
+			return err
+		}
+	}
 
-	if !exists {
-		http.Error(rw, "Invalid client_id", http.StatusBadRequest)
-		return
+	for _, grantType := range req.GrantTypes {
+		if !slices.Contains(supportedGrantTypes, grantType) {
+			return fmt.Errorf("unsupported grant_type %q", grantType)
+		}
+	}
+	for _, responseType := range req.ResponseTypes {
+		if !slices.Contains(supportedResponseTypes, responseType) {
+			return fmt.Errorf("unsupported response_type %q", responseType)
+		}
 	}
+	if req.TokenEndpointAuthMethod != "" && !slices.Contains(supportedAuthMethods, req.TokenEndpointAuthMethod) {
+		return fmt.Errorf("unsupported token_endpoint_auth_method %q", req.TokenEndpointAuthMethod)
+	}
+	if err := validateClientKeys(req); err != nil {
+		return err
+	}
+	return validateClientMetadata(req)
+}
 
-	// Validate redirect URI
-	validRedirect := false
-	for _, uri := range client.RedirectURIs {
-		if uri == redirectURI {
-			validRedirect = true
-			break
+// negotiateTypes returns the requested values the server supports, in request order and without
+// duplicates, or everything supported when the client asked for nothing. validateRegistration has
+// already rejected unsupported values, so this only drops what the client didn't ask for.
+func negotiateTypes(requested, supported []string) []string {
+	if len(requested) == 0 {
+		return slices.Clone(supported)
+	}
+	var granted []string
+	for _, value := range requested {
+		if slices.Contains(supported, value) && !slices.Contains(granted, value) {
+			granted = append(granted, value)
 		}
 	}
+	return granted
+}
 
-	if !validRedirect {
-		http.Error(rw, "Invalid redirect_uri", http.StatusBadRequest)
+// Handle authorization request
+func (w *OAuthWrapper) handleAuthorize(rw http.ResponseWriter, r *http.Request) {
+	redirectURL, err := w.authorize(authorizeRequestFromQuery(r.URL.Query()))
+	if rerr, ok := err.(*redirectError); ok {
+		http.Redirect(rw, r, rerr.Redirect.String(), http.StatusFound)
 		return
 	}
-
-	if responseType != "code" {
-		http.Error(rw, "Unsupported response_type", http.StatusBadRequest)
+	if err != nil {
+		writeError(rw, err)
 		return
 	}
+	http.Redirect(rw, r, redirectURL.String(), http.StatusFound)
+}
 
-	// Generate authorization code
-	authCode := generateRandomString(32)
+// Handle token exchange
+func (w *OAuthWrapper) handleToken(rw http.ResponseWriter, r *http.Request) {
+	// Parse form data
+	if err := r.ParseForm(); err != nil {
+		if isBodyTooLarge(err) {
+			writeJSONError(rw, http.StatusRequestEntityTooLarge, "invalid_request", "Request body too large")
+			return
+		}
+		http.Error(rw, "Invalid request", http.StatusBadRequest)
+		return
+	}
 
-	// Store auth code
-	w.mu.Lock()
-	w.authCodes[authCode] = &AuthCode{
-		ClientID:    clientID,
-		RedirectURI: redirectURI,
-		ExpiresAt:   time.Now().Add(10 * time.Minute),
+	req := tokenRequestFromForm(r)
+	setRequestClient(r.Context(), req.ClientID)
+	proof, err := dpopProofFrom(r.Header)
+	if err != nil {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+		return
+	}
+	req.DPoPProof = proof
+	if w.certBoundTokens {
+		req.ClientCertThumbprint = clientCertThumbprint(r)
 	}
-	w.mu.Unlock()
 
-	// Redirect back to client with auth code
-	redirectURL, _ := url.Parse(redirectURI)
-	q := redirectURL.Query()
-	q.Set("code", authCode)
-	if state != "" {
-		q.Set("state", state)
+	response, err := w.exchangeCode(req)
+	if err != nil {
+		writeError(rw, err)
+		return
 	}
-	redirectURL.RawQuery = q.Encode()
 
-	http.Redirect(rw, r, redirectURL.String(), http.StatusFound)
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(response)
 }
 
-// Handle OAuth callback (not typically used, but included for completeness)
-func (w *OAuthWrapper) handleCallback(rw http.ResponseWriter, r *http.Request) {
-	// This endpoint is typically not used in this flow
-	// Claude Teams will handle the callback on their side
-	rw.WriteHeader(http.StatusOK)
-	fmt.Fprintf(rw, "OAuth callback received")
-}
+// Proxy MCP requests to the MCP server, for both transports: the /sse stream and its /message
+// POSTs, and Streamable HTTP on /mcp. Validation is shared; the connection limits apply to streams.
+func (w *OAuthWrapper) handleSSEProxy(rw http.ResponseWriter, r *http.Request) {
+	if !w.ticketAuthorization(rw, r) {
+		return
+	}
+	token, accessToken, ok := w.authenticate(rw, r, w.proxyResource(r.URL.Path))
+	if !ok || !w.requireScope(rw, r, accessToken) || !w.checkProtocolVersion(rw, r) {
+		return
+	}
+	// Authenticated streams may stay open, or wait out a backend restart, for longer than the server
+	// timeouts allow; messages keep a capped body and the read timeout on their upload
+	if r.Method == http.MethodGet {
+		clearDeadlines(rw)
+	} else if !w.limitMessageBody(rw, r) {
+		return
+	}
 
-// Handle token exchange
-func (w *OAuthWrapper) handleToken(rw http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+	transport := proxyTransport(r.URL.Path)
+
+	if w.draining.Load() && opensSession(r) {
+		rw.Header().Set("Retry-After", "5")
+		http.Error(rw, "Server is draining connections", http.StatusServiceUnavailable)
 		return
 	}
 
-	// Parse form data
-	if err := r.ParseForm(); err != nil {
-		http.Error(rw, "Invalid request", http.StatusBadRequest)
+	// Never serve a workspace other than the one this deployment is meant for
+	if !w.teamVerified() {
+		writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "The Slack workspace behind this server could not be verified")
 		return
 	}
 
-	grantType := r.FormValue("grant_type")
-	if grantType != "authorization_code" {
-		http.Error(rw, "Unsupported grant_type", http.StatusBadRequest)
+	// Ride out a backend restart instead of failing the connection straight away
+	if !w.awaitBackend(r.Context()) {
+		if r.Context().Err() == nil {
+			slog.WarnContext(r.Context(), "MCP server not ready within the SSE ready wait", "sse_ready_wait", w.sseReadyWait)
+			rw.Header().Set("Retry-After", "1")
+			http.Error(rw, "MCP server is not ready", http.StatusServiceUnavailable)
+		}
 		return
 	}
 
-	code := r.FormValue("code")
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
-	redirectURI := r.FormValue("redirect_uri")
+	// Streams (GET on either transport) hold a connection open; messages come and go
+	if r.Method == http.MethodGet {
+		// Enforce the per-token SSE connection limit
+		if !w.acquireSSESlot(token) {
+			http.Error(rw, "Too many concurrent SSE connections", http.StatusTooManyRequests)
+			return
+		}
+		// Release the slot as soon as the client goes away, even if the proxy is still unwinding
+		release := sync.OnceFunc(func() { w.releaseSSESlot(token) })
+		context.AfterFunc(r.Context(), release)
+		defer release()
 
-	// Check for basic auth if not in form
-	if clientID == "" || clientSecret == "" {
-		if user, pass, ok := r.BasicAuth(); ok {
-			clientID = user
-			clientSecret = pass
+		// Protect the backend from more sessions than it can hold
+		if !w.acquireBackendSlot() {
+			slog.WarnContext(r.Context(), "SSE connection rejected, backend connection limit reached", "max_backend_connections", cap(w.backendSlots))
+			rw.Header().Set("Retry-After", "5")
+			http.Error(rw, "MCP server is at its connection limit", http.StatusServiceUnavailable)
+			return
 		}
-	}
+		releaseBackend := sync.OnceFunc(w.releaseBackendSlot)
+		context.AfterFunc(r.Context(), releaseBackend)
+		defer releaseBackend()
 
-	// Validate client
-	w.mu.RLock()
-	client, exists := w.clients[clientID]
-	w.mu.RUnlock()
+		proxyStreams.Add(transport, 1)
+		defer proxyStreams.Add(transport, -1)
+		// Streams are left out of the request durations; how long they stay open is tracked here
+		defer func(opened time.Time) { proxyStreamSeconds.Observe(time.Since(opened).Seconds()) }(time.Now())
+	}
 
-	if !exists || client.ClientSecret != clientSecret {
-		http.Error(rw, "Invalid client credentials", http.StatusUnauthorized)
+	proxy, err := w.reverseProxy()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Invalid MCP server URL", "url", w.mcpURL, "error", err)
+		writeJSONError(rw, http.StatusInternalServerError, "server_error", "MCP server URL is misconfigured")
 		return
 	}
 
-	// Validate auth code
-	w.mu.Lock()
-	authCode, exists := w.authCodes[code]
-	if exists {
-		delete(w.authCodes, code) // Use once only
+	// Start MCP server if not already running
+	go w.ensureMCPServerRunning()
+
+	// Tie the upstream request to the client connection so a disconnect cancels the backend call
+	ctx, cancel := context.WithCancel(withAccessToken(r.Context(), accessToken))
+	defer cancel()
+
+	// Close the stream if all tokens are revoked while it is open
+	killed := w.streamKill.current()
+	go func() {
+		select {
+		case <-killed:
+			slog.WarnContext(r.Context(), "Closing SSE connection after all tokens were revoked", "client_id", accessToken.ClientID)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Close the stream if it goes quiet in both directions
+	idle := newIdleTimer(w.sseIdleTimeout, func() {
+		slog.InfoContext(r.Context(), "Closing idle SSE connection", "client_id", accessToken.ClientID, "idle_timeout", w.sseIdleTimeout)
+		cancel()
+	})
+	defer idle.stop()
+
+	// Proxy the request
+	r = r.WithContext(ctx)
+	if r.Body != nil {
+		r.Body = &idleReadCloser{ReadCloser: r.Body, idle: idle}
 	}
-	w.mu.Unlock()
+	// Keep intermediaries from timing out a quiet stream; heartbeats don't count as activity
+	heartbeats := newHeartbeatWriter(rw, w.sseHeartbeatInterval)
+	defer heartbeats.stop()
+	// Only requests that reach the backend count as uses; refusals above don't
+	accessToken.countUse()
+	proxyRequestsTotal.Inc(transport)
+	proxy.ServeHTTP(&idleResponseWriter{ResponseWriter: heartbeats, idle: idle}, r)
+}
 
-	if !exists || authCode.ClientID != clientID || authCode.RedirectURI != redirectURI {
-		http.Error(rw, "Invalid authorization code", http.StatusBadRequest)
-		return
+// hasTokenCapacity reports whether another access token may be issued, evicting expired tokens
+// first when the cap is reached. The cap is soft: concurrent exchanges may overshoot it slightly.
+func (w *OAuthWrapper) hasTokenCapacity() bool {
+	if w.maxTokens <= 0 || w.accessTokens.Len() < w.maxTokens {
+		return true
+	}
+	w.purgeExpiredTokens()
+	return w.accessTokens.Len() < w.maxTokens
+}
+
+// purgeExpiredTokens drops every expired access token and returns how many were removed
+func (w *OAuthWrapper) purgeExpiredTokens() int {
+	now := w.now()
+	var expired []string
+	w.accessTokens.Range(func(token string, at *AccessToken) bool {
+		if at.expired(now, w.tokenIdleTTL, w.clockSkew) {
+			expired = append(expired, token)
+		}
+		return true
+	})
+	for _, token := range expired {
+		w.accessTokens.Delete(token)
 	}
+	accessTokensGauge.Set(int64(w.accessTokens.Len()))
 
-	if time.Now().After(authCode.ExpiresAt) {
-		http.Error(rw, "Authorization code expired", http.StatusBadRequest)
-		return
+	if len(expired) > 0 {
+		slog.Info("Purged expired access tokens", "count", len(expired))
 	}
+	return len(expired)
+}
 
-	// Generate access token
-	accessToken := generateRandomString(64)
+// acquireSSESlot registers a new SSE stream for the token, reporting false when the limit is reached
+func (w *OAuthWrapper) acquireSSESlot(token string) bool {
+	w.sseMu.Lock()
+	defer w.sseMu.Unlock()
 
-	// Store access token
-	w.mu.Lock()
-	w.accessTokens[accessToken] = &AccessToken{
-		ClientID:  clientID,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+	if w.maxSSEPerToken > 0 && w.sseConns[token] >= w.maxSSEPerToken {
+		return false
 	}
-	w.mu.Unlock()
+	w.sseConns[token]++
+	sseConnections.Inc()
+	return true
+}
 
-	// Return token response
-	response := TokenResponse{
-		AccessToken: accessToken,
-		TokenType:   "Bearer",
-		ExpiresIn:   86400, // 24 hours
+// releaseSSESlot unregisters an SSE stream previously acquired for the token
+func (w *OAuthWrapper) releaseSSESlot(token string) {
+	w.sseMu.Lock()
+	defer w.sseMu.Unlock()
+
+	if w.sseConns[token] <= 1 {
+		delete(w.sseConns, token)
+	} else {
+		w.sseConns[token]--
 	}
+	sseConnections.Dec()
+}
 
-	rw.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(rw).Encode(response)
+// acquireBackendSlot takes one of the global backend connection slots without waiting,
+// reporting false when all are in use
+func (w *OAuthWrapper) acquireBackendSlot() bool {
+	if w.backendSlots == nil {
+		return true
+	}
+	select {
+	case w.backendSlots <- struct{}{}:
+		backendConnectionsInUse.Inc()
+		return true
+	default:
+		return false
+	}
 }
 
-// Proxy SSE requests to MCP server
-func (w *OAuthWrapper) handleSSEProxy(rw http.ResponseWriter, r *http.Request) {
-	// Validate access token
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+// releaseBackendSlot returns a slot taken by acquireBackendSlot
+func (w *OAuthWrapper) releaseBackendSlot() {
+	if w.backendSlots == nil {
 		return
 	}
+	<-w.backendSlots
+	backendConnectionsInUse.Dec()
+}
 
-	token := strings.TrimPrefix(authHeader, "Bearer ")
+// authenticate validates the bearer access token presented for resource and records its use.
+// An empty resource skips the audience check. On failure it writes the 401 response and returns false.
+func (w *OAuthWrapper) authenticate(rw http.ResponseWriter, r *http.Request, resource string) (string, *AccessToken, bool) {
+	scheme, token := authorization(r)
+	if scheme != tokenTypeBearer && scheme != tokenTypeDPoP {
+		w.writeTokenError(rw, resource, &oauthError{http.StatusUnauthorized, "invalid_request", "Missing access token; send it as Authorization: Bearer <token>"}, false)
+		return "", nil, false
+	}
+	if !validAccessTokenSyntax(token) {
+		w.writeTokenError(rw, resource, &oauthError{http.StatusBadRequest, "invalid_request", "Malformed access token"}, true)
+		return "", nil, false
+	}
 
-	w.mu.RLock()
-	accessToken, exists := w.accessTokens[token]
-	w.mu.RUnlock()
+	accessToken, exists := w.accessTokens.Get(token)
+	if !exists {
+		w.writeTokenError(rw, resource, &oauthError{http.StatusUnauthorized, "invalid_token", "Access token is unknown or has been revoked"}, true)
+		return "", nil, false
+	}
+	if accessToken.expired(w.now(), w.tokenIdleTTL, w.clockSkew) {
+		w.writeTokenError(rw, resource, &oauthError{http.StatusUnauthorized, "invalid_token", "Access token has expired"}, true)
+		return "", nil, false
+	}
 
-	if !exists || time.Now().After(accessToken.ExpiresAt) {
-		http.Error(rw, "Invalid or expired token", http.StatusUnauthorized)
-		return
+	// Reject tokens issued for a different resource
+	if resource != "" && !w.audienceAllows(accessToken.Audience, resource) {
+		w.writeTokenError(rw, resource, &oauthError{http.StatusUnauthorized, "invalid_token", "Token audience does not match this resource"}, true)
+		return "", nil, false
 	}
 
-	// Create reverse proxy to MCP server
-	target, _ := url.Parse(w.mcpURL + "/sse")
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	// Modify request to remove OAuth token and add MCP auth if configured
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		
-		// Remove OAuth token
-		req.Header.Del("Authorization")
-		
-		// Add MCP SSE API key if configured
-		if sseAPIKey := os.Getenv("SLACK_MCP_SSE_API_KEY"); sseAPIKey != "" {
-			req.Header.Set("Authorization", "Bearer "+sseAPIKey)
-		}
+	// Reject tokens presented from a different browser origin than they were issued to
+	if !originAllows(accessToken.BoundOrigin, r.Header.Get("Origin")) {
+		w.writeTokenError(rw, resource, &oauthError{http.StatusUnauthorized, "invalid_token", "Token is not valid from this origin"}, true)
+		return "", nil, false
 	}
 
-	// Start MCP server if not already running
-	go w.ensureMCPServerRunning()
+	// Tokens must be sent with the scheme of their type, and sender-constrained tokens only with a
+	// proof of the bound key
+	if oerr := w.checkDPoPBinding(r, token, accessToken, scheme); oerr != nil {
+		rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`DPoP error=%q, error_description=%q, algs="%s"`, oerr.Code, oerr.Description, strings.Join(supportedDPoPAlgs, " ")))
+		oerr.write(rw)
+		return "", nil, false
+	}
+	if oerr := checkCertBinding(r, accessToken); oerr != nil {
+		w.writeTokenError(rw, resource, oerr, true)
+		return "", nil, false
+	}
 
-	// Proxy the request
-	proxy.ServeHTTP(rw, r)
+	accessToken.touch(w.now())
+	setRequestClient(r.Context(), accessToken.ClientID)
+	return token, accessToken, true
 }
 
 // Ensure MCP server is running
 func (w *OAuthWrapper) ensureMCPServerRunning() {
 	// Check if MCP server is already running
-	resp, err := http.Get(w.mcpURL + "/health")
-	if err == nil && resp.StatusCode == http.StatusOK {
-		resp.Body.Close()
+	err := w.checkMCPHealth(context.Background())
+	if err == nil {
 		return
 	}
 
 	// MCP server should be started by the start script
 	// This is just a health check
-	log.Printf("Warning: MCP server may not be running at %s", w.mcpURL)
+	slog.Warn("MCP server may not be running", "url", w.mcpURL, "error", err)
 }
 
 // Health check endpoint
@@ -409,9 +1105,87 @@ func (w *OAuthWrapper) handleHealth(rw http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(rw, "OK")
 }
 
+// Extract the bearer token from the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token := authorization(r)
+	return token, scheme == tokenTypeBearer
+}
+
+// authorization splits the Authorization header into its scheme and credentials. Schemes are
+// case-insensitive (RFC 9110 section 11.1), so the known token types are returned in canonical form.
+func authorization(r *http.Request) (scheme, credentials string) {
+	scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok {
+		return "", ""
+	}
+	for _, known := range []string{tokenTypeBearer, tokenTypeDPoP} {
+		if strings.EqualFold(scheme, known) {
+			return known, credentials
+		}
+	}
+	return scheme, credentials
+}
+
+// writeTokenError rejects a request to a protected resource as RFC 6750 describes: a JSON error body
+// and a Bearer challenge that carries the error, except when no token was presented at all (section 3.1).
+// Extra challenge parameters, such as the required scope, follow the error.
+func (w *OAuthWrapper) writeTokenError(rw http.ResponseWriter, resource string, oerr *oauthError, presented bool, extra ...string) {
+	var params []string
+	if presented {
+		params = append(params, fmt.Sprintf("error=%q", oerr.Code), fmt.Sprintf("error_description=%q", oerr.Description))
+	}
+	params = append(params, extra...)
+	rw.Header().Set("WWW-Authenticate", w.bearerChallenge(resource, params...))
+	oerr.write(rw)
+}
+
+// validAccessTokenSyntax checks a presented token against the b64token syntax of RFC 6750 section 2.1
+func validAccessTokenSyntax(token string) bool {
+	trimmed := strings.TrimRight(token, "=")
+	if trimmed == "" {
+		return false
+	}
+	for _, c := range trimmed {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~+/", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Write an OAuth-style JSON error body
+func writeJSONError(rw http.ResponseWriter, status int, code, description string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// Build information endpoint
+func (w *OAuthWrapper) handleVersion(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(buildInfo())
+}
+
+// Lengths of generated random strings. Each character is one base64url symbol (6 bits); codes,
+// tokens and secrets are configurable between minRandomLength and maxRandomLength.
+const (
+	defaultCodeLength   = 32
+	defaultTokenLength  = 64
+	defaultSecretLength = 64
+	clientIDLength      = 32
+	requestIDLength     = 16
+
+	// 32 characters is 192 bits, comfortably past guessing; the cap keeps URLs and headers sane
+	minRandomLength = 32
+	maxRandomLength = 512
+)
+
 // Generate random string for tokens and codes
 func generateRandomString(length int) string {
 	bytes := make([]byte, length)
 	rand.Read(bytes)
 	return base64.URLEncoding.EncodeToString(bytes)[:length]
-}
\ No newline at end of file
+}
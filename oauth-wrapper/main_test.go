@@ -0,0 +1,689 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWrapper(mcpURL string) *OAuthWrapper {
+	w := newOAuthWrapper(&Config{
+		MCPURL:          mcpURL,
+		HealthPath:      "/health",
+		HealthMode:      healthModeHTTP,
+		PublicURL:       "http://localhost:8080",
+		TokenTTL:        time.Hour,
+		MaxBodyBytes:    8 << 10,
+		MaxMessageBytes: 1 << 20,
+		CodeLength:      defaultCodeLength,
+		TokenLength:     defaultTokenLength,
+		SecretLength:    defaultSecretLength,
+	})
+	w.started.Store(true)
+	return w
+}
+
+func decodeJSONError(t *testing.T, rec *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	return body
+}
+
+func TestHandleAuthorizeMalformedRedirectURI(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	badURI := "http://[::1%zz]/callback"
+	w.clients["client"] = &ClientRegistrationResponse{
+		ClientID:     "client",
+		RedirectURIs: []string{badURI},
+	}
+
+	q := url.Values{}
+	q.Set("client_id", "client")
+	q.Set("redirect_uri", badURI)
+	q.Set("response_type", "code")
+	req := httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+
+	w.handleAuthorize(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if body := decodeJSONError(t, rec); body["error"] != "invalid_request" {
+		t.Errorf("expected invalid_request error, got %q", body["error"])
+	}
+	if len(w.authCodes) != 0 {
+		t.Errorf("expected no auth code to be issued, got %d", len(w.authCodes))
+	}
+}
+
+func TestHandleSSEProxyMalformedMCPURL(t *testing.T) {
+	w := newTestWrapper("http://bad host:13080")
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+
+	w.handleSSEProxy(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	if body := decodeJSONError(t, rec); body["error"] != "server_error" {
+		t.Errorf("expected server_error, got %q", body["error"])
+	}
+	if len(w.sseConns) != 0 {
+		t.Errorf("expected SSE slot to be released, got %v", w.sseConns)
+	}
+}
+
+func TestHandleSSEProxyCancelsBackendOnClientDisconnect(t *testing.T) {
+	backendCanceled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sse" {
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(rw, "event: endpoint\ndata: /message\n\n")
+		rw.(http.Flusher).Flush()
+
+		// Stream forever until the wrapper cancels us
+		<-r.Context().Done()
+		close(backendCanceled)
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	wrapperServer := httptest.NewServer(http.HandlerFunc(w.handleSSEProxy))
+	defer wrapperServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, wrapperServer.URL+"/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "event: endpoint") {
+		t.Fatalf("expected the first event from the backend, got %q (%v)", line, err)
+	}
+
+	cancel()
+
+	select {
+	case <-backendCanceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend request was not canceled after the client disconnected")
+	}
+}
+
+func TestHandleRegistrationRequiresInitialAccessToken(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.secrets.Store(&secrets{RegistrationToken: "initial-token"})
+	body := `{"client_name":"Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"]}`
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", "Bearer nope", http.StatusUnauthorized},
+		{"valid", "Bearer initial-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			w.handleRegistration(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestValidateRegistration(t *testing.T) {
+	valid := func() ClientRegistrationRequest {
+		return ClientRegistrationRequest{
+			ClientName:   "Claude",
+			RedirectURIs: []string{"https://claude.ai/api/mcp/auth_callback"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*ClientRegistrationRequest)
+		wantErr bool
+	}{
+		{"valid", func(*ClientRegistrationRequest) {}, false},
+		{"supported types", func(r *ClientRegistrationRequest) {
+			r.GrantTypes = []string{"authorization_code"}
+			r.ResponseTypes = []string{"code"}
+		}, false},
+		{"missing name", func(r *ClientRegistrationRequest) { r.ClientName = " " }, true},
+		{"long name", func(r *ClientRegistrationRequest) { r.ClientName = strings.Repeat("a", maxClientNameLength+1) }, true},
+		{"no redirect uris", func(r *ClientRegistrationRequest) { r.RedirectURIs = nil }, true},
+		{"relative redirect uri", func(r *ClientRegistrationRequest) { r.RedirectURIs = []string{"/callback"} }, true},
+		{"fragment in redirect uri", func(r *ClientRegistrationRequest) { r.RedirectURIs = []string{"https://a.example/cb#x"} }, true},
+		{"userinfo in redirect uri", func(r *ClientRegistrationRequest) { r.RedirectURIs = []string{"https://user@a.example/cb"} }, true},
+		{"custom scheme for public client", func(r *ClientRegistrationRequest) {
+			r.TokenEndpointAuthMethod = "none"
+			r.RedirectURIs = []string{"com.example.app:/oauth/callback", "myapp://callback"}
+		}, false},
+		{"custom scheme for confidential client", func(r *ClientRegistrationRequest) { r.RedirectURIs = []string{"myapp://callback"} }, true},
+		{"javascript redirect uri", func(r *ClientRegistrationRequest) {
+			r.TokenEndpointAuthMethod = "none"
+			r.RedirectURIs = []string{"javascript://a.example/%0aalert(1)"}
+		}, true},
+		{"data redirect uri", func(r *ClientRegistrationRequest) {
+			r.TokenEndpointAuthMethod = "none"
+			r.RedirectURIs = []string{"data:text/html,hi"}
+		}, true},
+		{"unsupported grant", func(r *ClientRegistrationRequest) { r.GrantTypes = []string{"password"} }, true},
+		{"unsupported response type", func(r *ClientRegistrationRequest) { r.ResponseTypes = []string{"token"} }, true},
+		{"descriptive metadata", func(r *ClientRegistrationRequest) {
+			r.ClientURI = "https://claude.ai"
+			r.LogoURI = "https://claude.ai/logo.png"
+			r.Contacts = []string{"ops@example.com"}
+			r.Metadata = map[string]string{"owner": "ops@example.com", "environment": "prod"}
+		}, false},
+		{"non-web client uri", func(r *ClientRegistrationRequest) { r.ClientURI = "javascript:alert(1)" }, true},
+		{"too many contacts", func(r *ClientRegistrationRequest) {
+			r.Contacts = slices.Repeat([]string{"a@example.com"}, maxClientContacts+1)
+		}, true},
+		{"empty metadata key", func(r *ClientRegistrationRequest) { r.Metadata = map[string]string{"": "x"} }, true},
+		{"long metadata value", func(r *ClientRegistrationRequest) {
+			r.Metadata = map[string]string{"description": strings.Repeat("a", maxClientMetadataValueLength+1)}
+		}, true},
+		{"large unknown fields", func(r *ClientRegistrationRequest) {
+			r.Extensions = map[string]json.RawMessage{"software_statement": json.RawMessage(`"` + strings.Repeat("a", maxClientExtensionBytes) + `"`)}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+			if err := validateRegistration(&req); (err != nil) != tt.wantErr {
+				t.Errorf("validateRegistration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleRegistrationNegotiatesTypes(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+
+	tests := []struct {
+		name              string
+		extra             string
+		status            int
+		wantGrantTypes    []string
+		wantResponseTypes []string
+	}{
+		{"defaults", ``, http.StatusOK, supportedGrantTypes, supportedResponseTypes},
+		{"duplicates collapsed", `,"grant_types":["authorization_code","authorization_code"],"response_types":["code"]`, http.StatusOK, []string{"authorization_code"}, []string{"code"}},
+		{"unsupported grant", `,"grant_types":["authorization_code","password"]`, http.StatusBadRequest, nil, nil},
+		{"unsupported response type", `,"response_types":["token"]`, http.StatusBadRequest, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"client_name":"Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"]` + tt.extra + `}`
+			rec := httptest.NewRecorder()
+			w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				if got := decodeJSONError(t, rec)["error"]; got != "invalid_client_metadata" {
+					t.Errorf("expected invalid_client_metadata, got %q", got)
+				}
+				return
+			}
+
+			var resp ClientRegistrationResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(resp.GrantTypes, tt.wantGrantTypes) || !slices.Equal(resp.ResponseTypes, tt.wantResponseTypes) {
+				t.Errorf("got grant_types %v and response_types %v", resp.GrantTypes, resp.ResponseTypes)
+			}
+		})
+	}
+}
+
+func TestHasTokenCapacityPurgesExpiredTokens(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.maxTokens = 2
+	w.accessTokens.Set("expired", &AccessToken{ExpiresAt: time.Now().Add(-time.Minute)})
+	w.accessTokens.Set("live", &AccessToken{ExpiresAt: time.Now().Add(time.Hour)})
+
+	if !w.hasTokenCapacity() {
+		t.Fatal("expected capacity after purging the expired token")
+	}
+	if _, ok := w.accessTokens.Get("expired"); ok {
+		t.Error("expected the expired token to be purged")
+	}
+
+	w.accessTokens.Set("live2", &AccessToken{ExpiresAt: time.Now().Add(time.Hour)})
+	if w.hasTokenCapacity() {
+		t.Error("expected no capacity with two live tokens")
+	}
+}
+
+func TestOversizedBodiesAreRejected(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.maxBodyBytes = 64
+	handler := w.routes()
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/register", "application/json", `{"client_name":"` + strings.Repeat("a", 128) + `"}`},
+		{"/token", "application/x-www-form-urlencoded", "grant_type=authorization_code&code=" + strings.Repeat("a", 128)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("expected 413, got %d: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestPublicClientFlowRequiresPKCE(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	handler := w.routes()
+	redirectURI := "https://app.example/callback"
+
+	// Register a public client
+	body := `{"client_name":"Native","redirect_uris":["` + redirectURI + `"],"token_endpoint_auth_method":"none"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+	var client ClientRegistrationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&client); err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	if client.ClientSecret != "" {
+		t.Fatal("public clients must not receive a secret")
+	}
+
+	authorize := func(extra url.Values) *httptest.ResponseRecorder {
+		q := url.Values{"client_id": {client.ClientID}, "redirect_uri": {redirectURI}, "response_type": {"code"}}
+		for k, v := range extra {
+			q[k] = v
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil))
+		return rec
+	}
+
+	if rec := authorize(nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected authorize without PKCE to fail, got %d", rec.Code)
+	}
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	rec = authorize(url.Values{
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	})
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d: %s", rec.Code, rec.Body)
+	}
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	code := location.Query().Get("code")
+
+	exchange := func(verifier string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {client.ClientID},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := exchange(verifier); rec.Code != http.StatusOK {
+		t.Fatalf("expected token exchange to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestVerifyCodeVerifierMismatch(t *testing.T) {
+	sum := sha256.Sum256([]byte(strings.Repeat("a", 43)))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if err := verifyCodeVerifier(challenge, strings.Repeat("b", 43)); err == nil {
+		t.Error("expected a mismatched verifier to fail")
+	}
+	if err := verifyCodeVerifier(challenge, ""); err == nil {
+		t.Error("expected a missing verifier to fail")
+	}
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+
+	fetch := func() map[string]any {
+		rec := httptest.NewRecorder()
+		w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+		var doc map[string]any
+		if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+			t.Fatalf("invalid discovery document: %v", err)
+		}
+		return doc
+	}
+
+	doc := fetch()
+	if doc["issuer"] != w.publicURL || doc["token_endpoint"] != w.publicURL+"/token" {
+		t.Errorf("expected the OAuth metadata fields, got %v", doc)
+	}
+	if _, ok := doc["userinfo_endpoint"]; ok {
+		t.Error("expected no OIDC fields when OIDC mode is off")
+	}
+
+	w.oidc = true
+	doc = fetch()
+	for _, field := range []string{"userinfo_endpoint", "jwks_uri", "subject_types_supported", "id_token_signing_alg_values_supported"} {
+		if _, ok := doc[field]; !ok {
+			t.Errorf("expected %s in OIDC mode", field)
+		}
+	}
+}
+
+func TestAccessTokenIdleExpiry(t *testing.T) {
+	now := time.Now()
+	at := &AccessToken{CreatedAt: now.Add(-3 * time.Hour), ExpiresAt: now.Add(time.Hour)}
+
+	if at.expired(now, 0, 0) {
+		t.Error("without an idle TTL only the absolute expiry applies")
+	}
+	if !at.expired(now, 2*time.Hour, 0) {
+		t.Error("a token never used since issuance should expire after the idle TTL")
+	}
+
+	at.touch(now.Add(-time.Hour))
+	if at.expired(now, 2*time.Hour, 0) {
+		t.Error("a recent use should keep the token alive")
+	}
+
+	at.touch(now)
+	if !at.expired(now.Add(90*time.Minute), 2*time.Hour, 0) {
+		t.Error("the absolute expiry should cap a token that is still in use")
+	}
+}
+
+func TestAuthenticateUsesWrapperClock(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.now = func() time.Time { return now } // follows now as the test advances it
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: now.Add(time.Minute)})
+
+	authenticate := func() bool {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		_, _, ok := w.authenticate(httptest.NewRecorder(), req, "")
+		return ok
+	}
+	if !authenticate() {
+		t.Fatal("expected the token to be valid before its expiry")
+	}
+	if at, _ := w.accessTokens.Get("token"); !at.LastUsedAt().Equal(now) {
+		t.Errorf("expected the use recorded at the wrapper's time, got %v", at.LastUsedAt())
+	}
+
+	now = now.Add(2 * time.Minute)
+	if authenticate() {
+		t.Error("expected the token to expire by the wrapper's clock")
+	}
+	if w.purgeExpiredTokens() != 1 {
+		t.Error("expected the token to be purged by the wrapper's clock")
+	}
+}
+
+func TestClockSkewAcceptsRecentlyExpired(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.clockSkew = time.Minute
+	w.accessTokens.Set("recent", &AccessToken{ClientID: "client", ExpiresAt: now.Add(-30 * time.Second)})
+	w.accessTokens.Set("stale", &AccessToken{ClientID: "client", ExpiresAt: now.Add(-2 * time.Minute)})
+
+	for token, want := range map[string]bool{"recent": true, "stale": false} {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if _, _, ok := w.authenticate(httptest.NewRecorder(), req, ""); ok != want {
+			t.Errorf("token %s: expected accepted=%v, got %v", token, want, ok)
+		}
+	}
+	if w.purgeExpiredTokens() != 1 {
+		t.Error("expected only the token past the skew window to be purged")
+	}
+
+	w.authCodes["code"] = &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, ExpiresAt: now.Add(-30 * time.Second)}
+	if _, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: "code", ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI}); err != nil {
+		t.Errorf("expected a code within the skew window to be exchanged, got %v", err)
+	}
+}
+
+func TestAuthenticateMatchesTokenType(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	for header, want := range map[string]int{
+		"Bearer token": http.StatusOK,
+		"bearer token": http.StatusOK,
+		"DPoP token":   http.StatusUnauthorized,
+		"Basic token":  http.StatusUnauthorized,
+		"token":        http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		w.authenticate(rec, req, "")
+		if rec.Code != want {
+			t.Errorf("Authorization %q: expected %d, got %d", header, want, rec.Code)
+		}
+	}
+	if at, _ := w.accessTokens.Get("token"); at.TokenType() != tokenTypeBearer {
+		t.Errorf("expected an unbound token to be a Bearer token, got %q", at.TokenType())
+	}
+}
+
+func TestAuthenticateErrorResponses(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.accessTokens.Set("live", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	w.accessTokens.Set("stale", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		code          string
+		challenge     string
+	}{
+		{"missing", "", http.StatusUnauthorized, "invalid_request", `Bearer`},
+		{"malformed", "Bearer not a token", http.StatusBadRequest, "invalid_request", `Bearer error="invalid_request", error_description="Malformed access token"`},
+		{"unknown", "Bearer unknown", http.StatusUnauthorized, "invalid_token", `Bearer error="invalid_token", error_description="Access token is unknown or has been revoked"`},
+		{"expired", "Bearer stale", http.StatusUnauthorized, "invalid_token", `Bearer error="invalid_token", error_description="Access token has expired"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			if _, _, ok := w.authenticate(rec, req, ""); ok {
+				t.Fatal("expected the request to be rejected")
+			}
+			if rec.Code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("expected challenge %q, got %q", tt.challenge, got)
+			}
+			if got := decodeJSONError(t, rec); got["error"] != tt.code || got["error_description"] == "" {
+				t.Errorf("expected a %s error body, got %v", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestBackendConnectionLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sse" {
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(rw, "event: endpoint\ndata: /message\n\n")
+		rw.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.backendSlots = make(chan struct{}, 1)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	wrapperServer := httptest.NewServer(http.HandlerFunc(w.handleSSEProxy))
+	defer wrapperServer.Close()
+
+	open := func(ctx context.Context) *http.Response {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, wrapperServer.URL+"/sse", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := open(ctx)
+	defer first.Body.Close()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("expected the first connection to be proxied, got %d", first.StatusCode)
+	}
+
+	second := open(context.Background())
+	second.Body.Close()
+	if second.StatusCode != http.StatusServiceUnavailable || second.Header.Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After while saturated, got %d", second.StatusCode)
+	}
+
+	// Disconnecting frees the slot for the next client
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(w.backendSlots) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	third := open(context.Background())
+	third.Body.Close()
+	if third.StatusCode != http.StatusOK {
+		t.Errorf("expected the released slot to be reused, got %d", third.StatusCode)
+	}
+}
+
+func TestSSEConnectionLimitPerToken(t *testing.T) {
+	backend := sseBackend(t, 0, make(chan time.Time, 3))
+	w := newTestWrapper(backend.URL)
+	w.maxSSEPerToken = 2
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	gaugeBefore := sseConnections.value.Load()
+
+	openStream := func(ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		w.handleSSEProxy(rec, req)
+		return rec
+	}
+	openSlots := func() int {
+		w.sseMu.Lock()
+		defer w.sseMu.Unlock()
+		return w.sseConns["token"]
+	}
+	waitForSlots := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for openSlots() != want || sseConnections.value.Load()-gaugeBefore != int64(want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d open streams, got %d (gauge %d)", want, openSlots(), sseConnections.value.Load()-gaugeBefore)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	cancels := make([]context.CancelFunc, 2)
+	done := make(chan struct{}, 2)
+	for i := range cancels {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		t.Cleanup(cancel)
+		go func() {
+			openStream(ctx)
+			done <- struct{}{}
+		}()
+	}
+	waitForSlots(2)
+
+	if rec := openStream(context.Background()); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 past the per-token limit, got %d", rec.Code)
+	}
+	if openSlots() != 2 {
+		t.Errorf("a refused stream must not take a slot, got %d", openSlots())
+	}
+
+	// A client disconnecting mid-stream gives its slot back
+	cancels[0]()
+	waitForSlots(1)
+	<-done
+
+	cancels[1]()
+	waitForSlots(0)
+	<-done
+	w.sseMu.Lock()
+	defer w.sseMu.Unlock()
+	if _, ok := w.sseConns["token"]; ok {
+		t.Error("expected the token's entry removed once its last stream closed")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// limitMessageBody caps the body of a proxied MCP message (a POST to /message or /mcp) at the
+// configured size, answering 413 straight away when the declared length is already over it; a
+// streamed body going over is cut off and answered 413 by handleProxyError. The write timeout is
+// lifted, since the reply can take as long as the tool call, but the read timeout keeps bounding
+// the upload until the body has been read in full.
+func (w *OAuthWrapper) limitMessageBody(rw http.ResponseWriter, r *http.Request) bool {
+	if r.ContentLength > w.maxMessageBytes {
+		writeJSONError(rw, http.StatusRequestEntityTooLarge, "invalid_request", fmt.Sprintf("Message body exceeds %d bytes", w.maxMessageBytes))
+		return false
+	}
+	rc := http.NewResponseController(rw)
+	rc.SetWriteDeadline(time.Time{})
+	liftReadDeadline := func() { rc.SetReadDeadline(time.Time{}) }
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		liftReadDeadline()
+		return true
+	}
+	r.Body = &uploadBody{ReadCloser: http.MaxBytesReader(rw, r.Body, w.maxMessageBytes), done: sync.OnceFunc(liftReadDeadline)}
+	return true
+}
+
+// uploadBody calls done once the request body has been read to the end
+type uploadBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
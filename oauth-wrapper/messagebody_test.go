@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveWrapper serves w's routes through an http.Server configured from cfg
+func serveWrapper(t *testing.T, w *OAuthWrapper, cfg *Config) string {
+	t.Helper()
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	server := httptest.NewUnstartedServer(nil)
+	server.Config = newServer("", w.routes(), cfg)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// postMessage POSTs body to /mcp with the test token
+func postMessage(t *testing.T, wrapperURL string, body io.Reader, length int64) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, wrapperURL+"/mcp", body)
+	req.ContentLength = length
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// countingBackend counts the message bytes it receives
+func countingBackend(t *testing.T, received *atomic.Int64) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		n, _ := io.Copy(io.Discard, r.Body)
+		received.Add(n)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// zeroReader yields n zero bytes without holding them in memory
+func zeroReader(n int64) io.Reader {
+	return io.LimitReader(zeros{}, n)
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestProxyStreamsLargeMessageBody(t *testing.T) {
+	const size = 32 << 20
+	var received atomic.Int64
+	backend := countingBackend(t, &received)
+	w := newTestWrapper(backend.URL)
+	w.maxMessageBytes = 2 * size
+	wrapperURL := serveWrapper(t, w, &Config{})
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	resp := postMessage(t, wrapperURL, zeroReader(size), -1)
+	runtime.ReadMemStats(&after)
+
+	if resp.StatusCode != http.StatusOK || received.Load() != size {
+		t.Fatalf("expected all %d bytes proxied, got %d with status %d", size, received.Load(), resp.StatusCode)
+	}
+	// Buffering the body anywhere would allocate at least its size
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/2 {
+		t.Errorf("expected the body streamed, but %d bytes were allocated for %d sent", allocated, size)
+	}
+}
+
+func TestProxyMessageBodyLimit(t *testing.T) {
+	const limit = 1 << 20
+	var received atomic.Int64
+	backend := countingBackend(t, &received)
+	w := newTestWrapper(backend.URL)
+	w.maxMessageBytes = limit
+	wrapperURL := serveWrapper(t, w, &Config{})
+
+	if resp := postMessage(t, wrapperURL, zeroReader(limit), -1); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected a body at the limit to be proxied, got %d", resp.StatusCode)
+	}
+
+	// Declared too large: refused before reaching the backend
+	received.Store(0)
+	resp := postMessage(t, wrapperURL, zeroReader(limit+1), limit+1)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || received.Load() != 0 {
+		t.Errorf("expected 413 without contacting the backend, got %d after %d bytes", resp.StatusCode, received.Load())
+	}
+
+	// Streamed without a length: cut off at the limit
+	received.Store(0)
+	resp = postMessage(t, wrapperURL, zeroReader(4*limit), -1)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a streamed body over the limit, got %d", resp.StatusCode)
+	}
+	if received.Load() > limit {
+		t.Errorf("expected at most %d bytes to reach the backend, got %d", limit, received.Load())
+	}
+}
+
+func TestProxyPassesBackend413Through(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusRequestEntityTooLarge)
+		io.WriteString(rw, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"too large"}}`)
+	}))
+	t.Cleanup(backend.Close)
+	wrapperURL := serveWrapper(t, newTestWrapper(backend.URL), &Config{})
+
+	resp := postMessage(t, wrapperURL, strings.NewReader("{}"), 2)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || !bytes.Contains(body, []byte("too large")) {
+		t.Errorf("expected the backend's 413 passed through, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestProxyMessageTimeouts(t *testing.T) {
+	uploads := make(chan error, 2)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		_, err := io.Copy(io.Discard, r.Body)
+		uploads <- err
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(rw, "{}")
+	}))
+	t.Cleanup(backend.Close)
+	cfg := &Config{ReadTimeout: 100 * time.Millisecond, WriteTimeout: 100 * time.Millisecond}
+	wrapperURL := serveWrapper(t, newTestWrapper(backend.URL), cfg)
+
+	// A reply slower than both timeouts still arrives once the body is in
+	resp := postMessage(t, wrapperURL, strings.NewReader("{}"), 2)
+	if body, err := io.ReadAll(resp.Body); err != nil || resp.StatusCode != http.StatusOK || string(body) != "{}" {
+		t.Errorf("expected the slow reply, got %d %q (%v)", resp.StatusCode, body, err)
+	}
+	if err := <-uploads; err != nil {
+		t.Errorf("expected the whole body to reach the backend, got %v", err)
+	}
+
+	// An upload that stalls is still bound by the read timeout, and the backend sees it cut short
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { pw.Close() })
+	go pw.Write([]byte("{"))
+	go func() {
+		req, _ := http.NewRequest(http.MethodPost, wrapperURL+"/mcp", pr)
+		req.Header.Set("Authorization", "Bearer token")
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	select {
+	case err := <-uploads:
+		if err == nil {
+			t.Error("expected the stalled upload to be cut off")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a stalled upload was not cut off by the read timeout")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// metric is anything that can render itself in the Prometheus text format
+type metric interface {
+	write(w io.Writer)
+}
+
+// metricsRegistry holds every metric exposed on /metrics
+type metricsRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+var defaultRegistry = &metricsRegistry{}
+
+func (r *metricsRegistry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// ServeHTTP renders all registered metrics
+func (r *metricsRegistry) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metrics {
+		m.write(rw)
+	}
+}
+
+// counter is a metric that only goes up
+type counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+func newCounter(name, help string) *counter {
+	c := &counter{name: name, help: help}
+	defaultRegistry.register(c)
+	return c
+}
+
+func (c *counter) Inc() { c.value.Add(1) }
+
+func (c *counter) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value.Load())
+}
+
+// counterVec is a counter with one label, e.g. one series per error reason
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	c := &counterVec{name: name, help: help, label: label, values: make(map[string]uint64)}
+	defaultRegistry.register(c)
+	return c
+}
+
+func (c *counterVec) Inc(labelValue string) {
+	c.mu.Lock()
+	c.values[labelValue]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	labelValues := make([]string, 0, len(c.values))
+	for labelValue := range c.values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	for _, labelValue := range labelValues {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, labelValue, c.values[labelValue])
+	}
+}
+
+// gauge is a metric that can go up and down
+type gauge struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+func newGauge(name, help string) *gauge {
+	g := &gauge{name: name, help: help}
+	defaultRegistry.register(g)
+	return g
+}
+
+func (g *gauge) Inc()        { g.value.Add(1) }
+func (g *gauge) Dec()        { g.value.Add(-1) }
+func (g *gauge) Set(v int64) { g.value.Store(v) }
+
+func (g *gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.value.Load())
+}
+
+// gaugeVec is a gauge with one label, e.g. one series per backend
+type gaugeVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func newGaugeVec(name, help, label string) *gaugeVec {
+	g := &gaugeVec{name: name, help: help, label: label, values: make(map[string]int64)}
+	defaultRegistry.register(g)
+	return g
+}
+
+func (g *gaugeVec) Set(labelValue string, v int64) {
+	g.mu.Lock()
+	g.values[labelValue] = v
+	g.mu.Unlock()
+}
+
+func (g *gaugeVec) Add(labelValue string, delta int64) {
+	g.mu.Lock()
+	g.values[labelValue] += delta
+	g.mu.Unlock()
+}
+
+func (g *gaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	labelValues := make([]string, 0, len(g.values))
+	for labelValue := range g.values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	for _, labelValue := range labelValues {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", g.name, g.label, labelValue, g.values[labelValue])
+	}
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	h := &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	defaultRegistry.register(h)
+	return h
+}
+
+func (h *histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, upper, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", h.name, h.count, h.name, h.sum, h.name, h.count)
+}
+
+var (
+	sseConnections     = newGauge("oauth_wrapper_sse_connections", "Number of currently open proxied SSE connections.")
+	panicsTotal        = newCounter("oauth_wrapper_panics_total", "Number of panics recovered in HTTP handlers.")
+	sseHeartbeatsTotal = newCounter("oauth_wrapper_sse_heartbeats_total", "Number of heartbeats injected into quiet proxied SSE streams.")
+
+	// Utilization of the global backend connection limit is in_use / limit
+	backendConnectionsInUse = newGauge("oauth_wrapper_backend_connections_in_use", "Number of backend connection slots held by proxied SSE connections.")
+	backendConnectionLimit  = newGauge("oauth_wrapper_backend_connection_limit", "Maximum concurrent proxied SSE connections to the MCP backend (0 = unlimited).")
+
+	registeredClients = newGauge("oauth_wrapper_registered_clients", "Number of registered OAuth clients held in memory.")
+	accessTokensGauge = newGauge("oauth_wrapper_access_tokens", "Number of access tokens held in memory, including expired ones not yet purged.")
+	tokenUsesTotal    = newCounter("oauth_wrapper_token_uses_total", "Number of requests proxied to the MCP backend with access tokens.")
+
+	codeExchangeSeconds = newHistogram("oauth_code_exchange_seconds", "Time from issuing an authorization code to exchanging it for a token.",
+		[]float64{1, 2, 5, 10, 30, 60, 120, 300, 600})
+	codesExpiredTotal = newCounter("oauth_codes_expired_total", "Number of authorization codes that expired without being exchanged.")
+
+	backendUp       = newGaugeVec("oauth_wrapper_backend_up", "Whether an MCP backend passes its health check and is in rotation (1) or not (0).", "backend")
+	backendInFlight = newGaugeVec("oauth_wrapper_backend_in_flight", "Number of requests and streams currently proxied to an MCP backend.", "backend")
+
+	proxyErrorsTotal = newCounterVec("oauth_wrapper_proxy_errors_total", "Number of failed requests to the MCP backend, by reason.", "reason")
+
+	// Both transports are served at once; these split proxied traffic between them
+	proxyRequestsTotal = newCounterVec("oauth_wrapper_proxy_requests_total", "Number of authenticated requests proxied to the MCP backend, by transport (sse or streamable-http).", "transport")
+	proxyStreams       = newGaugeVec("oauth_wrapper_proxy_streams", "Number of open proxied streams, by transport (sse or streamable-http).", "transport")
+
+	// Requests and streams are timed separately: a stream's duration is how long the client stayed connected
+	requestDurationSeconds = newHistogram("oauth_wrapper_request_duration_seconds", "Time to serve HTTP requests, excluding event streams.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10})
+	proxyStreamSeconds = newHistogram("oauth_wrapper_proxy_stream_duration_seconds", "How long proxied streams stayed open.",
+		[]float64{1, 10, 60, 300, 900, 1800, 3600, 14400, 43200})
+)
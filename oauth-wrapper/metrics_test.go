@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogramWrite(t *testing.T) {
+	h := &histogram{name: "test_seconds", help: "Test.", buckets: []float64{1, 10}, counts: make([]uint64, 2)}
+	h.Observe(0.5)
+	h.Observe(5)
+	h.Observe(50)
+
+	var out strings.Builder
+	h.write(&out)
+	want := `# HELP test_seconds Test.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 1
+test_seconds_bucket{le="10"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 55.5
+test_seconds_count 3
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
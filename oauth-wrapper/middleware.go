@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// responseRecorder remembers whether the response has started so middleware can react accordingly
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush keeps SSE streaming working through the wrapper
+func (rec *responseRecorder) Flush() {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// recoverPanics turns a panic in any handler into a logged 500 instead of a crashed server
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: rw}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// The reverse proxy aborts with ErrAbortHandler when a stream breaks; let net/http handle it
+			if e, ok := err.(error); ok && errors.Is(e, http.ErrAbortHandler) {
+				panic(err)
+			}
+
+			panicsTotal.Inc()
+			slog.ErrorContext(r.Context(), "Recovered from panic in handler",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(err),
+				"stack", string(debug.Stack()),
+			)
+
+			// Too late for a clean error once the response has started; drop the connection instead
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeJSONError(rec, http.StatusInternalServerError, "server_error", "Internal server error")
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// serverHeader identifies the running build on every response
+func serverHeader(next http.Handler) http.Handler {
+	server := "slack-mcp-oauth-wrapper/" + Version
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Server", server)
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// limitBody caps the request body so oversized payloads can't exhaust memory;
+// handlers report the resulting error with isBodyTooLarge
+func (w *OAuthWrapper) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(rw, r.Body, w.maxBodyBytes)
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// allowMethods restricts a route to the given methods (GET implies HEAD), advertising them in the
+// Allow header, answering OPTIONS preflights with CORS headers, and rejecting others with a JSON 405
+func allowMethods(next http.Handler, methods ...string) http.Handler {
+	if slices.Contains(methods, http.MethodGet) && !slices.Contains(methods, http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case slices.Contains(methods, r.Method):
+			next.ServeHTTP(rw, r)
+		case r.Method == http.MethodOptions:
+			rw.Header().Set("Allow", allow)
+			rw.Header().Set("Access-Control-Allow-Origin", "*")
+			rw.Header().Set("Access-Control-Allow-Methods", allow)
+			rw.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			rw.Header().Set("Access-Control-Max-Age", "86400")
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			rw.Header().Set("Allow", allow)
+			writeJSONError(rw, http.StatusMethodNotAllowed, "invalid_request", "Method "+r.Method+" is not allowed; use "+allow)
+		}
+	})
+}
+
+// requestIDHeader carries the correlation ID between clients, the wrapper and the MCP backend
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied IDs so they can't bloat logs
+const maxRequestIDLength = 128
+
+// requestID accepts the caller's X-Request-ID or generates one, echoes it on the response,
+// and makes it available to loggers and the proxy through the request context
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = generateRandomString(requestIDLength)
+			r.Header.Set(requestIDHeader, id)
+		}
+		rw.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID accepts short IDs of visible ASCII characters only
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoutesMethodHandling(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	handler := w.routes()
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantAllow    string
+	}{
+		{http.MethodGet, "/token", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{http.MethodDelete, "/register", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{http.MethodPost, "/health", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{http.MethodOptions, "/token", http.StatusNoContent, "POST, OPTIONS"},
+		{http.MethodOptions, "/logout", http.StatusNoContent, "GET, POST, HEAD, OPTIONS"},
+		{http.MethodHead, "/health", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("expected Allow %q, got %q", tt.wantAllow, got)
+			}
+			switch rec.Code {
+			case http.StatusMethodNotAllowed:
+				if body := decodeJSONError(t, rec); body["error"] != "invalid_request" {
+					t.Errorf("expected a JSON invalid_request body, got %v", body)
+				}
+			case http.StatusNoContent:
+				if rec.Header().Get("Access-Control-Allow-Origin") == "" || rec.Header().Get("Access-Control-Allow-Methods") != tt.wantAllow {
+					t.Errorf("expected CORS headers on the preflight, got %v", rec.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := requestID(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		seen = requestIDFrom(r.Context())
+	}))
+
+	tests := []struct {
+		name, header string
+		wantKept     bool
+	}{
+		{"generated when absent", "", false},
+		{"caller id kept", "abc-123", true},
+		{"control characters replaced", "bad\nid", false},
+		{"oversized replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(requestIDHeader)
+			if got == "" || got != seen {
+				t.Fatalf("expected the response header %q to match the context id %q", got, seen)
+			}
+			if (got == tt.header) != tt.wantKept {
+				t.Errorf("header %q: kept=%v, want %v", tt.header, got == tt.header, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestRequestIDForwardedToBackendAndLogged(t *testing.T) {
+	backendID := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			backendID <- r.Header.Get(requestIDHeader)
+		}
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+
+	id := rec.Header().Get(requestIDHeader)
+	if got := <-backendID; got == "" || got != id {
+		t.Errorf("expected the backend to receive request id %q, got %q", id, got)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(contextHandler{slog.NewTextHandler(&buf, nil)})
+	logger.InfoContext(req.Context(), "no id")
+	r := req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id))
+	logger.InfoContext(r.Context(), "with id")
+	if strings.Contains(strings.Split(buf.String(), "\n")[0], "request_id") || !strings.Contains(buf.String(), "request_id="+id) {
+		t.Errorf("expected request_id only on the record logged with it, got:\n%s", buf.String())
+	}
+}
+
+// captureLogs sends the default logger to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(contextHandler{slog.NewTextHandler(&buf, nil)}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRecoverPanics(t *testing.T) {
+	logs := captureLogs(t)
+	before := panicsTotal.value.Load()
+
+	handler := recoverPanics(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/token", nil))
+
+	if rec.Code != http.StatusInternalServerError || decodeJSONError(t, rec)["error"] != "server_error" {
+		t.Errorf("expected a JSON 500 server_error, got %d: %s", rec.Code, rec.Body)
+	}
+	if got := panicsTotal.value.Load() - before; got != 1 {
+		t.Errorf("expected panics_total to increase by 1, got %d", got)
+	}
+	for _, want := range []string{"Recovered from panic in handler", "panic=boom", "path=/token", "stack=", "TestRecoverPanics"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected %q in the log, got:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestRecoverPanicsAfterResponseStarted(t *testing.T) {
+	captureLogs(t)
+	before := panicsTotal.value.Load()
+
+	// Once headers are out, the connection is dropped rather than a second status written
+	handler := recoverPanics(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		panic("boom")
+	}))
+	if got := servePanicking(handler); got != http.ErrAbortHandler {
+		t.Errorf("expected http.ErrAbortHandler, got %v", got)
+	}
+	if panicsTotal.value.Load()-before != 1 {
+		t.Error("expected the panic to be counted")
+	}
+
+	// The proxy's own aborts are left to net/http and not counted
+	before = panicsTotal.value.Load()
+	handler = recoverPanics(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	if got := servePanicking(handler); got != http.ErrAbortHandler {
+		t.Errorf("expected http.ErrAbortHandler re-panicked, got %v", got)
+	}
+	if panicsTotal.value.Load() != before {
+		t.Error("aborted handlers must not count as panics")
+	}
+}
+
+// servePanicking serves a request and returns what the handler panicked with, if anything
+func servePanicking(handler http.Handler) (recovered any) {
+	defer func() { recovered = recover() }()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	return nil
+}
+
+func TestRecoverPanicsInProxy(t *testing.T) {
+	logs := captureLogs(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	// The proxy Director asks for the MCP credential of every request
+	w.mcpCredential = func(token *AccessToken) string {
+		if token != nil {
+			panic("credential lookup failed")
+		}
+		return ""
+	}
+	before := panicsTotal.value.Load()
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader("{}"))
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError || decodeJSONError(t, rec)["error"] != "server_error" {
+		t.Errorf("expected a JSON 500 from the proxy path, got %d: %s", rec.Code, rec.Body)
+	}
+	if panicsTotal.value.Load()-before != 1 || !strings.Contains(logs.String(), "credential lookup failed") {
+		t.Errorf("expected the proxy panic counted and logged, got:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// serverTLSConfig builds the TLS configuration for serving HTTPS directly. With a client CA file,
+// clients may present a certificate (mTLS), which must then chain to one of those CAs; clients
+// without one are still served, so browsers reach /authorize as usual.
+func serverTLSConfig(cfg *Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	data, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("TLS client CA file contains no PEM certificates")
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// certThumbprint is the base64url SHA-256 hash of a certificate's DER encoding, the x5t#S256
+// confirmation a certificate-bound token carries (RFC 8705 section 3.1)
+func certThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// clientCertThumbprint returns the thumbprint of the verified certificate the client presented on
+// this connection, or "" when it presented none
+func clientCertThumbprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return certThumbprint(r.TLS.PeerCertificates[0])
+}
+
+// checkCertBinding requires a certificate-bound token to arrive over a connection authenticated
+// with the certificate it was issued to
+func checkCertBinding(r *http.Request, accessToken *AccessToken) *oauthError {
+	if accessToken.CertThumbprint == "" {
+		return nil
+	}
+	presented := clientCertThumbprint(r)
+	if presented == "" {
+		return &oauthError{http.StatusUnauthorized, "invalid_token", "Token is bound to a TLS client certificate; present it on the connection"}
+	}
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(accessToken.CertThumbprint)) != 1 {
+		return &oauthError{http.StatusUnauthorized, "invalid_token", "Token is bound to a different TLS client certificate"}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCert creates a self-signed certificate for name and returns it with PEM encodings of
+// the certificate and its key
+func newTestCert(t *testing.T, name string) (*x509.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	_, certPEM, keyPEM := newTestCert(t, "localhost")
+	_, caPEM, _ := newTestCert(t, "client-ca")
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	cfg := &Config{TLSCertFile: write("cert.pem", certPEM), TLSKeyFile: write("key.pem", keyPEM)}
+
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ClientAuth != tls.NoClientCert || tlsConfig.ClientCAs != nil {
+		t.Error("expected no client certificates without a client CA file")
+	}
+
+	cfg.TLSClientCAFile = write("ca.pem", caPEM)
+	if tlsConfig, err = serverTLSConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven || tlsConfig.ClientCAs == nil {
+		t.Errorf("expected optional, verified client certificates, got %v", tlsConfig.ClientAuth)
+	}
+
+	cfg.TLSClientCAFile = write("empty.pem", []byte("not a certificate"))
+	if _, err := serverTLSConfig(cfg); err == nil {
+		t.Error("expected an error for a client CA file without certificates")
+	}
+	cfg.TLSKeyFile = filepath.Join(dir, "missing.pem")
+	if _, err := serverTLSConfig(cfg); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+}
+
+func TestCertBoundToken(t *testing.T) {
+	now := time.Now()
+	clientCert, _, _ := newTestCert(t, "client")
+	otherCert, _, _ := newTestCert(t, "other")
+	withCert := func(r *http.Request, cert *x509.Certificate) *http.Request {
+		r.TLS = &tls.ConnectionState{}
+		if cert != nil {
+			r.TLS.PeerCertificates = []*x509.Certificate{cert}
+		}
+		return r
+	}
+
+	exchange := func(w *OAuthWrapper, cert *x509.Certificate) string {
+		t.Helper()
+		w.authCodes["code"] = &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, ExpiresAt: now.Add(time.Minute)}
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {"code"}, "redirect_uri": {testRedirectURI}}
+		req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("client", "secret")
+		rec := httptest.NewRecorder()
+		w.handleToken(rec, withCert(req, cert))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("token exchange returned %d: %s", rec.Code, rec.Body)
+		}
+		var resp TokenResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.TokenType != tokenTypeBearer {
+			t.Errorf("certificate-bound tokens are still bearer tokens, got %q", resp.TokenType)
+		}
+		return resp.AccessToken
+	}
+	authenticate := func(w *OAuthWrapper, token string, cert *x509.Certificate) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		w.authenticate(rec, withCert(req, cert), "")
+		return rec
+	}
+
+	w := newOAuthTestWrapper(now)
+	w.certBoundTokens = true
+	token := exchange(w, clientCert)
+	if at, _ := w.accessTokens.Get(token); at.CertThumbprint != certThumbprint(clientCert) {
+		t.Fatalf("expected the token bound to the client certificate, got %q", at.CertThumbprint)
+	}
+	if rec := authenticate(w, token, clientCert); rec.Code != http.StatusOK {
+		t.Errorf("expected the bound certificate to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := authenticate(w, token, nil); rec.Code != http.StatusUnauthorized || decodeJSONError(t, rec)["error"] != "invalid_token" {
+		t.Errorf("expected a connection without the certificate to be rejected, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := authenticate(w, token, otherCert); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected another certificate to be rejected, got %d", rec.Code)
+	}
+
+	// Without a certificate at /token the token stays unbound
+	if token := exchange(w, nil); authenticate(w, token, nil).Code != http.StatusOK {
+		t.Error("expected a token issued without a certificate to work without one")
+	}
+
+	// With binding off, a presented certificate is ignored
+	w = newOAuthTestWrapper(now)
+	if token := exchange(w, clientCert); authenticate(w, token, nil).Code != http.StatusOK {
+		t.Error("expected tokens to stay unbound when certificate-bound tokens are off")
+	}
+}
+
+func TestCertBoundTokenMetadata(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	if w.metadata().CertBoundAccessTokens {
+		t.Error("certificate-bound tokens must not be advertised when off")
+	}
+	w.certBoundTokens = true
+	if !w.metadata().CertBoundAccessTokens {
+		t.Error("expected tls_client_certificate_bound_access_tokens when on")
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// oauthError is a failed OAuth request and the response it maps to
+type oauthError struct {
+	Status int
+	// Code is the OAuth error code; errors without one are answered in plain text
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	if e.Code == "" {
+		return e.Description
+	}
+	return e.Code + ": " + e.Description
+}
+
+// write renders the error as OAuth JSON, or plain text when it has no OAuth code
+func (e *oauthError) write(rw http.ResponseWriter) {
+	if e.Code == "" {
+		http.Error(rw, e.Description, e.Status)
+		return
+	}
+	writeJSONError(rw, e.Status, e.Code, e.Description)
+}
+
+// redirectError is an authorization error sent back to the client's redirect URI rather than shown
+// to the user (RFC 6749 section 4.1.2.1)
+type redirectError struct {
+	*oauthError
+	Redirect *url.URL
+}
+
+func (e *redirectError) Unwrap() error { return e.oauthError }
+
+// redirectTo reports the error on redirectURL, carrying the error and state as query parameters
+func (e *oauthError) redirectTo(redirectURL *url.URL, state string) *redirectError {
+	u := *redirectURL
+	q := u.Query()
+	q.Set("error", e.Code)
+	q.Set("error_description", e.Description)
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	return &redirectError{oauthError: e, Redirect: &u}
+}
+
+// writeError answers with err, which should be an *oauthError; anything else is a 500
+func writeError(rw http.ResponseWriter, err error) {
+	if oerr, ok := err.(*oauthError); ok {
+		oerr.write(rw)
+		return
+	}
+	slog.Error("Unexpected OAuth error", "error", err)
+	writeJSONError(rw, http.StatusInternalServerError, "server_error", "Internal server error")
+}
+
+// authorizeRequest holds the /authorize parameters
+type authorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Resources           []string
+	Scope               string
+	Prompt              string
+	MaxAge              string
+}
+
+func authorizeRequestFromQuery(q url.Values) authorizeRequest {
+	return authorizeRequest{
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		ResponseType:        q.Get("response_type"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Resources:           q["resource"],
+		Scope:               q.Get("scope"),
+		Prompt:              q.Get("prompt"),
+		MaxAge:              q.Get("max_age"),
+	}
+}
+
+// authorize validates an authorization request, stores a new code, and returns where to redirect
+func (w *OAuthWrapper) authorize(req authorizeRequest) (*url.URL, error) {
+	// Validate client
+	w.mu.RLock()
+	client, exists := w.clients[req.ClientID]
+	w.mu.RUnlock()
+
+	if !exists {
+		return nil, &oauthError{Status: http.StatusBadRequest, Description: "Invalid client_id"}
+	}
+
+	// Validate redirect URI
+	if !w.redirectURIAllowed(client.RedirectURIs, req.RedirectURI) {
+		return nil, &oauthError{Status: http.StatusBadRequest, Description: "Invalid redirect_uri"}
+	}
+
+	// Make sure we can redirect back before issuing a code
+	redirectURL, err := url.Parse(req.RedirectURI)
+
+	// Clients still asking for the implicit flow are told so on their redirect URI, so they can fall back
+	if req.ResponseType != "code" {
+		oerr := &oauthError{http.StatusBadRequest, "unsupported_response_type", "Only response_type=code is supported; use the authorization code flow with PKCE"}
+		if err == nil {
+			return nil, oerr.redirectTo(redirectURL, req.State)
+		}
+		return nil, oerr
+	}
+	if err != nil {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_request", "redirect_uri could not be parsed"}
+	}
+
+	// Public clients have no secret, so PKCE is what protects their codes
+	if err := validateCodeChallenge(req.CodeChallenge, req.CodeChallengeMethod); err != nil {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_request", err.Error()}
+	}
+	if client.isPublic() && req.CodeChallenge == "" {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_request", "code_challenge is required for public clients"}
+	}
+
+	audience, err := w.grantAudience(req.Resources)
+	if err != nil {
+		return nil, (&oauthError{http.StatusBadRequest, "invalid_target", err.Error()}).redirectTo(redirectURL, req.State)
+	}
+	scopes, err := parseScope(req.Scope)
+	if err != nil {
+		return nil, (&oauthError{http.StatusBadRequest, "invalid_scope", err.Error()}).redirectTo(redirectURL, req.State)
+	}
+	if err := checkPrompt(req.Prompt, req.MaxAge); err != nil {
+		return nil, (&oauthError{http.StatusBadRequest, "invalid_request", err.Error()}).redirectTo(redirectURL, req.State)
+	}
+
+	// Generate the authorization code: sealed into the code itself in stateless mode, stored otherwise
+	now := w.now()
+	issued := &AuthCode{
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		Audience:      audience,
+		Scopes:        scopes,
+		IssuedAt:      now,
+		ExpiresAt:     now.Add(10 * time.Minute),
+	}
+	authCode := generateRandomString(w.codeLength)
+	if w.codeSealer != nil {
+		if authCode, err = w.codeSealer.seal(authCode, issued); err != nil {
+			return nil, err
+		}
+	} else {
+		w.mu.Lock()
+		w.purgeExpiredAuthCodesLocked(now)
+		w.authCodes[authCode] = issued
+		w.mu.Unlock()
+	}
+
+	// Redirect back to client with auth code
+	q := redirectURL.Query()
+	q.Set("code", authCode)
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	redirectURL.RawQuery = q.Encode()
+	return redirectURL, nil
+}
+
+// purgeExpiredAuthCodesLocked drops codes that expired unused, so abandoned flows don't
+// accumulate. The caller must hold w.mu.
+func (w *OAuthWrapper) purgeExpiredAuthCodesLocked(now time.Time) {
+	for code, authCode := range w.authCodes {
+		if now.After(authCode.ExpiresAt.Add(w.clockSkew)) {
+			delete(w.authCodes, code)
+			codesExpiredTotal.Inc()
+		}
+	}
+}
+
+// accessTokenMarker follows the configurable prefix so scanners can tell access tokens from other
+// secrets, e.g. slkmcp_at_.... The random part is never shortened to make room.
+const accessTokenMarker = "at_"
+
+// validTokenPrefix allows only characters that are safe in headers and easy to match in scanners
+func validTokenPrefix(prefix string) bool {
+	for _, c := range prefix {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenRequest holds the /token parameters, with client credentials from the form or basic auth
+type tokenRequest struct {
+	GrantType    string
+	Code         string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	CodeVerifier string
+	Resources    []string
+	// private_key_jwt clients authenticate with a signed assertion instead of a secret
+	ClientAssertionType string
+	ClientAssertion     string
+	// DPoPProof binds the issued token to the proof's key when DPoP is enabled
+	DPoPProof string
+	// ClientCertThumbprint binds the issued token to the client's TLS certificate when
+	// certificate-bound tokens are enabled
+	ClientCertThumbprint string
+}
+
+// tokenRequestFromForm reads a parsed /token request
+func tokenRequestFromForm(r *http.Request) tokenRequest {
+	req := tokenRequest{
+		GrantType:    r.FormValue("grant_type"),
+		Code:         r.FormValue("code"),
+		ClientID:     r.FormValue("client_id"),
+		ClientSecret: r.FormValue("client_secret"),
+		RedirectURI:  r.FormValue("redirect_uri"),
+		CodeVerifier: r.FormValue("code_verifier"),
+		Resources:    r.Form["resource"],
+
+		ClientAssertionType: r.FormValue("client_assertion_type"),
+		ClientAssertion:     r.FormValue("client_assertion"),
+	}
+	// client_id is optional alongside an assertion, whose issuer names the client
+	if req.ClientID == "" && req.ClientAssertion != "" {
+		req.ClientID = assertionIssuer(req.ClientAssertion)
+	}
+
+	// Check for basic auth if not in form
+	if req.ClientID == "" || req.ClientSecret == "" {
+		if user, pass, ok := r.BasicAuth(); ok {
+			req.ClientID = user
+			req.ClientSecret = pass
+		}
+	}
+	return req
+}
+
+// exchangeCode redeems an authorization code for a new access token
+func (w *OAuthWrapper) exchangeCode(req tokenRequest) (*TokenResponse, error) {
+	// authorization_code is the only grant implemented, and may still be disabled
+	if req.GrantType != "authorization_code" || !w.grantEnabled(req.GrantType) {
+		return nil, &oauthError{http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("grant_type %q is not supported by this server", req.GrantType)}
+	}
+
+	// Validate client
+	w.mu.RLock()
+	client, exists := w.clients[req.ClientID]
+	w.mu.RUnlock()
+
+	if !exists {
+		return nil, &oauthError{Status: http.StatusUnauthorized, Description: "Invalid client credentials"}
+	}
+	switch {
+	case client.TokenEndpointAuthMethod == authMethodPrivateKeyJWT:
+		if err := w.verifyClientAssertion(context.Background(), client, req.ClientAssertionType, req.ClientAssertion); err != nil {
+			slog.Warn("Client assertion rejected", "client_id", client.ClientID, "error", err)
+			return nil, &oauthError{http.StatusUnauthorized, "invalid_client", err.Error()}
+		}
+	case !client.isPublic() && !client.secretMatches(req.ClientSecret):
+		return nil, &oauthError{Status: http.StatusUnauthorized, Description: "Invalid client credentials"}
+	}
+	if client.ClientSecretExpiresAt != 0 && !w.now().Before(time.Unix(int64(client.ClientSecretExpiresAt), 0)) {
+		return nil, &oauthError{http.StatusUnauthorized, "invalid_client", "Client secret has expired; register the client again"}
+	}
+
+	// Validate the DPoP proof before consuming the code, so a bad proof can be retried
+	var thumbprint string
+	if w.dpop && req.DPoPProof != "" {
+		var err error
+		if thumbprint, err = w.verifyDPoPProof(req.DPoPProof, http.MethodPost, w.publicURL+"/token", ""); err != nil {
+			return nil, &oauthError{http.StatusBadRequest, "invalid_dpop_proof", err.Error()}
+		}
+	}
+
+	// Check capacity before consuming the code so the client can retry later
+	if !w.hasTokenCapacity() {
+		slog.Warn("Token issuance rejected, limit reached", "max_tokens", w.maxTokens)
+		return nil, &oauthError{http.StatusServiceUnavailable, "temporarily_unavailable", "Maximum number of active tokens reached"}
+	}
+	if !w.hasClientTokenCapacity(req.ClientID) {
+		slog.Warn("Token issuance rejected, client limit reached", "client_id", req.ClientID, "max_tokens_per_client", w.maxTokensPerClient)
+		return nil, &oauthError{http.StatusTooManyRequests, "invalid_request", fmt.Sprintf("Client already holds the maximum of %d active tokens", w.maxTokensPerClient)}
+	}
+
+	// Validate auth code
+	authCode, exists := w.takeAuthCode(req.Code)
+	if !exists || authCode.ClientID != req.ClientID || authCode.RedirectURI != req.RedirectURI {
+		return nil, &oauthError{Status: http.StatusBadRequest, Description: "Invalid authorization code"}
+	}
+
+	now := w.now()
+	if now.After(authCode.ExpiresAt.Add(w.clockSkew)) {
+		codesExpiredTotal.Inc()
+		return nil, &oauthError{Status: http.StatusBadRequest, Description: "Authorization code expired"}
+	}
+
+	if err := verifyCodeVerifier(authCode.CodeChallenge, req.CodeVerifier); err != nil {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_grant", err.Error()}
+	}
+
+	// A token may be narrowed to a subset of the audience granted at authorization time
+	audience, err := narrowAudience(authCode.Audience, req.Resources)
+	if err != nil {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_target", err.Error()}
+	}
+
+	// Generate and store the access token
+	accessToken := w.tokenPrefix + accessTokenMarker + generateRandomString(w.tokenLength)
+	issued := &AccessToken{
+		ClientID:  req.ClientID,
+		Audience:  audience,
+		ExpiresAt: now.Add(w.tokenTTL),
+		Scopes:    authCode.Scopes,
+		CreatedAt: now,
+	}
+	if w.bindOrigin {
+		issued.BoundOrigin = originOf(authCode.RedirectURI)
+	}
+	issued.DPoPThumbprint = thumbprint
+	issued.CertThumbprint = req.ClientCertThumbprint
+	w.accessTokens.Set(accessToken, issued)
+	w.evictOldestClientTokens(req.ClientID)
+	accessTokensGauge.Set(int64(w.accessTokens.Len()))
+	codeExchangeSeconds.Observe(now.Sub(authCode.IssuedAt).Seconds())
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   issued.TokenType(),
+		ExpiresIn:   int(w.tokenTTL.Seconds()),
+		Scope:       strings.Join(issued.Scopes, " "),
+	}, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRedirectURI = "https://claude.ai/api/mcp/auth_callback"
+
+// newOAuthTestWrapper returns a wrapper with one confidential client and a fixed clock
+func newOAuthTestWrapper(now time.Time) *OAuthWrapper {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.now = func() time.Time { return now }
+	w.clients["client"] = &ClientRegistrationResponse{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURIs: []string{testRedirectURI},
+	}
+	return w
+}
+
+func wantOAuthError(t *testing.T, err error, status int, code string) {
+	t.Helper()
+	var oerr *oauthError
+	if !errors.As(err, &oerr) {
+		t.Fatalf("expected an *oauthError, got %v", err)
+	}
+	if oerr.Status != status || oerr.Code != code {
+		t.Errorf("expected %d %q, got %d %q (%s)", status, code, oerr.Status, oerr.Code, oerr.Description)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	valid := authorizeRequest{ClientID: "client", RedirectURI: testRedirectURI, ResponseType: "code", State: "xyz"}
+
+	tests := []struct {
+		name       string
+		modify     func(*authorizeRequest)
+		wantStatus int
+		wantCode   string
+	}{
+		{"success", func(*authorizeRequest) {}, 0, ""},
+		{"unknown client", func(r *authorizeRequest) { r.ClientID = "nope" }, http.StatusBadRequest, ""},
+		{"redirect mismatch", func(r *authorizeRequest) { r.RedirectURI = "https://evil.example/cb" }, http.StatusBadRequest, ""},
+		{"unsupported response type", func(r *authorizeRequest) { r.ResponseType = "token" }, http.StatusBadRequest, "unsupported_response_type"},
+		{"plain pkce", func(r *authorizeRequest) { r.CodeChallenge, r.CodeChallengeMethod = "abc", "plain" }, http.StatusBadRequest, "invalid_request"},
+		{"malformed scope", func(r *authorizeRequest) { r.Scope = `mcp:"stream"` }, http.StatusBadRequest, "invalid_scope"},
+		{"prompt none", func(r *authorizeRequest) { r.Prompt = "none" }, 0, ""},
+		{"prompt login with max_age", func(r *authorizeRequest) { r.Prompt, r.MaxAge = "login consent", "0" }, 0, ""},
+		{"unknown prompt", func(r *authorizeRequest) { r.Prompt = "select_account create" }, 0, ""},
+		{"prompt none combined", func(r *authorizeRequest) { r.Prompt = "none login" }, http.StatusBadRequest, "invalid_request"},
+		{"negative max_age", func(r *authorizeRequest) { r.MaxAge = "-1" }, http.StatusBadRequest, "invalid_request"},
+		{"non-numeric max_age", func(r *authorizeRequest) { r.MaxAge = "1h" }, http.StatusBadRequest, "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newOAuthTestWrapper(time.Now())
+			req := valid
+			tt.modify(&req)
+
+			redirect, err := w.authorize(req)
+			if tt.wantStatus != 0 {
+				wantOAuthError(t, err, tt.wantStatus, tt.wantCode)
+				if len(w.authCodes) != 0 {
+					t.Error("no code should be stored for a rejected request")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authorize: %v", err)
+			}
+			code := redirect.Query().Get("code")
+			if _, ok := w.authCodes[code]; !ok || redirect.Query().Get("state") != "xyz" {
+				t.Errorf("expected a stored code and the state in %s", redirect)
+			}
+		})
+	}
+}
+
+func TestAuthorizePurgesExpiredCodes(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.authCodes["stale"] = &AuthCode{ClientID: "client", ExpiresAt: now.Add(-time.Second)}
+	w.authCodes["fresh"] = &AuthCode{ClientID: "client", ExpiresAt: now.Add(time.Minute)}
+	before := codesExpiredTotal.value.Load()
+
+	if _, err := w.authorize(authorizeRequest{ClientID: "client", RedirectURI: testRedirectURI, ResponseType: "code"}); err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if _, ok := w.authCodes["stale"]; ok {
+		t.Error("expected the expired code to be purged")
+	}
+	if _, ok := w.authCodes["fresh"]; !ok {
+		t.Error("the unexpired code must be kept")
+	}
+	if got := codesExpiredTotal.value.Load() - before; got != 1 {
+		t.Errorf("expected one expired code counted, got %d", got)
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		codeExpiry time.Time
+		modify     func(*tokenRequest)
+		wantStatus int
+		wantCode   string
+	}{
+		{"success", now.Add(time.Minute), func(*tokenRequest) {}, 0, ""},
+		{"expired code", now.Add(-time.Second), func(*tokenRequest) {}, http.StatusBadRequest, ""},
+		{"wrong client secret", now.Add(time.Minute), func(r *tokenRequest) { r.ClientSecret = "wrong" }, http.StatusUnauthorized, ""},
+		{"redirect mismatch", now.Add(time.Minute), func(r *tokenRequest) { r.RedirectURI = "https://evil.example/cb" }, http.StatusBadRequest, ""},
+		{"unknown code", now.Add(time.Minute), func(r *tokenRequest) { r.Code = "other" }, http.StatusBadRequest, ""},
+		{"unsupported grant", now.Add(time.Minute), func(r *tokenRequest) { r.GrantType = "password" }, http.StatusBadRequest, "unsupported_grant_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newOAuthTestWrapper(now)
+			w.authCodes["code"] = &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, ExpiresAt: tt.codeExpiry}
+			req := tokenRequest{
+				GrantType:    "authorization_code",
+				Code:         "code",
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RedirectURI:  testRedirectURI,
+			}
+			tt.modify(&req)
+
+			resp, err := w.exchangeCode(req)
+			if tt.wantStatus != 0 {
+				wantOAuthError(t, err, tt.wantStatus, tt.wantCode)
+				if w.accessTokens.Len() != 0 {
+					t.Error("no token should be issued for a rejected request")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchangeCode: %v", err)
+			}
+			at, ok := w.accessTokens.Get(resp.AccessToken)
+			if !ok || !at.CreatedAt.Equal(now) || !at.ExpiresAt.Equal(now.Add(w.tokenTTL)) {
+				t.Errorf("expected a stored token timed by the wrapper clock, got %+v", at)
+			}
+			if _, err := w.exchangeCode(req); err == nil {
+				t.Error("a code must only be redeemable once")
+			}
+		})
+	}
+}
+
+func TestExchangeCodeTokenPrefix(t *testing.T) {
+	w := newOAuthTestWrapper(time.Now())
+	w.tokenPrefix = "slkmcp_"
+	w.tokenLength = 96
+	w.authCodes["code"] = &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, ExpiresAt: time.Now().Add(time.Minute)}
+
+	resp, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: "code", ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI})
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	random, ok := strings.CutPrefix(resp.AccessToken, "slkmcp_at_")
+	if !ok {
+		t.Fatalf("expected the slkmcp_at_ prefix, got %q", resp.AccessToken)
+	}
+	if len(random) != 96 {
+		t.Errorf("the prefix must not eat into the random part, got %d characters", len(random))
+	}
+	if _, ok := w.accessTokens.Get(resp.AccessToken); !ok {
+		t.Error("the token should be looked up with its prefix")
+	}
+}
+
+func TestHandleAuthorizeUnsupportedResponseType(t *testing.T) {
+	w := newOAuthTestWrapper(time.Now())
+
+	// A valid redirect URI gets the error, with the state, so the client can fall back
+	q := url.Values{"client_id": {"client"}, "redirect_uri": {testRedirectURI}, "response_type": {"token"}, "state": {"xyz"}}
+	rec := httptest.NewRecorder()
+	w.handleAuthorize(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected 302, got %d: %s", rec.Code, rec.Body)
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loc.Query(); got.Get("error") != "unsupported_response_type" || got.Get("state") != "xyz" || !strings.Contains(got.Get("error_description"), "code") {
+		t.Errorf("unexpected error redirect %s", loc)
+	}
+	if len(w.authCodes) != 0 {
+		t.Error("no code should be issued")
+	}
+
+	// A redirect URI that can't be used gets a JSON error instead
+	w.clients["client"].RedirectURIs = append(w.clients["client"].RedirectURIs, "https://bad host/cb")
+	q.Set("redirect_uri", "https://bad host/cb")
+	rec = httptest.NewRecorder()
+	w.handleAuthorize(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil))
+	if rec.Code != http.StatusBadRequest || decodeJSONError(t, rec)["error"] != "unsupported_response_type" {
+		t.Errorf("expected a JSON unsupported_response_type error, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// An unregistered redirect URI is never redirected to
+	q.Set("redirect_uri", "https://evil.example/cb")
+	rec = httptest.NewRecorder()
+	w.handleAuthorize(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Location") != "" {
+		t.Errorf("expected 400 without a redirect, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// originOf returns the scheme://host[:port] origin of a URL, lowercased, or "" if it has none
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// originAllows reports whether a request's Origin header may use a token bound to boundOrigin.
+// Requests without an Origin header (non-browser clients) are not checked.
+func originAllows(boundOrigin, requestOrigin string) bool {
+	if boundOrigin == "" || requestOrigin == "" {
+		return true
+	}
+	return originOf(requestOrigin) == boundOrigin
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOriginAllows(t *testing.T) {
+	tests := []struct {
+		bound, origin string
+		want          bool
+	}{
+		{"", "https://evil.example", true},
+		{"https://claude.ai", "", true},
+		{"https://claude.ai", "https://claude.ai", true},
+		{"https://claude.ai", "HTTPS://Claude.AI", true},
+		{"https://claude.ai", "https://evil.example", false},
+		{"https://claude.ai", "http://claude.ai", false},
+		{"https://claude.ai", "https://claude.ai:8443", false},
+	}
+	for _, tt := range tests {
+		if got := originAllows(tt.bound, tt.origin); got != tt.want {
+			t.Errorf("originAllows(%q, %q) = %v, want %v", tt.bound, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestHandleSSEProxyRejectsMismatchedOrigin(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.accessTokens.Set("token", &AccessToken{
+		ClientID:    "client",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		BoundOrigin: originOf("https://claude.ai/api/mcp/auth_callback"),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Origin", "https://evil.example")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+	if body := decodeJSONError(t, rec); body["error"] != "invalid_token" {
+		t.Errorf("expected invalid_token, got %q", body["error"])
+	}
+}
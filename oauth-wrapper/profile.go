@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Deployment profiles. Development keeps the lenient defaults that make local testing easy;
+// production refuses settings that are only safe on a developer machine.
+const (
+	envDevelopment = "development"
+	envProduction  = "production"
+)
+
+var supportedEnvs = []string{envDevelopment, envProduction}
+
+// defaultProductionSecretTTL is the client secret lifetime in production when none is configured
+const defaultProductionSecretTTL = 90 * 24 * time.Hour
+
+// applyProfile fills in the production defaults and reports settings production doesn't allow
+func (c *Config) applyProfile() []error {
+	if c.Env != envProduction {
+		return nil
+	}
+
+	var errs []error
+	if u, err := url.Parse(c.PublicURL); err != nil || u.Scheme != "https" || isLoopbackHost(u.Hostname()) {
+		errs = append(errs, fmt.Errorf("production requires an https public URL that isn't localhost, got %q", c.PublicURL))
+	}
+	if c.RegistrationToken == "" {
+		errs = append(errs, errors.New("production requires a registration token (SLACK_MCP_OAUTH_REGISTRATION_TOKEN)"))
+	}
+	if c.ClientSecretTTL == 0 {
+		c.ClientSecretTTL = defaultProductionSecretTTL
+	}
+	return errs
+}
+
+// redirectSchemeAllowed reports whether a redirect URI is acceptable under the HTTPS-only rule:
+// https, or http to a loopback address for native apps (RFC 8252 section 7.3)
+func redirectSchemeAllowed(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "https" || (u.Scheme == "http" && isLoopbackHost(u.Hostname()))
+}
+
+// checkRedirectSchemes enforces redirectSchemeAllowed on every web redirect URI when HTTPS redirects
+// are required. Custom schemes stay on the device, and validateRegistration already limits them to
+// public clients.
+func (w *OAuthWrapper) checkRedirectSchemes(uris []string) error {
+	if !w.httpsRedirects {
+		return nil
+	}
+	for _, uri := range uris {
+		if u, err := url.Parse(uri); err == nil && !isWebScheme(u.Scheme) {
+			continue
+		}
+		if !redirectSchemeAllowed(uri) {
+			return fmt.Errorf("redirect_uri %q must use https", uri)
+		}
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigProductionProfile(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	t.Setenv("SLACK_MCP_OAUTH_ENV", "production")
+
+	// The development defaults are refused, with every problem reported
+	_, err := loadConfig(nil)
+	if err == nil {
+		t.Fatal("expected production to refuse the localhost public URL and open registration")
+	}
+	for _, want := range []string{"https public URL", "registration token"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got %v", want, err)
+		}
+	}
+
+	cfg, err := loadConfig([]string{"-public-url", "https://mcp.example.com", "-registration-token", "initial"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.ClientSecretTTL != defaultProductionSecretTTL {
+		t.Errorf("expected client secrets to expire by default in production, got %s", cfg.ClientSecretTTL)
+	}
+
+	if _, err := loadConfig([]string{"-public-url", "https://127.0.0.1", "-registration-token", "initial"}); err == nil {
+		t.Error("expected a loopback public URL to be refused in production")
+	}
+	if _, err := loadConfig([]string{"-env", "staging"}); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestLoadConfigDevelopmentProfileIsLenient(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Env != envDevelopment || cfg.ClientSecretTTL != 0 {
+		t.Errorf("expected the development profile with non-expiring secrets, got %q and %s", cfg.Env, cfg.ClientSecretTTL)
+	}
+}
+
+func TestRedirectSchemeAllowed(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{"https://claude.ai/api/mcp/auth_callback", true},
+		{"http://localhost:3000/cb", true},
+		{"http://127.0.0.1:3000/cb", true},
+		{"http://[::1]:3000/cb", true},
+		{"http://claude.ai/cb", false},
+		{"http://localhost.evil.com/cb", false},
+		{"myapp://callback", false},
+	}
+	for _, tt := range tests {
+		if got := redirectSchemeAllowed(tt.uri); got != tt.want {
+			t.Errorf("redirectSchemeAllowed(%q) = %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestProductionRegistration(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.httpsRedirects = true
+	w.clientSecretTTL = time.Hour
+
+	register := func(redirectURI string) *httptest.ResponseRecorder {
+		body := `{"client_name":"Claude","redirect_uris":["` + redirectURI + `"]}`
+		rec := httptest.NewRecorder()
+		w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := register("http://claude.ai/cb"); rec.Code != http.StatusBadRequest || decodeJSONError(t, rec)["error"] != "invalid_redirect_uri" {
+		t.Errorf("expected an http redirect URI to be rejected, got %d", rec.Code)
+	}
+
+	rec := register("https://claude.ai/api/mcp/auth_callback")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var client ClientRegistrationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&client); err != nil {
+		t.Fatal(err)
+	}
+	if want := client.ClientIDIssuedAt + int64(time.Hour.Seconds()); int64(client.ClientSecretExpiresAt) != want {
+		t.Errorf("expected the secret to expire an hour after issue, got %d", client.ClientSecretExpiresAt)
+	}
+}
+
+func TestExchangeCodeRejectsExpiredSecret(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.clients["client"].ClientSecretExpiresAt = int(now.Add(-time.Minute).Unix())
+	w.authCodes["code"] = &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, ExpiresAt: now.Add(time.Minute)}
+
+	_, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: "code", ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI})
+	wantOAuthError(t, err, http.StatusUnauthorized, "invalid_client")
+	if _, ok := w.authCodes["code"]; !ok {
+		t.Error("the code must not be consumed by a client that failed authentication")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// checkPrompt validates the OpenID Connect prompt and max_age parameters on /authorize (OIDC Core
+// section 3.1.2.1). The wrapper has no login or consent step: it authorizes against its own Slack
+// token and never interacts with the user, so prompt=none is always satisfiable, and there is no
+// earlier authentication for prompt=login or max_age to find stale. What's left is rejecting
+// requests that can't be well-formed; unknown prompt values are ignored.
+func checkPrompt(prompt, maxAge string) error {
+	values := strings.Fields(prompt)
+	if slices.Contains(values, "none") && len(values) > 1 {
+		return errors.New("prompt=none can't be combined with other prompt values")
+	}
+	if maxAge != "" {
+		if seconds, err := strconv.Atoi(maxAge); err != nil || seconds < 0 {
+			return fmt.Errorf("max_age must be a non-negative number of seconds, got %q", maxAge)
+		}
+	}
+	return nil
+}
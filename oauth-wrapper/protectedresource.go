@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// protectedResourcePath is where protected resource metadata (RFC 9728) is served. A resource
+// with a path has its own document below it, e.g. /.well-known/oauth-protected-resource/sse.
+const protectedResourcePath = "/.well-known/oauth-protected-resource"
+
+// ProtectedResourceMetadata tells clients which authorization server issues tokens for a resource
+type ProtectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	DPoPSigningAlgs        []string `json:"dpop_signing_alg_values_supported,omitempty"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	CertBoundAccessTokens  bool     `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+}
+
+// Handle protected resource metadata requests. They are only served when resources are
+// configured; the bare path describes the first configured resource unless one sits at the root.
+func (w *OAuthWrapper) handleProtectedResource(rw http.ResponseWriter, r *http.Request) {
+	resource, ok := w.protectedResource(r.URL.Path)
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+
+	metadata := ProtectedResourceMetadata{
+		Resource:               resource,
+		AuthorizationServers:   []string{w.publicURL},
+		BearerMethodsSupported: []string{"header"},
+		CertBoundAccessTokens:  w.certBoundTokens,
+	}
+	if w.dpop {
+		metadata.DPoPSigningAlgs = supportedDPoPAlgs
+	}
+	if w.sseRequiredScope != "" {
+		metadata.ScopesSupported = []string{w.sseRequiredScope}
+	}
+	writeCacheableJSON(rw, r, metadata)
+}
+
+// protectedResource finds the configured resource whose metadata lives at path
+func (w *OAuthWrapper) protectedResource(path string) (string, bool) {
+	if len(w.resources) == 0 {
+		return "", false
+	}
+	for _, resource := range w.resources {
+		if metadataPath(resource) == path {
+			return resource, true
+		}
+	}
+	if path == protectedResourcePath {
+		return w.resources[0], true
+	}
+	return "", false
+}
+
+// metadataPath is the path of a resource's metadata document: the well-known prefix inserted
+// before the resource's own path
+func metadataPath(resource string) string {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return ""
+	}
+	return protectedResourcePath + strings.TrimSuffix(u.EscapedPath(), "/")
+}
+
+// bearerChallenge builds the Bearer WWW-Authenticate challenge for a failed request to resource.
+// When resources are configured it also points at the resource's metadata (RFC 9728 section 5.1),
+// so clients can find the authorization server from a 401.
+func (w *OAuthWrapper) bearerChallenge(resource string, params ...string) string {
+	if len(w.resources) > 0 {
+		metadataURL := w.publicURL + protectedResourcePath
+		for _, configured := range w.resources {
+			if configured == normalizeResource(resource) {
+				metadataURL = w.publicURL + metadataPath(configured)
+				break
+			}
+		}
+		params = append(params, `resource_metadata="`+metadataURL+`"`)
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtectedResourceMetadata(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	if code := getStatus(w.routes(), protectedResourcePath); code != http.StatusNotFound {
+		t.Errorf("expected no metadata without configured resources, got %d", code)
+	}
+
+	w.resources = []string{"http://localhost:8080/sse", "http://localhost:8080/tenants/b/sse"}
+	get := func(path string) ProtectedResourceMetadata {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", path, rec.Code)
+		}
+		var metadata ProtectedResourceMetadata
+		if err := json.NewDecoder(rec.Body).Decode(&metadata); err != nil {
+			t.Fatal(err)
+		}
+		return metadata
+	}
+
+	if m := get(protectedResourcePath); m.Resource != "http://localhost:8080/sse" || len(m.AuthorizationServers) != 1 || m.AuthorizationServers[0] != "http://localhost:8080" {
+		t.Errorf("expected the first resource with this authorization server, got %+v", m)
+	}
+	if m := get(protectedResourcePath + "/tenants/b/sse"); m.Resource != "http://localhost:8080/tenants/b/sse" {
+		t.Errorf("expected the per-resource document, got %+v", m)
+	}
+	if code := getStatus(w.routes(), protectedResourcePath+"/unknown"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unconfigured resource, got %d", code)
+	}
+}
+
+func TestUnauthenticatedSSEPointsAtResourceMetadata(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, httptest.NewRequest(http.MethodGet, "/sse", nil))
+	if got := rec.Header().Get("WWW-Authenticate"); got != "Bearer" {
+		t.Errorf("expected a bare challenge without configured resources, got %q", got)
+	}
+
+	w.resources = []string{"http://localhost:8080/sse"}
+	rec = httptest.NewRecorder()
+	w.handleSSEProxy(rec, httptest.NewRequest(http.MethodGet, "/sse", nil))
+	want := `Bearer resource_metadata="http://localhost:8080/.well-known/oauth-protected-resource/sse"`
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != want {
+		t.Errorf("expected 401 with %q, got %d %q", want, rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// accessTokenKey carries the authenticated *AccessToken from handleSSEProxy to the proxy Director
+type accessTokenKey struct{}
+
+// mcpCredentialFunc returns the Authorization value sent to the MCP server for a token, or "" to send none.
+// The token is nil for the wrapper's own health checks.
+type mcpCredentialFunc func(token *AccessToken) string
+
+// reverseProxy returns the proxy to the MCP server, building it on first use
+func (w *OAuthWrapper) reverseProxy() (*httputil.ReverseProxy, error) {
+	w.proxyOnce.Do(func() {
+		w.proxy, w.proxyErr = w.newReverseProxy()
+	})
+	return w.proxy, w.proxyErr
+}
+
+// newReverseProxy builds the proxy to the MCP server; the request path (/sse) is appended to the target
+func (w *OAuthWrapper) newReverseProxy() (*httputil.ReverseProxy, error) {
+	for _, backendURL := range w.backendURLs() {
+		backend, err := newMCPBackend(backendURL)
+		if err != nil {
+			return nil, err
+		}
+		w.backends = append(w.backends, backend)
+	}
+	proxy := &httputil.ReverseProxy{}
+
+	// Route to the session's backend, remove the OAuth token and add MCP auth if configured
+	proxy.Director = func(req *http.Request) {
+		w.backendFor(req).director(req)
+
+		// Remove OAuth token and its DPoP proof
+		stripAuthorization(req.Header)
+		req.Header.Del(dpopHeader)
+
+		// Let the backend log the same correlation ID
+		if id := requestIDFrom(req.Context()); id != "" {
+			req.Header.Set(requestIDHeader, id)
+		}
+
+		// Accept-Encoding passes through, so compressed JSON reaches the client as the backend sent it.
+		// Event streams are asked for uncompressed: heartbeats and error events are spliced into them.
+		if acceptsEventStream(req.Header.Get("Accept")) {
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+
+		// Add the MCP credential for this token, if any
+		token, _ := req.Context().Value(accessTokenKey{}).(*AccessToken)
+		if credential := w.mcpCredential(token); credential != "" {
+			req.Header.Set("Authorization", credential)
+		}
+	}
+	transport := http.DefaultTransport
+	if w.proxyRetries > 0 || w.messageRetries > 0 {
+		transport = &retryTransport{
+			next: transport, retries: w.proxyRetries, backoff: w.proxyRetryBackoff,
+			messageRetries: w.messageRetries, messageBackoff: w.messageRetryBackoff,
+		}
+	}
+	proxy.Transport = &inFlightTransport{next: transport, wrapper: w}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		w.trackSession(resp)
+		if err := decodeEventStream(resp); err != nil {
+			return err
+		}
+		w.trackSSESession(resp)
+		return terminateSSEOnError(resp)
+	}
+	proxy.ErrorHandler = handleProxyError
+	return proxy, nil
+}
+
+// mcpProtocolVersionHeader carries the negotiated MCP protocol version; the proxy passes it
+// through unchanged in both directions
+const mcpProtocolVersionHeader = "MCP-Protocol-Version"
+
+// checkProtocolVersion rejects a request whose MCP-Protocol-Version is not in the configured set.
+// Requests without the header, or any version when no set is configured, are let through.
+func (w *OAuthWrapper) checkProtocolVersion(rw http.ResponseWriter, r *http.Request) bool {
+	version := r.Header.Get(mcpProtocolVersionHeader)
+	if version == "" || len(w.protocolVersions) == 0 || slices.Contains(w.protocolVersions, version) {
+		return true
+	}
+	writeJSONError(rw, http.StatusBadRequest, "invalid_request",
+		fmt.Sprintf("Unsupported MCP-Protocol-Version %q; supported: %s", version, strings.Join(w.protocolVersions, ", ")))
+	return false
+}
+
+// withAccessToken attaches the authenticated token to the request context for the proxy Director
+func withAccessToken(ctx context.Context, token *AccessToken) context.Context {
+	return context.WithValue(ctx, accessTokenKey{}, token)
+}
+
+// stripAuthorization removes every Authorization entry, including ones stored under a non-canonical key
+func stripAuthorization(h http.Header) {
+	for key := range h {
+		if strings.EqualFold(key, "Authorization") {
+			delete(h, key)
+		}
+	}
+}
+
+// isEventStream reports whether a Content-Type header is text/event-stream
+func isEventStream(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/event-stream"
+}
+
+// acceptsEventStream reports whether an Accept header asks for text/event-stream
+func acceptsEventStream(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		if isEventStream(strings.TrimSpace(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeEventStream undoes gzip on an event stream from a backend that compressed it anyway,
+// so the client always gets a plain stream. Other responses keep their Content-Encoding.
+func decodeEventStream(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if !isEventStream(resp.Header.Get("Content-Type")) || encoding == "" || encoding == "identity" {
+		return nil
+	}
+	if encoding != "gzip" {
+		return fmt.Errorf("MCP backend sent an event stream with unsupported Content-Encoding %q", encoding)
+	}
+	resp.Body = &gunzipBody{ReadCloser: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// gunzipBody decompresses a gzip body, starting on the first read so a stream that hasn't sent
+// anything yet doesn't hold up the response headers
+type gunzipBody struct {
+	io.ReadCloser
+	zr *gzip.Reader
+}
+
+func (b *gunzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil {
+		zr, err := gzip.NewReader(b.ReadCloser)
+		if err != nil {
+			return 0, err
+		}
+		b.zr = zr
+	}
+	return b.zr.Read(p)
+}
+
+// sseErrorEvent renders a well-formed SSE error event the client can react to
+func sseErrorEvent(code, description string) []byte {
+	data, _ := json.Marshal(map[string]string{"error": code, "error_description": description})
+	return []byte(fmt.Sprintf("event: error\ndata: %s\n\n", data))
+}
+
+// Reasons a request to the MCP backend failed, as labelled in oauth_wrapper_proxy_errors_total
+const (
+	proxyErrorCanceled          = "context_canceled"
+	proxyErrorTimeout           = "timeout"
+	proxyErrorConnectionRefused = "connection_refused"
+	proxyErrorEOF               = "eof"
+	proxyErrorBodyTooLarge      = "body_too_large"
+	proxyErrorOther             = "other"
+)
+
+// proxyErrorReason classifies a reverse-proxy error for metrics and logs
+func proxyErrorReason(r *http.Request, err error) string {
+	var netErr net.Error
+	switch {
+	case isBodyTooLarge(err):
+		return proxyErrorBodyTooLarge
+	case r.Context().Err() == context.Canceled || errors.Is(err, context.Canceled):
+		return proxyErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		return proxyErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return proxyErrorConnectionRefused
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return proxyErrorEOF
+	default:
+		return proxyErrorOther
+	}
+}
+
+// handleProxyError reports backend failures: a JSON 503 before the stream starts,
+// an SSE error event once the client is already reading an event stream
+func handleProxyError(rw http.ResponseWriter, r *http.Request, err error) {
+	reason := proxyErrorReason(r, err)
+	proxyErrorsTotal.Inc(reason)
+
+	attrs := []any{"reason", reason, "path", r.URL.Path, "error", err}
+	if token, ok := r.Context().Value(accessTokenKey{}).(*AccessToken); ok && token != nil {
+		attrs = append(attrs, "client_id", token.ClientID)
+	}
+	switch reason {
+	case proxyErrorCanceled:
+		// Usually the client disconnecting, or the stream being closed deliberately
+		slog.DebugContext(r.Context(), "MCP backend request canceled", attrs...)
+	case proxyErrorConnectionRefused, proxyErrorEOF:
+		slog.WarnContext(r.Context(), "MCP backend request failed", attrs...)
+	case proxyErrorBodyTooLarge:
+		// The client sent more than the message body cap; the backend is fine
+		slog.WarnContext(r.Context(), "MCP message body too large", attrs...)
+		writeJSONError(rw, http.StatusRequestEntityTooLarge, "invalid_request", "Message body too large")
+		return
+	default:
+		slog.ErrorContext(r.Context(), "MCP backend request failed", attrs...)
+	}
+
+	if r.Context().Err() != nil {
+		// The client went away or the stream was closed deliberately; nobody is listening
+		return
+	}
+
+	if isEventStream(rw.Header().Get("Content-Type")) {
+		rw.Write(sseErrorEvent("server_error", "MCP server connection failed"))
+		http.NewResponseController(rw).Flush()
+		return
+	}
+	writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "MCP server is unavailable")
+}
+
+// terminateSSEOnError makes a backend failure mid-stream end the event stream with an error event
+// instead of silently truncating it; the proxy only reports errors that happen before the response starts
+func terminateSSEOnError(resp *http.Response) error {
+	if isEventStream(resp.Header.Get("Content-Type")) {
+		resp.Body = &sseErrorBody{ReadCloser: resp.Body, req: resp.Request}
+	}
+	return nil
+}
+
+// sseErrorBody replaces a failed read from the backend with a final SSE error event and a clean EOF
+type sseErrorBody struct {
+	io.ReadCloser
+	req     *http.Request
+	pending []byte
+	failed  bool
+}
+
+func (b *sseErrorBody) Read(p []byte) (int, error) {
+	if b.failed {
+		if len(b.pending) == 0 {
+			return 0, io.EOF
+		}
+		n := copy(p, b.pending)
+		b.pending = b.pending[n:]
+		return n, nil
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if err == nil || errors.Is(err, io.EOF) || b.req.Context().Err() != nil {
+		return n, err
+	}
+	slog.WarnContext(b.req.Context(), "MCP backend stream failed", "path", b.req.URL.Path, "error", err)
+	b.failed = true
+	b.pending = sseErrorEvent("server_error", "MCP server connection lost")
+	return n, nil
+}
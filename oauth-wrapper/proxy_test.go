@@ -0,0 +1,399 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReverseProxyIsBuiltOnce(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+
+	first, err := w.reverseProxy()
+	if err != nil {
+		t.Fatalf("reverseProxy: %v", err)
+	}
+	second, _ := w.reverseProxy()
+	if first != second {
+		t.Error("expected the same proxy instance on every call")
+	}
+}
+
+func TestReverseProxyReplacesAuthorization(t *testing.T) {
+	gotAuth := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			gotAuth <- r.Header.Get("Authorization")
+		}
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.secrets.Store(&secrets{SSEAPIKey: "mcp-key"})
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w.handleSSEProxy(httptest.NewRecorder(), req)
+
+	if auth := <-gotAuth; auth != "Bearer mcp-key" {
+		t.Errorf("expected the MCP API key upstream, got %q", auth)
+	}
+}
+
+func TestReverseProxyPerTokenCredential(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.mcpCredential = func(token *AccessToken) string {
+		return "Bearer key-for-" + token.ClientID
+	}
+	proxy, err := w.reverseProxy()
+	if err != nil {
+		t.Fatalf("reverseProxy: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header["authorization"] = []string{"Bearer client-token"}
+	req.Header.Set("Authorization", "Bearer client-token")
+	req = req.WithContext(withAccessToken(req.Context(), &AccessToken{ClientID: "tenant-a"}))
+	proxy.Director(req)
+
+	if _, ok := req.Header["authorization"]; ok {
+		t.Error("expected the non-canonical authorization header to be removed")
+	}
+	if got := req.Header.Values("Authorization"); len(got) != 1 || got[0] != "Bearer key-for-tenant-a" {
+		t.Errorf("expected only the tenant credential, got %q", got)
+	}
+}
+
+func TestReverseProxyBackendDownReturns503(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backendURL := backend.URL
+	backend.Close()
+
+	w := newTestWrapper(backendURL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	refusedBefore := proxyErrorsTotal.values[proxyErrorConnectionRefused]
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if body := decodeJSONError(t, rec); body["error"] != "temporarily_unavailable" {
+		t.Errorf("expected temporarily_unavailable, got %q", body["error"])
+	}
+	if proxyErrorsTotal.values[proxyErrorConnectionRefused] == refusedBefore {
+		t.Error("expected the failure to be counted as connection_refused")
+	}
+}
+
+func TestProxyErrorReason(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{"client disconnected", canceledCtx, errors.New("read: connection reset"), proxyErrorCanceled},
+		{"canceled", context.Background(), fmt.Errorf("proxy: %w", context.Canceled), proxyErrorCanceled},
+		{"deadline", context.Background(), context.DeadlineExceeded, proxyErrorTimeout},
+		{"net timeout", context.Background(), &net.OpError{Op: "dial", Err: timeoutError{}}, proxyErrorTimeout},
+		{"refused", context.Background(), &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, proxyErrorConnectionRefused},
+		{"eof", context.Background(), fmt.Errorf("read: %w", io.EOF), proxyErrorEOF},
+		{"unexpected eof", context.Background(), io.ErrUnexpectedEOF, proxyErrorEOF},
+		{"other", context.Background(), errors.New("unsupported Content-Encoding"), proxyErrorOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/sse", nil).WithContext(tt.ctx)
+			if got := proxyErrorReason(req, tt.err); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestReverseProxyBackendDropMidStreamSendsErrorEvent(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sse" {
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(rw, "event: endpoint\ndata: /message\n\n")
+		rw.(http.Flusher).Flush()
+
+		// Drop the connection without finishing the chunked response
+		conn, _, err := http.NewResponseController(rw).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "event: endpoint\n") {
+		t.Errorf("expected the events sent before the failure, got %q", body)
+	}
+	if !strings.HasSuffix(body, "event: error\ndata: {\"error\":\"server_error\",\"error_description\":\"MCP server connection lost\"}\n\n") {
+		t.Errorf("expected a trailing SSE error event, got %q", body)
+	}
+}
+
+// benchmarkProxiedRequest sends requests through a proxy obtained from newProxy for each request
+func benchmarkProxiedRequest(b *testing.B, w *OAuthWrapper, newProxy func() *httputil.ReverseProxy) {
+	backend := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer backend.Close()
+	w.mcpURL = backend.URL
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		newProxy().ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkProxyPerRequest mirrors the old behavior of parsing the target and building a proxy per request
+func BenchmarkProxyPerRequest(b *testing.B) {
+	w := newTestWrapper("")
+	benchmarkProxiedRequest(b, w, func() *httputil.ReverseProxy {
+		proxy, _ := w.newReverseProxy()
+		return proxy
+	})
+}
+
+func BenchmarkProxyCached(b *testing.B) {
+	w := newTestWrapper("")
+	benchmarkProxiedRequest(b, w, func() *httputil.ReverseProxy {
+		proxy, _ := w.reverseProxy()
+		return proxy
+	})
+}
+
+func TestProtocolVersionRoundTrips(t *testing.T) {
+	gotVersion := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			gotVersion <- r.Header.Get(mcpProtocolVersionHeader)
+			rw.Header().Set(mcpProtocolVersionHeader, r.Header.Get(mcpProtocolVersionHeader))
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set(mcpProtocolVersionHeader, "2025-06-18")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+
+	if got := <-gotVersion; got != "2025-06-18" {
+		t.Errorf("expected the version forwarded to the backend, got %q", got)
+	}
+	if got := rec.Header().Get(mcpProtocolVersionHeader); got != "2025-06-18" {
+		t.Errorf("expected the backend's version returned to the client, got %q", got)
+	}
+}
+
+func TestProtocolVersionValidation(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.protocolVersions = []string{"2025-03-26", "2025-06-18"}
+
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"", true},
+		{"2025-06-18", true},
+		{"2024-11-05", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		if tt.version != "" {
+			req.Header.Set(mcpProtocolVersionHeader, tt.version)
+		}
+		rec := httptest.NewRecorder()
+		if got := w.checkProtocolVersion(rec, req); got != tt.want {
+			t.Errorf("version %q: got %v, want %v", tt.version, got, tt.want)
+		}
+		if !tt.want && rec.Code != http.StatusBadRequest {
+			t.Errorf("version %q: expected 400, got %d", tt.version, rec.Code)
+		}
+	}
+
+	w.protocolVersions = nil
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set(mcpProtocolVersionHeader, "1999-01-01")
+	if !w.checkProtocolVersion(httptest.NewRecorder(), req) {
+		t.Error("any version should pass when none are configured")
+	}
+}
+
+// gzipBackend serves /sse as gzip whenever the request allows it, or always when force is set
+func gzipBackend(t *testing.T, contentType, body string, force bool) (*httptest.Server, chan string) {
+	t.Helper()
+	gotEncoding := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sse" {
+			return
+		}
+		gotEncoding <- r.Header.Get("Accept-Encoding")
+		rw.Header().Set("Content-Type", contentType)
+		if !force && !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			io.WriteString(rw, body)
+			return
+		}
+		rw.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(rw)
+		io.WriteString(zw, body)
+		zw.Close()
+	}))
+	t.Cleanup(backend.Close)
+	return backend, gotEncoding
+}
+
+func TestReverseProxyPassesCompressedJSONThrough(t *testing.T) {
+	const body = `{"jsonrpc":"2.0","id":1,"result":{}}`
+	backend, gotEncoding := gzipBackend(t, "application/json", body, false)
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+
+	if got := <-gotEncoding; got != "gzip" {
+		t.Errorf("expected the client's Accept-Encoding forwarded, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected the backend's Content-Encoding passed through, got %q", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("expected a gzip body: %v", err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != body {
+		t.Errorf("expected the JSON unchanged, got %q", got)
+	}
+}
+
+func TestReverseProxyNeverCompressesEventStreams(t *testing.T) {
+	const body = "event: endpoint\ndata: /message?sessionId=1\n\n"
+	for _, force := range []bool{false, true} {
+		backend, gotEncoding := gzipBackend(t, "text/event-stream", body, force)
+		w := newTestWrapper(backend.URL)
+		w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		rec := httptest.NewRecorder()
+		w.handleSSEProxy(rec, req)
+
+		if got := <-gotEncoding; got != "identity" {
+			t.Errorf("expected the stream to be requested uncompressed, got %q", got)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("force=%v: expected no Content-Encoding on the stream, got %q", force, got)
+		}
+		if rec.Body.String() != body {
+			t.Errorf("force=%v: expected the plain stream, got %q", force, rec.Body)
+		}
+	}
+}
+
+func TestProxyServesBothTransports(t *testing.T) {
+	var seen []string
+	var mu sync.Mutex
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		if r.Method == http.MethodGet {
+			rw.Header().Set("Content-Type", "text/event-stream")
+		}
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	handler := w.routes()
+	sseBefore, mcpBefore := proxyRequestsTotal.values[transportSSE], proxyRequestsTotal.values[transportStreamableHTTP]
+
+	requests := []struct{ method, target string }{
+		{http.MethodGet, "/sse"},
+		{http.MethodPost, "/message?sessionId=s1"},
+		{http.MethodPost, "/mcp"},
+		{http.MethodGet, "/mcp"},
+		{http.MethodDelete, "/mcp"},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.target, strings.NewReader("{}"))
+		r.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %s: expected 200, got %d", req.method, req.target, rec.Code)
+		}
+	}
+
+	want := []string{"GET /sse", "POST /message?sessionId=s1", "POST /mcp", "GET /mcp", "DELETE /mcp"}
+	if strings.Join(seen, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected each path proxied to the same backend path, got %v", seen)
+	}
+	if proxyRequestsTotal.values[transportSSE]-sseBefore != 2 || proxyRequestsTotal.values[transportStreamableHTTP]-mcpBefore != 3 {
+		t.Errorf("expected requests counted by transport, got %v", proxyRequestsTotal.values)
+	}
+	if proxyStreams.values[transportSSE] != 0 || proxyStreams.values[transportStreamableHTTP] != 0 {
+		t.Errorf("expected no streams left open, got %v", proxyStreams.values)
+	}
+
+	// Unauthenticated requests to the new paths are refused like /sse
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// How a requested redirect_uri is matched against the client's registered ones
+const (
+	// redirectMatchExact requires the exact registered string (RFC 6749 section 3.1.2.3)
+	redirectMatchExact = "exact"
+	// redirectMatchPrefix accepts any path below a registered URI on the same scheme and host,
+	// with any query string
+	redirectMatchPrefix = "prefix"
+)
+
+var supportedRedirectMatchModes = []string{redirectMatchExact, redirectMatchPrefix}
+
+// Schemes that run code or read local data in the browser instead of redirecting anywhere;
+// they are never accepted as redirect URIs
+var dangerousRedirectSchemes = []string{"javascript", "data", "vbscript", "file", "about", "blob"}
+
+// isWebScheme reports whether a redirect URI scheme is http or https. Anything else is a custom,
+// private-use scheme handled by a native app (RFC 8252 section 7.1).
+func isWebScheme(scheme string) bool {
+	return strings.EqualFold(scheme, "https") || strings.EqualFold(scheme, "http")
+}
+
+// validateRedirectURI checks a redirect URI being registered. Every client may use https and http
+// (production narrows http to loopback); custom schemes such as myapp://callback or
+// com.example.app:/callback are only for public clients, whose code PKCE protects.
+func validateRedirectURI(uri string, public bool) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Opaque != "" {
+		return fmt.Errorf("redirect_uri %q is not an absolute URL", uri)
+	}
+	if slices.Contains(dangerousRedirectSchemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("redirect_uri %q uses the %s scheme, which isn't allowed", uri, u.Scheme)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect_uri %q must not contain a fragment", uri)
+	}
+	if u.User != nil {
+		return fmt.Errorf("redirect_uri %q must not contain user information", uri)
+	}
+	if isWebScheme(u.Scheme) {
+		if u.Host == "" {
+			return fmt.Errorf("redirect_uri %q is not an absolute URL", uri)
+		}
+		return nil
+	}
+	if !public {
+		return fmt.Errorf("redirect_uri %q uses a custom scheme, which only public clients (token_endpoint_auth_method none) may register", uri)
+	}
+	return nil
+}
+
+// loopbackRedirectMatches allows a native app's loopback redirect on any port: the app picks a
+// free port at runtime, so only scheme, host, path and query must match (RFC 8252 section 7.3)
+func loopbackRedirectMatches(registered, uri string) bool {
+	r, err := url.Parse(registered)
+	if err != nil || r.Scheme != "http" || !isLoopbackHost(r.Hostname()) {
+		return false
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "http" || u.User != nil || u.Fragment != "" {
+		return false
+	}
+	return strings.EqualFold(r.Hostname(), u.Hostname()) && r.Path == u.Path && r.RawQuery == u.RawQuery
+}
+
+// redirectURIAllowed reports whether uri may be used as a redirect for a client that registered
+// the given URIs, under the configured match mode. Loopback redirects match on any port.
+func (w *OAuthWrapper) redirectURIAllowed(registered []string, uri string) bool {
+	if slices.Contains(registered, uri) {
+		return true
+	}
+	for _, candidate := range registered {
+		if loopbackRedirectMatches(candidate, uri) {
+			return true
+		}
+	}
+	if w.redirectMatch != redirectMatchPrefix {
+		return false
+	}
+	for _, prefix := range registered {
+		if redirectPrefixMatches(prefix, uri) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectPrefixMatches compares scheme and host exactly, so a prefix can never send users to
+// another site, and requires uri's path to be the prefix's path or below it on a segment
+// boundary. Queries play no part: the prefix's is ignored and uri may carry any.
+func redirectPrefixMatches(prefix, uri string) bool {
+	p, err := url.Parse(prefix)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.User != nil || u.Fragment != "" {
+		return false
+	}
+
+	if !strings.EqualFold(p.Scheme, u.Scheme) || !strings.EqualFold(p.Host, u.Host) {
+		return false
+	}
+
+	// Dot segments would let a matching path climb out from under the prefix once resolved
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	base := strings.TrimSuffix(p.Path, "/")
+	return u.Path == p.Path || u.Path == base || strings.HasPrefix(u.Path, base+"/")
+}
+
+// checkRedirectHosts rejects web redirect URIs whose host is outside the configured allowlist.
+// Without an allowlist any host may be registered. Custom schemes have no web host to check.
+func (w *OAuthWrapper) checkRedirectHosts(uris []string) error {
+	if len(w.allowedRedirectHosts) == 0 {
+		return nil
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err == nil && !isWebScheme(u.Scheme) {
+			continue
+		}
+		if err != nil || !redirectHostAllowed(w.allowedRedirectHosts, u.Hostname()) {
+			return fmt.Errorf("redirect_uri %q is not on an allowed host", uri)
+		}
+	}
+	return nil
+}
+
+// redirectHostAllowed matches a host against exact entries and "*.example.com" entries, which
+// allow any subdomain of example.com but not example.com itself. Ports are not considered.
+func redirectHostAllowed(allowed []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range allowed {
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
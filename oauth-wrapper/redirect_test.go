@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedirectURIAllowed(t *testing.T) {
+	registered := []string{"https://app.example.com/oauth/callback", "http://localhost:3000/cb/"}
+
+	tests := []struct {
+		name       string
+		uri        string
+		wantExact  bool
+		wantPrefix bool
+	}{
+		{"exact", "https://app.example.com/oauth/callback", true, true},
+		{"sub path", "https://app.example.com/oauth/callback/tenant-1", false, true},
+		{"sub path of trailing slash", "http://localhost:3000/cb/x", false, true},
+		{"query string", "https://app.example.com/oauth/callback?session=1", false, true},
+		{"sibling path", "https://app.example.com/oauth/callbackevil", false, false},
+		{"parent path", "https://app.example.com/oauth", false, false},
+		{"dot segments", "https://app.example.com/oauth/callback/../../evil", false, false},
+		{"encoded dot segments", "https://app.example.com/oauth/callback/%2e%2e/%2e%2e/evil", false, false},
+		{"other host", "https://evil.example.com/oauth/callback", false, false},
+		{"host suffix", "https://app.example.com.evil.com/oauth/callback", false, false},
+		{"userinfo trick", "https://app.example.com@evil.com/oauth/callback", false, false},
+		{"other scheme", "http://app.example.com/oauth/callback", false, false},
+		{"other port", "https://app.example.com:8443/oauth/callback", false, false},
+		{"fragment", "https://app.example.com/oauth/callback/x#frag", false, false},
+		{"relative", "/oauth/callback/x", false, false},
+		{"loopback other port", "http://localhost:49152/cb/", true, true},
+		{"loopback other port and path", "http://localhost:49152/other/", false, false},
+		{"loopback other host", "http://127.0.0.1:3000/cb/", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWrapper("http://127.0.0.1:13080")
+			w.redirectMatch = redirectMatchExact
+			if got := w.redirectURIAllowed(registered, tt.uri); got != tt.wantExact {
+				t.Errorf("exact mode: got %v, want %v", got, tt.wantExact)
+			}
+			w.redirectMatch = redirectMatchPrefix
+			if got := w.redirectURIAllowed(registered, tt.uri); got != tt.wantPrefix {
+				t.Errorf("prefix mode: got %v, want %v", got, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithPrefixRedirect(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.redirectMatch = redirectMatchPrefix
+	w.clients["client"] = &ClientRegistrationResponse{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURIs: []string{"https://app.example.com/oauth/callback"},
+	}
+
+	q := url.Values{
+		"client_id":     {"client"},
+		"redirect_uri":  {"https://app.example.com/oauth/callback/tenant-1?keep=me"},
+		"response_type": {"code"},
+		"state":         {"xyz"},
+	}
+	rec := httptest.NewRecorder()
+	w.handleAuthorize(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected 302, got %d: %s", rec.Code, rec.Body)
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Path != "/oauth/callback/tenant-1" || loc.Query().Get("keep") != "me" || loc.Query().Get("code") == "" {
+		t.Errorf("unexpected redirect %s", loc)
+	}
+}
+
+func TestRedirectHostAllowed(t *testing.T) {
+	allowed := []string{"claude.ai", "*.example.com"}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"claude.ai", true},
+		{"CLAUDE.AI", true},
+		{"claude.ai.", true},
+		{"evil.claude.ai", false},
+		{"app.example.com", true},
+		{"a.b.example.com", true},
+		{"example.com", false},
+		{"evilexample.com", false},
+		{"example.com.evil.net", false},
+	}
+	for _, tt := range tests {
+		if got := redirectHostAllowed(allowed, tt.host); got != tt.want {
+			t.Errorf("redirectHostAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestHandleRegistrationChecksRedirectHosts(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.allowedRedirectHosts = []string{"claude.ai", "*.example.com"}
+
+	tests := []struct {
+		name   string
+		uris   string
+		status int
+	}{
+		{"allowed", `["https://claude.ai/api/mcp/auth_callback", "https://app.example.com:8443/cb"]`, http.StatusOK},
+		{"one outside", `["https://claude.ai/api/mcp/auth_callback", "https://evil.example.net/cb"]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"client_name":"Claude","redirect_uris":` + tt.uris + `}`
+			rec := httptest.NewRecorder()
+			w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status == http.StatusBadRequest && decodeJSONError(t, rec)["error"] != "invalid_redirect_uri" {
+				t.Error("expected invalid_redirect_uri")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"syscall"
+)
+
+// secrets are the credentials that can be rotated at runtime with SIGHUP
+type secrets struct {
+	SlackToken        string
+	SlackBotToken     string
+	SSEAPIKey         string
+	RegistrationToken string
+	AdminToken        string
+}
+
+func secretsFromConfig(cfg *Config) *secrets {
+	return &secrets{
+		SlackToken:        cfg.SlackToken,
+		SlackBotToken:     cfg.SlackBotToken,
+		SSEAPIKey:         cfg.SSEAPIKey,
+		RegistrationToken: cfg.RegistrationToken,
+		AdminToken:        cfg.AdminToken,
+	}
+}
+
+// currentSecrets returns the credentials in effect right now
+func (w *OAuthWrapper) currentSecrets() *secrets {
+	return w.secrets.Load()
+}
+
+// sseAPIKeyCredential is the default MCP credential: the current SSE API key for every token
+func (w *OAuthWrapper) sseAPIKeyCredential(*AccessToken) string {
+	if key := w.currentSecrets().SSEAPIKey; key != "" {
+		return "Bearer " + key
+	}
+	return ""
+}
+
+// reloadSecrets swaps in the secrets from a freshly loaded config and returns which ones changed.
+// Existing SSE connections and issued tokens are untouched.
+func (w *OAuthWrapper) reloadSecrets(cfg *Config) []string {
+	next := secretsFromConfig(cfg)
+	prev := w.secrets.Swap(next)
+
+	var changed []string
+	if prev.SlackToken != next.SlackToken {
+		changed = append(changed, "slack_token")
+	}
+	if prev.SlackBotToken != next.SlackBotToken {
+		changed = append(changed, "slack_bot_token")
+	}
+	if prev.SSEAPIKey != next.SSEAPIKey {
+		changed = append(changed, "sse_api_key")
+	}
+	if prev.RegistrationToken != next.RegistrationToken {
+		changed = append(changed, "registration_token")
+	}
+	if prev.AdminToken != next.AdminToken {
+		changed = append(changed, "admin_token")
+	}
+	return changed
+}
+
+// watchReload re-reads the configuration on SIGHUP and applies the secrets from it.
+// An invalid configuration is rejected and the running one kept.
+func (w *OAuthWrapper) watchReload(args []string, current *Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		cfg, err := loadConfig(args)
+		if err != nil {
+			slog.Error("Config reload rejected, keeping the running configuration", "error", err)
+			continue
+		}
+
+		changed := w.reloadSecrets(cfg)
+		slog.Info("Config reloaded", "changed_secrets", changed, "config", cfg)
+
+		// A new Slack token has to prove its workspace again
+		if w.expectedTeamID != "" && (slices.Contains(changed, "slack_token") || slices.Contains(changed, "slack_bot_token")) {
+			go w.verifyTeam(context.Background())
+		}
+
+		// Only secrets are applied live; anything else needs a restart
+		if !reflect.DeepEqual(withoutSecrets(cfg), withoutSecrets(current)) {
+			slog.Warn("Config reload found changes to settings other than secrets; restart to apply them")
+		}
+		current = cfg
+	}
+}
+
+// withoutSecrets copies a config with its secrets cleared, for comparing the rest
+func withoutSecrets(cfg *Config) Config {
+	c := *cfg
+	c.SlackToken, c.SlackBotToken, c.SSEAPIKey, c.RegistrationToken, c.AdminToken = "", "", "", "", ""
+	return c
+}
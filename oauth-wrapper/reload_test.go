@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestReloadSecrets(t *testing.T) {
+	w := newOAuthWrapper(&Config{SlackToken: "xoxp-old", SSEAPIKey: "key-old", MaxBodyBytes: 1})
+
+	changed := w.reloadSecrets(&Config{SlackToken: "xoxp-old", SSEAPIKey: "key-new", RegistrationToken: "reg"})
+	if !slices.Equal(changed, []string{"sse_api_key", "registration_token"}) {
+		t.Errorf("unexpected changed secrets %v", changed)
+	}
+	if got := w.mcpCredential(nil); got != "Bearer key-new" {
+		t.Errorf("expected the proxy to use the rotated key, got %q", got)
+	}
+	if got := w.currentSecrets().RegistrationToken; got != "reg" {
+		t.Errorf("expected the rotated registration token, got %q", got)
+	}
+}
+
+func TestWithoutSecretsIgnoresOnlySecrets(t *testing.T) {
+	a := &Config{Port: "8080", SlackToken: "a", SSEAPIKey: "a", RegistrationToken: "a"}
+	b := &Config{Port: "8080", SlackToken: "b", SSEAPIKey: "b", RegistrationToken: "b"}
+	if !reflect.DeepEqual(withoutSecrets(a), withoutSecrets(b)) {
+		t.Error("configs differing only in secrets should compare equal")
+	}
+	b.Port = "9090"
+	if reflect.DeepEqual(withoutSecrets(a), withoutSecrets(b)) {
+		t.Error("configs differing in other settings should not compare equal")
+	}
+}
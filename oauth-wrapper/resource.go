@@ -0,0 +1,11 @@
+package main
+
+import "strings"
+
+// Resource indicators (RFC 8707) let a client request a token that is only valid for one backend.
+// They are enforced only when resources or token audiences are configured; see audience.go.
+
+// normalizeResource makes trailing slashes irrelevant when comparing resource URIs
+func normalizeResource(resource string) string {
+	return strings.TrimSuffix(resource, "/")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RevokeAllResult counts what an emergency revocation removed
+type RevokeAllResult struct {
+	AuthCodes      int   `json:"auth_codes"`
+	AccessTokens   int   `json:"access_tokens"`
+	Tickets        int   `json:"tickets"`
+	Clients        int   `json:"clients"`
+	SSEConnections int64 `json:"sse_connections"`
+}
+
+// streamKillSwitch is closed by revoke-all to end every SSE stream open at the time; streams
+// opened afterwards get a fresh one
+type streamKillSwitch struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// current returns the channel closed by the next trip
+func (k *streamKillSwitch) current() <-chan struct{} {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.ch == nil {
+		k.ch = make(chan struct{})
+	}
+	return k.ch
+}
+
+func (k *streamKillSwitch) trip() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.ch != nil {
+		close(k.ch)
+	}
+	k.ch = make(chan struct{})
+}
+
+// Handle the admin kill switch: every authorization code, access token and ticket is revoked and
+// open SSE streams are closed. Client registrations are kept unless include_clients=true, so
+// clients can sign in again without registering.
+func (w *OAuthWrapper) handleAdminRevokeAll(rw http.ResponseWriter, r *http.Request) {
+	includeClients := false
+	if v := r.URL.Query().Get("include_clients"); v != "" {
+		var err error
+		if includeClients, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(rw, http.StatusBadRequest, "invalid_request", "include_clients must be true or false")
+			return
+		}
+	}
+
+	result := w.revokeAll(includeClients)
+	slog.WarnContext(r.Context(), "AUDIT: revoked all codes and tokens",
+		"auth_codes", result.AuthCodes,
+		"access_tokens", result.AccessTokens,
+		"tickets", result.Tickets,
+		"clients", result.Clients,
+		"sse_connections", result.SSEConnections,
+	)
+	w.notifySlack(fmt.Sprintf("All tokens revoked by an administrator at %s (%d access tokens, %d codes, %d clients)",
+		w.now().UTC().Format(time.RFC3339), result.AccessTokens, result.AuthCodes, result.Clients))
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(result)
+}
+
+// revokeAll drops all codes, tokens and tickets, and optionally all clients, and closes open SSE streams
+func (w *OAuthWrapper) revokeAll(includeClients bool) RevokeAllResult {
+	var result RevokeAllResult
+	w.mu.Lock()
+	result.AuthCodes, result.Tickets = len(w.authCodes), len(w.tickets)
+	clear(w.authCodes)
+	clear(w.tickets)
+	if includeClients {
+		result.Clients = len(w.clients)
+		clear(w.clients)
+		registeredClients.Set(0)
+	}
+	w.mu.Unlock()
+
+	result.AccessTokens = w.accessTokens.Clear()
+	accessTokensGauge.Set(int64(w.accessTokens.Len()))
+	w.userInfo.clear()
+
+	result.SSEConnections = sseConnections.value.Load()
+	w.streamKill.trip()
+	return result
+}
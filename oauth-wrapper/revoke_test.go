@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminRevokeAll(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.secrets.Store(&secrets{AdminToken: "admin"})
+	w.authCodes["code"] = &AuthCode{ClientID: "client", ExpiresAt: now.Add(time.Minute)}
+	w.accessTokens.Set("a", &AccessToken{ClientID: "client", ExpiresAt: now.Add(time.Hour)})
+	w.accessTokens.Set("b", &AccessToken{ClientID: "client", ExpiresAt: now.Add(time.Hour)})
+	w.tickets["ticket"] = &sseTicket{Token: "a", ClientID: "client", ExpiresAt: now.Add(time.Minute)}
+
+	if rec := adminRequest(w, http.MethodPost, "/admin/revoke-all?include_clients=maybe", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid include_clients, got %d", rec.Code)
+	}
+
+	rec := adminRequest(w, http.MethodPost, "/admin/revoke-all", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var result RevokeAllResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.AuthCodes != 1 || result.AccessTokens != 2 || result.Tickets != 1 || result.Clients != 0 {
+		t.Errorf("unexpected counts %+v", result)
+	}
+	if len(w.authCodes) != 0 || w.accessTokens.Len() != 0 || len(w.tickets) != 0 {
+		t.Error("expected every code, token and ticket to be gone")
+	}
+	if len(w.clients) != 1 {
+		t.Error("expected client registrations to be kept by default")
+	}
+
+	rec = adminRequest(w, http.MethodPost, "/admin/revoke-all?include_clients=true", nil)
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Clients != 1 || len(w.clients) != 0 {
+		t.Errorf("expected include_clients to remove the registration, got %+v", result)
+	}
+}
+
+func TestRevokeAllClosesOpenStreams(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sse" {
+			return
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(rw, "event: endpoint\ndata: /message\n\n")
+		rw.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	wrapperServer := httptest.NewServer(http.HandlerFunc(w.handleSSEProxy))
+	defer wrapperServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, wrapperServer.URL+"/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	w.revokeAll(false)
+	if _, err := io.ReadAll(resp.Body); ctx.Err() != nil {
+		t.Fatalf("expected the stream to be closed by the revocation, got %v", err)
+	}
+}
@@ -17,6 +17,11 @@ fi
 go mod tidy
 
 # Build the binary
-CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -o oauth-wrapper main.go
+VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo "0.0.0")
+COMMIT_HASH=$(git rev-parse HEAD 2>/dev/null || echo "unknown")
+BUILD_TIME=$(date -u '+%Y-%m-%dT%H:%M:%SZ')
+CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build \
+    -ldflags "-X main.Version=${VERSION} -X main.CommitHash=${COMMIT_HASH} -X main.BuildTime=${BUILD_TIME}" \
+    -o oauth-wrapper .
 
 echo "OAuth wrapper build complete"
\ No newline at end of file
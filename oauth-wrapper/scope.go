@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// parseScope splits a space-delimited scope parameter into its scope tokens, dropping duplicates
+// (RFC 6749 section 3.3)
+func parseScope(scope string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !validScopeToken(s) {
+			return nil, fmt.Errorf("scope %q contains characters that aren't allowed", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// validScopeToken checks a single scope against the scope-token syntax: printable ASCII
+// except space, double quote and backslash
+func validScopeToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// hasScope reports whether the token was granted scope
+func (at *AccessToken) hasScope(scope string) bool {
+	return slices.Contains(at.Scopes, scope)
+}
+
+// requireScope rejects a token lacking the scope the SSE proxy requires, as RFC 6750 section 3.1
+// describes, naming the scope in the challenge so the client can ask for it
+func (w *OAuthWrapper) requireScope(rw http.ResponseWriter, r *http.Request, at *AccessToken) bool {
+	if w.sseRequiredScope == "" || at.hasScope(w.sseRequiredScope) {
+		return true
+	}
+	oerr := &oauthError{http.StatusForbidden, "insufficient_scope", "The access token lacks the " + w.sseRequiredScope + " scope"}
+	w.writeTokenError(rw, w.publicURL+r.URL.Path, oerr, true, fmt.Sprintf("scope=%q", w.sseRequiredScope))
+	return false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScopeIsGrantedThroughTheCodeFlow(t *testing.T) {
+	w := newOAuthTestWrapper(time.Now())
+	redirect, err := w.authorize(authorizeRequest{ClientID: "client", RedirectURI: testRedirectURI, ResponseType: "code", Scope: "mcp:stream  mcp:read mcp:stream"})
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	resp, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: redirect.Query().Get("code"), ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI})
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	if resp.Scope != "mcp:stream mcp:read" {
+		t.Errorf("expected the deduplicated scope in the token response, got %q", resp.Scope)
+	}
+	if at, _ := w.accessTokens.Get(resp.AccessToken); !at.hasScope("mcp:stream") || at.hasScope("admin") {
+		t.Errorf("expected the token to carry the granted scopes, got %q", at.Scopes)
+	}
+}
+
+func TestSSEProxyRequiresScope(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.accessTokens.Set("read-only", &AccessToken{ClientID: "client", Scopes: []string{"mcp:read"}, ExpiresAt: time.Now().Add(time.Hour)})
+	w.accessTokens.Set("streaming", &AccessToken{ClientID: "client", Scopes: []string{"mcp:stream"}, ExpiresAt: time.Now().Add(time.Hour)})
+
+	sse := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		w.requireScope(rec, req, mustToken(t, w, token))
+		return rec
+	}
+
+	// Without a required scope every token is let through
+	if rec := sse("read-only"); rec.Code != http.StatusOK {
+		t.Errorf("expected no scope check by default, got %d", rec.Code)
+	}
+
+	w.sseRequiredScope = "mcp:stream"
+	rec := sse("read-only")
+	if rec.Code != http.StatusForbidden || decodeJSONError(t, rec)["error"] != "insufficient_scope" {
+		t.Fatalf("expected 403 insufficient_scope, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, `Bearer error="insufficient_scope"`) || !strings.Contains(got, `scope="mcp:stream"`) {
+		t.Errorf("expected a challenge naming the required scope, got %q", got)
+	}
+	if rec := sse("streaming"); rec.Code != http.StatusOK {
+		t.Errorf("expected a token with the scope to be let through, got %d", rec.Code)
+	}
+
+	// The scope is advertised so clients know to ask for it
+	w.resources = []string{"http://localhost:8080/sse"}
+	metadata := httptest.NewRecorder()
+	w.routes().ServeHTTP(metadata, httptest.NewRequest(http.MethodGet, protectedResourcePath, nil))
+	if !strings.Contains(metadata.Body.String(), `"scopes_supported":["mcp:stream"]`) {
+		t.Errorf("expected the required scope in the resource metadata, got %s", metadata.Body)
+	}
+}
+
+func mustToken(t *testing.T, w *OAuthWrapper, token string) *AccessToken {
+	t.Helper()
+	at, ok := w.accessTokens.Get(token)
+	if !ok {
+		t.Fatalf("no token %q", token)
+	}
+	return at
+}
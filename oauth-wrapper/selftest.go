@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+)
+
+// selfTestEvent is what the stub MCP backend streams, so the proxy step can see it arrive
+const selfTestEvent = "event: endpoint\ndata: /message?sessionId=selftest\n\n"
+
+// selfTest runs the whole OAuth flow against a wrapper built from cfg, for -selftest: register a
+// client, authorize, exchange the code and open /sse through the proxy. A stub stands in for the
+// MCP server, so no backend is needed. Each step is reported on out; the first failure stops the
+// test and is returned.
+func selfTest(out io.Writer, cfg *Config) error {
+	stub := httptest.NewServer(http.HandlerFunc(serveSelfTestBackend))
+	defer stub.Close()
+
+	stubbed := *cfg
+	stubbed.MCPURL, stubbed.MCPBackends = stub.URL, nil
+	stubbed.AdminAddr = ""
+	// The workspace check talks to Slack, which the self-test doesn't need
+	stubbed.ExpectedTeamID = ""
+	w := newOAuthWrapper(&stubbed)
+	w.started.Store(true)
+	st := &selfTestRun{w: w, handler: w.routes()}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"register", st.register},
+		{"authorize", st.authorize},
+		{"token", st.token},
+		{"proxy", st.proxy},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			fmt.Fprintf(out, "%s: FAILED: %v\n", step.name, err)
+			return fmt.Errorf("%s: %w", step.name, err)
+		}
+		fmt.Fprintf(out, "%s: ok\n", step.name)
+	}
+	fmt.Fprintln(out, "Self-test passed")
+	return nil
+}
+
+// serveSelfTestBackend answers like an MCP server: a short event stream on /sse, and a healthy
+// response to health checks in either mode
+func serveSelfTestBackend(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == sseEndpoint {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(rw, selfTestEvent)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	io.WriteString(rw, `{"jsonrpc":"2.0","id":"oauth-wrapper-health","result":{}}`)
+}
+
+// selfTestRun carries what each step of the self-test hands to the next
+type selfTestRun struct {
+	w       *OAuthWrapper
+	handler http.Handler
+
+	redirectURI string
+	client      ClientRegistrationResponse
+	verifier    string
+	code        string
+	accessToken string
+}
+
+// do sends a request through the wrapper's routes, as if over HTTPS so -require-https passes
+func (st *selfTestRun) do(req *http.Request) *httptest.ResponseRecorder {
+	req.TLS = &tls.ConnectionState{}
+	req.URL.Path = st.w.basePath + req.URL.Path
+	rec := httptest.NewRecorder()
+	st.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// selfTestRedirectURI is a redirect URI the configuration lets clients register: on the first
+// allowed host when hosts are restricted, loopback otherwise
+func selfTestRedirectURI(allowedHosts []string) string {
+	if len(allowedHosts) == 0 {
+		return "http://127.0.0.1/selftest/callback"
+	}
+	host := allowedHosts[0]
+	if strings.HasPrefix(host, "*.") {
+		host = "selftest" + host[1:]
+	}
+	return "https://" + host + "/selftest/callback"
+}
+
+func (st *selfTestRun) register() error {
+	st.redirectURI = selfTestRedirectURI(st.w.allowedRedirectHosts)
+	body, _ := json.Marshal(ClientRegistrationRequest{ClientName: "oauth-wrapper self-test", RedirectURIs: []string{st.redirectURI}})
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if regToken := st.w.currentSecrets().RegistrationToken; regToken != "" {
+		req.Header.Set("Authorization", "Bearer "+regToken)
+	}
+	rec := st.do(req)
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		return fmt.Errorf("/register returned %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&st.client); err != nil || st.client.ClientID == "" {
+		return fmt.Errorf("/register returned no client: %v", err)
+	}
+	return nil
+}
+
+func (st *selfTestRun) authorize() error {
+	st.verifier = generateRandomString(64)
+	sum := sha256.Sum256([]byte(st.verifier))
+	q := url.Values{
+		"client_id":             {st.client.ClientID},
+		"redirect_uri":          {st.redirectURI},
+		"response_type":         {"code"},
+		"state":                 {"selftest"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if st.w.sseRequiredScope != "" {
+		q.Set("scope", st.w.sseRequiredScope)
+	}
+	rec := st.do(httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil))
+	if rec.Code != http.StatusFound {
+		return fmt.Errorf("/authorize returned %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		return fmt.Errorf("/authorize redirected to an invalid URL: %w", err)
+	}
+	if e := location.Query().Get("error"); e != "" {
+		return fmt.Errorf("/authorize redirected with %s: %s", e, location.Query().Get("error_description"))
+	}
+	if st.code = location.Query().Get("code"); st.code == "" || location.Query().Get("state") != "selftest" {
+		return fmt.Errorf("/authorize redirected without a code and the state: %s", location)
+	}
+	return nil
+}
+
+func (st *selfTestRun) token() error {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {st.code},
+		"redirect_uri":  {st.redirectURI},
+		"code_verifier": {st.verifier},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(st.client.ClientID, st.client.ClientSecret)
+	rec := st.do(req)
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("/token returned %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	var resp TokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.AccessToken == "" {
+		return fmt.Errorf("/token returned no access token: %v", err)
+	}
+	st.accessToken = resp.AccessToken
+	return nil
+}
+
+func (st *selfTestRun) proxy() error {
+	req := httptest.NewRequest(http.MethodGet, sseEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+st.accessToken)
+	req.Header.Set("Accept", "text/event-stream")
+	if u, err := url.Parse(st.redirectURI); err == nil {
+		req.Header.Set("Origin", u.Scheme+"://"+u.Host)
+	}
+	rec := st.do(req)
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("/sse returned %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	if !strings.Contains(rec.Body.String(), selfTestEvent) {
+		return fmt.Errorf("/sse did not relay the stub MCP server's event stream, got %q", rec.Body.String())
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	cfg, err := loadConfig([]string{"-selftest", "-registration-token", "reg-token", "-sse-required-scope", "mcp:stream", "-base-path", "/oauth"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	var out strings.Builder
+	if err := selfTest(&out, cfg); err != nil {
+		t.Fatalf("selfTest: %v\n%s", err, out.String())
+	}
+	for _, step := range []string{"register: ok", "authorize: ok", "token: ok", "proxy: ok", "Self-test passed"} {
+		if !strings.Contains(out.String(), step) {
+			t.Errorf("expected %q in the report, got:\n%s", step, out.String())
+		}
+	}
+}
+
+func TestSelfTestReportsFailure(t *testing.T) {
+	t.Setenv("SLACK_MCP_XOXP_TOKEN", "xoxp-env")
+	// Tokens that expire on issue, with no skew allowance, can't open /sse
+	cfg, err := loadConfig([]string{"-selftest", "-token-ttl", "1ns", "-min-ttl", "1ns", "-clock-skew", "0s"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	var out strings.Builder
+	err = selfTest(&out, cfg)
+	if err == nil || !strings.HasPrefix(err.Error(), "proxy:") {
+		t.Fatalf("expected the proxy step to fail, got %v:\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "token: ok") || !strings.Contains(out.String(), "proxy: FAILED") || strings.Contains(out.String(), "Self-test passed") {
+		t.Errorf("expected the earlier steps to pass and the proxy step to be reported failed, got:\n%s", out.String())
+	}
+}
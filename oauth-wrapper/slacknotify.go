@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// slackNotifyQueueSize is how many notifications may wait to be posted; more are dropped
+	slackNotifyQueueSize = 20
+	// slackNotifyInterval spaces out posts, so a registration storm can't flood the channel
+	slackNotifyInterval = 2 * time.Second
+)
+
+// slackNotifier posts client lifecycle events to a Slack channel in the background, at most one
+// message per interval. Events arriving faster than that queue up, and are counted and dropped
+// once the queue is full.
+type slackNotifier struct {
+	channel  string
+	interval time.Duration
+	queue    chan string
+	dropped  atomic.Int64
+}
+
+func newSlackNotifier(channel string) *slackNotifier {
+	return &slackNotifier{channel: channel, interval: slackNotifyInterval, queue: make(chan string, slackNotifyQueueSize)}
+}
+
+// notifySlack queues a message for the notification channel, if one is configured. It never blocks.
+func (w *OAuthWrapper) notifySlack(text string) {
+	if w.notifier == nil {
+		return
+	}
+	select {
+	case w.notifier.queue <- text:
+	default:
+		w.notifier.dropped.Add(1)
+	}
+}
+
+// runSlackNotifier posts queued notifications until ctx is done
+func (w *OAuthWrapper) runSlackNotifier(ctx context.Context) {
+	if w.notifier == nil {
+		return
+	}
+	for {
+		var text string
+		select {
+		case <-ctx.Done():
+			return
+		case text = <-w.notifier.queue:
+		}
+		if n := w.notifier.dropped.Swap(0); n > 0 {
+			text += fmt.Sprintf("\n_%d more notifications were dropped to avoid flooding the channel_", n)
+		}
+
+		params := url.Values{"channel": {w.notifier.channel}, "text": {text}}
+		if slackToken, err := w.slackTokens.SlackToken(ctx); err != nil {
+			slog.Warn("Slack notification dropped, no Slack token", "channel", w.notifier.channel, "error", err)
+		} else if err := w.callSlack(ctx, slackToken, "chat.postMessage", params, &struct{}{}); err != nil {
+			slog.Warn("Slack notification failed", "channel", w.notifier.channel, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.notifier.interval):
+		}
+	}
+}
+
+// clientName returns the registered name of a client, or its ID if it has none or is unknown
+func (w *OAuthWrapper) clientName(clientID string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if client, ok := w.clients[clientID]; ok && client.ClientName != "" {
+		return client.ClientName
+	}
+	return clientID
+}
+
+// slackEscape escapes the characters Slack treats as markup, so client-chosen names can't mention
+// users or channels
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackNotifications(t *testing.T) {
+	posts := make(chan http.Header, 10)
+	texts := make(chan string, 10)
+	slack := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.FormValue("channel") != "C123" {
+			io.WriteString(rw, `{"ok":false,"error":"channel_not_found"}`)
+			return
+		}
+		posts <- r.Header
+		texts <- r.FormValue("text")
+		io.WriteString(rw, `{"ok":true}`)
+	}))
+	defer slack.Close()
+
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.secrets.Store(&secrets{SlackToken: "xoxp-test"})
+	w.slackAPIURL = slack.URL
+	w.notifier = newSlackNotifier("C123")
+	w.notifier.interval = time.Millisecond
+
+	rec := httptest.NewRecorder()
+	w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"client_name":"<!channel> Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the registration to succeed, got %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.runSlackNotifier(ctx)
+
+	select {
+	case header := <-posts:
+		if header.Get("Authorization") != "Bearer xoxp-test" {
+			t.Errorf("expected the configured Slack token, got %q", header.Get("Authorization"))
+		}
+		text := <-texts
+		if !strings.Contains(text, "registered") || !strings.Contains(text, "&lt;!channel&gt; Claude") {
+			t.Errorf("expected an escaped registration summary, got %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a chat.postMessage call")
+	}
+}
+
+func TestSlackNotificationsDropWhenQueueIsFull(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.notifier = newSlackNotifier("C123")
+
+	for i := 0; i < slackNotifyQueueSize+5; i++ {
+		w.notifySlack("event")
+	}
+	if got := w.notifier.dropped.Load(); got != 5 {
+		t.Errorf("expected 5 dropped notifications, got %d", got)
+	}
+
+	// Without a channel, notifying is a no-op
+	w.notifier = nil
+	w.notifySlack("event")
+}
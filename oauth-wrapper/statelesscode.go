@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// minCodeKeyLength is the shortest SLACK_MCP_OAUTH_CODE_KEY accepted for stateless codes
+const minCodeKeyLength = 32
+
+// statelessCodeAD binds sealed codes to their purpose, so nothing else sealed with the key passes as one
+var statelessCodeAD = []byte("slack-mcp-oauth authorization code v1")
+
+// sealedCode is the content of a stateless authorization code
+type sealedCode struct {
+	ID            string   `json:"jti"`
+	ClientID      string   `json:"client_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	CodeChallenge string   `json:"code_challenge,omitempty"`
+	Audience      []string `json:"aud,omitempty"`
+	Scopes        []string `json:"scope,omitempty"`
+	IssuedAt      int64    `json:"iat"`
+	ExpiresAt     int64    `json:"exp"`
+}
+
+// codeSealer encrypts authorization codes with AES-256-GCM, so the code itself carries what a
+// stored AuthCode would and any replica holding the key can redeem it
+type codeSealer struct {
+	aead cipher.AEAD
+}
+
+// newCodeSealer derives the AES-256 key from the configured code key
+func newCodeSealer(key string) *codeSealer {
+	sum := sha256.Sum256([]byte(key))
+	// Neither call can fail for a 32-byte key
+	block, _ := aes.NewCipher(sum[:])
+	aead, _ := cipher.NewGCM(block)
+	return &codeSealer{aead: aead}
+}
+
+// seal turns an authorization code into its opaque string form, identified by id for replay checks
+func (s *codeSealer) seal(id string, code *AuthCode) (string, error) {
+	payload, err := json.Marshal(sealedCode{
+		ID:            id,
+		ClientID:      code.ClientID,
+		RedirectURI:   code.RedirectURI,
+		CodeChallenge: code.CodeChallenge,
+		Audience:      code.Audience,
+		Scopes:        code.Scopes,
+		IssuedAt:      code.IssuedAt.UnixNano(),
+		ExpiresAt:     code.ExpiresAt.UnixNano(),
+	})
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, payload, statelessCodeAD)), nil
+}
+
+// open verifies and decrypts a sealed code, returning it with its id
+func (s *codeSealer) open(code string) (string, *AuthCode, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(code)
+	if err != nil || len(raw) < s.aead.NonceSize() {
+		return "", nil, errors.New("malformed code")
+	}
+	nonce, ciphertext := raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():]
+	payload, err := s.aead.Open(nil, nonce, ciphertext, statelessCodeAD)
+	if err != nil {
+		return "", nil, errors.New("code failed verification")
+	}
+	var sc sealedCode
+	if err := json.Unmarshal(payload, &sc); err != nil || sc.ID == "" {
+		return "", nil, errors.New("malformed code")
+	}
+	return sc.ID, &AuthCode{
+		ClientID:      sc.ClientID,
+		RedirectURI:   sc.RedirectURI,
+		CodeChallenge: sc.CodeChallenge,
+		Audience:      sc.Audience,
+		Scopes:        sc.Scopes,
+		IssuedAt:      time.Unix(0, sc.IssuedAt),
+		ExpiresAt:     time.Unix(0, sc.ExpiresAt),
+	}, nil
+}
+
+// takeAuthCode redeems an authorization code, which can only happen once: stored codes are removed,
+// and stateless codes have their id recorded until they expire
+func (w *OAuthWrapper) takeAuthCode(code string) (*AuthCode, bool) {
+	if w.codeSealer != nil {
+		id, authCode, err := w.codeSealer.open(code)
+		if err != nil {
+			return nil, false
+		}
+		return authCode, w.usedCodeIDs.use(id, authCode.ExpiresAt.Add(w.clockSkew), w.now()) == nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	authCode, exists := w.authCodes[code]
+	if exists {
+		delete(w.authCodes, code) // Use once only
+	}
+	return authCode, exists
+}
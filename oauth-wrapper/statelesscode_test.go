@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testCodeKey = "0123456789abcdef0123456789abcdef"
+
+func TestStatelessCodesRedeemOnAnotherReplica(t *testing.T) {
+	now := time.Now()
+	issuer, redeemer := newOAuthTestWrapper(now), newOAuthTestWrapper(now)
+	issuer.codeSealer, redeemer.codeSealer = newCodeSealer(testCodeKey), newCodeSealer(testCodeKey)
+	issuer.tokenAudience = []string{"https://mcp.example.com"}
+
+	redirect, err := issuer.authorize(authorizeRequest{ClientID: "client", RedirectURI: testRedirectURI, ResponseType: "code", Scope: "mcp:stream"})
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if len(issuer.authCodes) != 0 {
+		t.Error("expected no server-side state for a stateless code")
+	}
+
+	req := tokenRequest{GrantType: "authorization_code", Code: redirect.Query().Get("code"), ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI}
+	resp, err := redeemer.exchangeCode(req)
+	if err != nil {
+		t.Fatalf("expected a replica sharing the key to redeem the code, got %v", err)
+	}
+	if resp.Scope != "mcp:stream" {
+		t.Errorf("expected the sealed scope to be granted, got %q", resp.Scope)
+	}
+	if at, _ := redeemer.accessTokens.Get(resp.AccessToken); len(at.Audience) != 1 || at.Audience[0] != "https://mcp.example.com" {
+		t.Errorf("expected the sealed audience to be granted, got %v", at.Audience)
+	}
+
+	_, err = redeemer.exchangeCode(req)
+	wantOAuthError(t, err, http.StatusBadRequest, "")
+}
+
+func TestStatelessCodesRejectForgeries(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.codeSealer = newCodeSealer(testCodeKey)
+
+	sealed := func(sealer *codeSealer, expiresAt time.Time) string {
+		code, err := sealer.seal("id-"+expiresAt.String(), &AuthCode{ClientID: "client", RedirectURI: testRedirectURI, IssuedAt: now, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	valid := sealed(w.codeSealer, now.Add(time.Minute))
+	tampered := []byte(valid)
+	tampered[len(tampered)/2] ^= 1
+
+	tests := map[string]string{
+		"other key": sealed(newCodeSealer("another key that is long enough!!"), now.Add(time.Minute)),
+		"tampered":  string(tampered),
+		"garbage":   "not-a-sealed-code",
+		"expired":   sealed(w.codeSealer, now.Add(-time.Minute)),
+	}
+	for name, code := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := w.exchangeCode(tokenRequest{GrantType: "authorization_code", Code: code, ClientID: "client", ClientSecret: "secret", RedirectURI: testRedirectURI})
+			wantOAuthError(t, err, http.StatusBadRequest, "")
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// loadStaticClients registers the clients declared in path at startup, so deployments can serve
+// known clients with registration locked down. The file is in the /admin/clients/export format,
+// except that a confidential client may give its client_secret in plain text; it is hashed on
+// load. Static clients can't be replaced by an import.
+func (w *OAuthWrapper) loadStaticClients(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read static clients file: %w", err)
+	}
+	var export ClientExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("static clients file %s is not a client export: %w", path, err)
+	}
+
+	var errs []error
+	seen := make(map[string]bool, len(export.Clients))
+	for i := range export.Clients {
+		client := &export.Clients[i]
+		if seen[client.ClientID] {
+			errs = append(errs, fmt.Errorf("clients[%d]: duplicate client_id %q", i, client.ClientID))
+			continue
+		}
+		seen[client.ClientID] = true
+		if err := w.validateStaticClient(client); err != nil {
+			errs = append(errs, fmt.Errorf("clients[%d]: %w", i, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("static clients file %s:\n%w", path, err)
+	}
+
+	issuedAt := w.now().Unix()
+	w.mu.Lock()
+	for _, client := range export.Clients {
+		stored := client.ClientRegistrationResponse
+		stored.ClientSecretHash = client.ClientSecretHash
+		stored.ClientSecretExpiresAt = 0
+		stored.Static = true
+		if stored.ClientIDIssuedAt == 0 {
+			stored.ClientIDIssuedAt = issuedAt
+		}
+		w.clients[stored.ClientID] = &stored
+	}
+	registeredClients.Set(int64(len(w.clients)))
+	w.mu.Unlock()
+
+	slog.Info("Loaded static clients", "path", path, "clients", len(export.Clients))
+	return nil
+}
+
+// validateStaticClient hashes a plain text secret and then applies the import rules, which also
+// require confidential clients to have a secret
+func (w *OAuthWrapper) validateStaticClient(client *ExportedClient) error {
+	if client.ClientSecret != "" {
+		if client.ClientSecretHash != "" {
+			return errors.New("give either client_secret or client_secret_hash, not both")
+		}
+		if len(client.ClientSecret) < minRandomLength {
+			return fmt.Errorf("client_secret must be at least %d characters", minRandomLength)
+		}
+		client.ClientSecretHash = hashClientSecret(client.ClientSecret)
+		client.ClientSecret = ""
+	}
+	return w.validateImportedClient(client)
+}
+
+// isStatic reports whether clientID was declared in the static clients file
+func (w *OAuthWrapper) isStatic(clientID string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	client, exists := w.clients[clientID]
+	return exists && client.Static
+}
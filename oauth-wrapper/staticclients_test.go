@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeStaticClients writes a static clients file and returns its path
+func writeStaticClients(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clients.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadStaticClients(t *testing.T) {
+	secret := strings.Repeat("s", minRandomLength)
+	path := writeStaticClients(t, `{"clients": [
+		{"client_id": "ci-bot", "client_name": "CI bot", "client_secret": "`+secret+`", "redirect_uris": ["https://ci.example.com/callback"], "token_endpoint_auth_method": "client_secret_basic"},
+		{"client_id": "inspector", "client_name": "Inspector", "redirect_uris": ["http://localhost/callback"], "token_endpoint_auth_method": "none"}
+	]}`)
+
+	w := newTestWrapper("http://127.0.0.1:13080")
+	if err := w.loadStaticClients(path); err != nil {
+		t.Fatalf("loadStaticClients: %v", err)
+	}
+	bot, ok := w.clients["ci-bot"]
+	if !ok || !bot.Static || w.clients["inspector"] == nil || !w.clients["inspector"].Static {
+		t.Fatalf("expected both clients registered as static, got %v", w.clients)
+	}
+	if bot.ClientSecret != "" || !bot.secretMatches(secret) || bot.secretMatches("wrong") {
+		t.Error("expected the plain text secret to be kept only as a hash")
+	}
+	if bot.ClientIDIssuedAt == 0 || bot.ClientSecretExpiresAt != 0 {
+		t.Errorf("expected an issue time and a non-expiring secret, got %d and %d", bot.ClientIDIssuedAt, bot.ClientSecretExpiresAt)
+	}
+
+	// An import can't replace a static client
+	w.secrets.Store(&secrets{AdminToken: "admin"})
+	body := `{"clients": [{"client_id": "inspector", "client_name": "Impostor", "redirect_uris": ["https://evil.example/cb"], "token_endpoint_auth_method": "none"}]}`
+	if rec := adminRequest(w, http.MethodPost, "/admin/clients/import", strings.NewReader(body)); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected the import to be rejected, got %d: %s", rec.Code, rec.Body)
+	}
+	if w.clients["inspector"].ClientName != "Inspector" {
+		t.Error("the static client must not be replaced")
+	}
+}
+
+func TestLoadStaticClientsValidation(t *testing.T) {
+	secret := strings.Repeat("s", minRandomLength)
+	tests := []struct {
+		name    string
+		clients string
+		want    string
+	}{
+		{"duplicate", `{"client_id": "a", "client_name": "A", "redirect_uris": ["https://a.example/cb"], "token_endpoint_auth_method": "none"}, {"client_id": "a", "client_name": "A", "redirect_uris": ["https://a.example/cb"], "token_endpoint_auth_method": "none"}`, "duplicate client_id"},
+		{"missing secret", `{"client_id": "a", "client_name": "A", "redirect_uris": ["https://a.example/cb"]}`, "client_secret_hash"},
+		{"short secret", `{"client_id": "a", "client_name": "A", "client_secret": "short", "redirect_uris": ["https://a.example/cb"]}`, "at least"},
+		{"secret and hash", `{"client_id": "a", "client_name": "A", "client_secret": "` + secret + `", "client_secret_hash": "` + hashClientSecret(secret) + `", "redirect_uris": ["https://a.example/cb"]}`, "not both"},
+		{"invalid client_id", `{"client_id": "a b", "client_name": "A", "redirect_uris": ["https://a.example/cb"], "token_endpoint_auth_method": "none"}`, "client_id"},
+		{"no redirect URIs", `{"client_id": "a", "client_name": "A", "token_endpoint_auth_method": "none"}`, "redirect_uri"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWrapper("http://127.0.0.1:13080")
+			err := w.loadStaticClients(writeStaticClients(t, `{"clients": [`+tt.clients+`]}`))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+			if len(w.clients) != 0 {
+				t.Error("no client may be registered when any entry is invalid")
+			}
+		})
+	}
+
+	w := newTestWrapper("http://127.0.0.1:13080")
+	if err := w.loadStaticClients(writeStaticClients(t, `[]`)); err == nil {
+		t.Error("expected an error for a file that isn't a client export")
+	}
+	if err := w.loadStaticClients(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// teamCheckRetryInterval is how soon a team check that couldn't reach Slack is tried again
+const teamCheckRetryInterval = 30 * time.Second
+
+// teamCheckResult is the outcome of the last check of which workspace the Slack token belongs to
+type teamCheckResult struct {
+	teamID string
+	team   string
+	err    error
+}
+
+// teamVerified reports whether the Slack token may be used: always without an expected team,
+// otherwise only once auth.test has confirmed the token belongs to it
+func (w *OAuthWrapper) teamVerified() bool {
+	if w.expectedTeamID == "" {
+		return true
+	}
+	result := w.teamCheck.Load()
+	return result != nil && result.err == nil && result.teamID == w.expectedTeamID
+}
+
+// teamCheckStatus explains why teamVerified is false, for /ready
+func (w *OAuthWrapper) teamCheckStatus() string {
+	result := w.teamCheck.Load()
+	switch {
+	case result == nil:
+		return "Slack workspace not verified yet"
+	case result.err != nil:
+		return "Slack workspace could not be verified: " + result.err.Error()
+	default:
+		return fmt.Sprintf("Slack token belongs to team %s, expected %s", result.teamID, w.expectedTeamID)
+	}
+}
+
+// verifyTeam asks Slack which workspace the current token belongs to (auth.test) and records the
+// result. It returns the error when Slack couldn't answer; a mismatch is a definite result.
+func (w *OAuthWrapper) verifyTeam(ctx context.Context) error {
+	var auth struct {
+		TeamID string `json:"team_id"`
+		Team   string `json:"team"`
+	}
+	token, err := w.slackTokens.SlackToken(ctx)
+	if err == nil {
+		err = w.callSlack(ctx, token, "auth.test", nil, &auth)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not verify the Slack workspace behind the token", "expected_team_id", w.expectedTeamID, "error", err)
+		w.teamCheck.Store(&teamCheckResult{err: err})
+		return err
+	}
+
+	prev := w.teamCheck.Swap(&teamCheckResult{teamID: auth.TeamID, team: auth.Team})
+	switch {
+	case auth.TeamID != w.expectedTeamID:
+		slog.ErrorContext(ctx, "Slack token belongs to an unexpected workspace; refusing to proxy",
+			"team_id", auth.TeamID, "team", auth.Team, "expected_team_id", w.expectedTeamID)
+	case prev == nil || prev.teamID != auth.TeamID:
+		slog.InfoContext(ctx, "Slack token verified for the expected workspace", "team_id", auth.TeamID, "team", auth.Team)
+	}
+	return nil
+}
+
+// runTeamCheck verifies the workspace at startup, then every teamCheckInterval when set. A check that
+// couldn't reach Slack is retried sooner, since nothing is proxied until the team is confirmed.
+func (w *OAuthWrapper) runTeamCheck(ctx context.Context) {
+	if w.expectedTeamID == "" {
+		return
+	}
+	for {
+		delay := w.teamCheckInterval
+		if err := w.verifyTeam(ctx); err != nil && (delay <= 0 || delay > teamCheckRetryInterval) {
+			delay = teamCheckRetryInterval
+		}
+		if delay <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
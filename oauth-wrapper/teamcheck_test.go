@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTeamCheck(t *testing.T) {
+	slack, _ := slackAPI(t, false)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			rw.Header().Set("Content-Type", "text/event-stream")
+		}
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.slackAPIURL = slack.URL
+	w.started.Store(true)
+	w.accessTokens.Set("valid", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+	handler := w.routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if !w.teamVerified() {
+		t.Fatal("without an expected team every token should be accepted")
+	}
+
+	w.expectedTeamID = "T456"
+	if rec := get("/ready"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "not verified yet") {
+		t.Errorf("expected /ready to fail before the first check, got %d %s", rec.Code, rec.Body)
+	}
+
+	w.secrets.Store(&secrets{SlackToken: "xoxp-wrong"})
+	if err := w.verifyTeam(context.Background()); err == nil || w.teamVerified() {
+		t.Error("expected a token Slack rejects to leave the team unverified")
+	}
+
+	w.secrets.Store(&secrets{SlackToken: "xoxp-test"})
+	if err := w.verifyTeam(context.Background()); err != nil || !w.teamVerified() {
+		t.Fatalf("expected the matching team to be verified, got %v", err)
+	}
+	if rec := get("/ready"); rec.Code != http.StatusOK {
+		t.Errorf("expected /ready to pass for the expected team, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := get("/sse"); rec.Code != http.StatusOK {
+		t.Errorf("expected /sse to be proxied for the expected team, got %d %s", rec.Code, rec.Body)
+	}
+
+	w.expectedTeamID = "T999"
+	w.verifyTeam(context.Background())
+	if rec := get("/ready"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "T456") {
+		t.Errorf("expected /ready to fail naming the detected team, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := get("/sse"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected /sse to be refused for an unexpected team, got %d", rec.Code)
+	}
+}
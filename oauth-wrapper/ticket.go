@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// SSE tickets let clients that can't set headers, like a browser EventSource, open /sse without
+// putting their long-lived access token in the URL: they exchange the token for a ticket and pass
+// that as ?ticket= instead. A ticket works once and only briefly.
+const (
+	ticketEndpoint = "/sse-ticket"
+	ticketParam    = "ticket"
+	ticketTTL      = 30 * time.Second
+	ticketMarker   = "tk_"
+)
+
+// sseTicket stands in for the access token it was issued for
+type sseTicket struct {
+	Token     string
+	ClientID  string
+	ExpiresAt time.Time
+}
+
+// TicketResponse is returned by the ticket endpoint
+type TicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// Handle ticket requests, authenticated with the access token the ticket will stand in for
+func (w *OAuthWrapper) handleSSETicket(rw http.ResponseWriter, r *http.Request) {
+	token, accessToken, ok := w.authenticate(rw, r, w.publicURL+sseEndpoint)
+	if !ok {
+		return
+	}
+	// A ticket can't carry a DPoP proof, so it would turn a sender-constrained token into a bearer one
+	if accessToken.DPoPThumbprint != "" {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_request", "DPoP-bound tokens can't be exchanged for tickets")
+		return
+	}
+	if accessToken.CertThumbprint != "" {
+		writeJSONError(rw, http.StatusBadRequest, "invalid_request", "Certificate-bound tokens can't be exchanged for tickets")
+		return
+	}
+
+	ticket := w.tokenPrefix + ticketMarker + generateRandomString(w.tokenLength)
+	now := w.now()
+	w.mu.Lock()
+	for t, st := range w.tickets {
+		if now.After(st.ExpiresAt) {
+			delete(w.tickets, t)
+		}
+	}
+	w.tickets[ticket] = &sseTicket{Token: token, ClientID: accessToken.ClientID, ExpiresAt: now.Add(ticketTTL)}
+	w.mu.Unlock()
+
+	slog.DebugContext(r.Context(), "Issued SSE ticket", "client_id", accessToken.ClientID)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(TicketResponse{Ticket: ticket, ExpiresIn: int(ticketTTL.Seconds())})
+}
+
+// redeemTicket consumes a ticket and returns the access token it stands in for. It fails if the
+// ticket is unknown, used or expired, or its token no longer belongs to the same client.
+func (w *OAuthWrapper) redeemTicket(ticket string) (string, bool) {
+	w.mu.Lock()
+	st, exists := w.tickets[ticket]
+	delete(w.tickets, ticket) // Use once only
+	w.mu.Unlock()
+	if !exists || w.now().After(st.ExpiresAt) {
+		return "", false
+	}
+
+	accessToken, exists := w.accessTokens.Get(st.Token)
+	if !exists || accessToken.ClientID != st.ClientID {
+		return "", false
+	}
+	return st.Token, true
+}
+
+// ticketAuthorization lets an /sse request without an Authorization header authenticate with a
+// ticket, presenting its token to authenticate as a bearer token. The ticket is always removed from
+// the URL, even when a header takes precedence, so it isn't forwarded to the MCP server. On failure it
+// writes the 401 response and returns false.
+func (w *OAuthWrapper) ticketAuthorization(rw http.ResponseWriter, r *http.Request) bool {
+	q := r.URL.Query()
+	if !q.Has(ticketParam) {
+		return true
+	}
+	ticket := q.Get(ticketParam)
+	q.Del(ticketParam)
+	r.URL.RawQuery = q.Encode()
+	if ticket == "" || r.Header.Get("Authorization") != "" {
+		return true
+	}
+
+	token, ok := w.redeemTicket(ticket)
+	if !ok {
+		w.writeTokenError(rw, w.publicURL+r.URL.Path, &oauthError{http.StatusUnauthorized, "invalid_token", "Ticket is unknown, expired or already used"}, true)
+		return false
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return true
+}
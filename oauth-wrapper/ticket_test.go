@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSETicket(t *testing.T) {
+	forwarded := make(chan *http.Request, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			forwarded <- r
+		}
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ticketEndpoint, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a ticket request without a token to be rejected, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, ticketEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp TicketResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.Ticket, ticketMarker) || resp.ExpiresIn != int(ticketTTL.Seconds()) {
+		t.Errorf("unexpected ticket response %+v", resp)
+	}
+
+	sse := func() int {
+		rec := httptest.NewRecorder()
+		w.handleSSEProxy(rec, httptest.NewRequest(http.MethodGet, "/sse?ticket="+resp.Ticket+"&x=1", nil))
+		return rec.Code
+	}
+	if code := sse(); code != http.StatusOK {
+		t.Fatalf("expected the ticket to open the stream, got %d", code)
+	}
+	r := <-forwarded
+	if r.URL.Query().Has(ticketParam) || r.URL.Query().Get("x") != "1" {
+		t.Errorf("expected only the ticket to be removed from the forwarded URL, got %q", r.URL.RawQuery)
+	}
+	if strings.Contains(r.Header.Get("Authorization"), "token") {
+		t.Error("the access token must not reach the backend")
+	}
+
+	if code := sse(); code != http.StatusUnauthorized {
+		t.Errorf("expected a used ticket to be rejected, got %d", code)
+	}
+}
+
+func TestSSETicketStrippedWithAuthorizationHeader(t *testing.T) {
+	forwarded := make(chan *http.Request, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			forwarded <- r
+		}
+	}))
+	defer backend.Close()
+
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/sse?ticket=tkt_leaked&x=1", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	w.handleSSEProxy(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the header to authenticate the stream, got %d", rec.Code)
+	}
+	if r := <-forwarded; r.URL.RawQuery != "x=1" {
+		t.Errorf("expected the ticket to be removed from the forwarded URL, got %q", r.URL.RawQuery)
+	}
+}
+
+func TestRedeemTicketRejectsExpiredAndRevoked(t *testing.T) {
+	now := time.Now()
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.now = func() time.Time { return now }
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: now.Add(time.Hour)})
+	w.tickets["expired"] = &sseTicket{Token: "token", ClientID: "client", ExpiresAt: now.Add(-time.Second)}
+	w.tickets["revoked"] = &sseTicket{Token: "gone", ClientID: "client", ExpiresAt: now.Add(time.Minute)}
+	w.tickets["other-client"] = &sseTicket{Token: "token", ClientID: "other", ExpiresAt: now.Add(time.Minute)}
+
+	for _, ticket := range []string{"expired", "revoked", "other-client", "unknown"} {
+		if _, ok := w.redeemTicket(ticket); ok {
+			t.Errorf("expected ticket %q to be rejected", ticket)
+		}
+	}
+	if len(w.tickets) != 0 {
+		t.Error("expected every presented ticket to be consumed")
+	}
+}
+
+func TestSSETicketRefusesDPoPBoundTokens(t *testing.T) {
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.dpop = true
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour), DPoPThumbprint: "thumb"})
+
+	req := httptest.NewRequest(http.MethodPost, ticketEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	w.handleSSETicket(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Error("expected a DPoP-bound token not to be exchanged for a ticket")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// newServer builds an http.Server with the configured timeouts, so slow or stalled clients can't
+// hold connections open on the token and registration endpoints. Proxied streams lift the read and
+// write timeouts for themselves once authenticated; see clearDeadlines.
+func newServer(addr string, handler http.Handler, cfg *Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// clearDeadlines lifts the server's read and write timeouts for a proxied MCP stream, which may
+// stay open for as long as the session lasts; the SSE idle timeout and heartbeats bound it instead.
+// Writers that don't support deadlines, such as test recorders, are left alone.
+func clearDeadlines(rw http.ResponseWriter) {
+	rc := http.NewResponseController(rw)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewServerTimeouts(t *testing.T) {
+	cfg := &Config{ReadHeaderTimeout: time.Second, ReadTimeout: 2 * time.Second, WriteTimeout: 3 * time.Second, IdleTimeout: 4 * time.Second}
+	server := newServer(":0", http.NotFoundHandler(), cfg)
+	if server.ReadHeaderTimeout != time.Second || server.ReadTimeout != 2*time.Second || server.WriteTimeout != 3*time.Second || server.IdleTimeout != 4*time.Second {
+		t.Errorf("timeouts not applied: %+v", server)
+	}
+}
+
+func TestProxiedStreamOutlivesServerTimeouts(t *testing.T) {
+	canceled := make(chan time.Time, 1)
+	backend := sseBackend(t, 20*time.Millisecond, canceled)
+	w := newTestWrapper(backend.URL)
+	w.accessTokens.Set("token", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	cfg := &Config{ReadTimeout: 50 * time.Millisecond, WriteTimeout: 50 * time.Millisecond}
+	wrapperServer := httptest.NewUnstartedServer(nil)
+	wrapperServer.Config = newServer("", w.routes(), cfg)
+	wrapperServer.Start()
+	t.Cleanup(wrapperServer.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, wrapperServer.URL+"/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	go io.Copy(io.Discard, resp.Body)
+
+	select {
+	case <-canceled:
+		t.Fatal("the stream was cut off by the server timeouts")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Other routes still get the write timeout
+	slow := newServer("", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		rw.Write([]byte("late"))
+	}), cfg)
+	slowServer := httptest.NewUnstartedServer(nil)
+	slowServer.Config = slow
+	slowServer.Start()
+	t.Cleanup(slowServer.Close)
+	if resp, err := http.Get(slowServer.URL); err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) == "late" {
+			t.Error("expected the write timeout to cut off a slow response")
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeRequestsLogsSlowRequests(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(contextHandler{slog.NewTextHandler(&buf, nil)}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.slowRequestThreshold = 20 * time.Millisecond
+	handler := w.timeRequests(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			setRequestClient(r.Context(), "client-1")
+			time.Sleep(30 * time.Millisecond)
+			rw.WriteHeader(http.StatusBadRequest)
+		case "/authorize":
+			time.Sleep(30 * time.Millisecond)
+			rw.WriteHeader(http.StatusFound)
+		case "/sse":
+			rw.Header().Set("Content-Type", "text/event-stream")
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	serve := func(method, target string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+	}
+
+	observed := requestDurationSeconds.count
+	serve(http.MethodPost, "/token")
+	logged := buf.String()
+	for _, want := range []string{"Slow request", "method=POST", "path=/token", "status=400", "client_id=client-1", "duration="} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("expected %q in the slow request log, got:\n%s", want, logged)
+		}
+	}
+
+	// Without an authenticated client, the client_id parameter identifies it
+	buf.Reset()
+	serve(http.MethodGet, "/authorize?client_id=client-2")
+	if !strings.Contains(buf.String(), "client_id=client-2") || !strings.Contains(buf.String(), "status=302") {
+		t.Errorf("expected the slow /authorize logged with its client_id, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	serve(http.MethodGet, "/health")
+	if buf.Len() != 0 {
+		t.Errorf("expected a fast request not to be logged, got:\n%s", buf.String())
+	}
+
+	serve(http.MethodGet, "/sse")
+	if buf.Len() != 0 {
+		t.Errorf("expected an event stream not to be logged as slow, got:\n%s", buf.String())
+	}
+	if got := requestDurationSeconds.count - observed; got != 3 {
+		t.Errorf("expected 3 request durations observed without the stream, got %d", got)
+	}
+
+	w.slowRequestThreshold = 0
+	serve(http.MethodPost, "/token")
+	if buf.Len() != 0 {
+		t.Errorf("expected no slow request log with the threshold off, got:\n%s", buf.String())
+	}
+}
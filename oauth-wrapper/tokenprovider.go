@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenProvider supplies the Slack token the wrapper calls Slack with. Deployments that keep the
+// token in a secret manager, or rotate it, set SLACK_MCP_OAUTH_SLACK_TOKEN_COMMAND instead of
+// SLACK_MCP_XOXP_TOKEN, or implement this interface.
+type TokenProvider interface {
+	SlackToken(ctx context.Context) (string, error)
+}
+
+// errNoSlackToken is returned by the static provider when no Slack token is configured
+var errNoSlackToken = errors.New("no Slack token configured")
+
+// staticTokenProvider is the default provider: the token from the environment or flags, following
+// SIGHUP reloads
+type staticTokenProvider struct {
+	secrets func() *secrets
+}
+
+func (p staticTokenProvider) SlackToken(context.Context) (string, error) {
+	if token := p.secrets().slackCredential(); token != "" {
+		return token, nil
+	}
+	return "", errNoSlackToken
+}
+
+// tokenCommandTimeout bounds one run of the Slack token command
+const tokenCommandTimeout = 10 * time.Second
+
+// commandTokenProvider runs a shell command, such as a Vault or AWS CLI call, and uses what it prints
+// as the Slack token
+type commandTokenProvider struct {
+	command string
+}
+
+func (p commandTokenProvider) SlackToken(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+	defer cancel()
+	// Stderr is left out of the error, since it may echo the secret
+	out, err := exec.CommandContext(ctx, "sh", "-c", p.command).Output()
+	if err != nil {
+		return "", fmt.Errorf("slack token command: %w", err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", errors.New("slack token command printed no token")
+	}
+	return token, nil
+}
+
+// cachedTokenProvider reuses the last token from a slower provider for ttl, so secret managers
+// aren't called on every request. Failures aren't cached.
+type cachedTokenProvider struct {
+	next TokenProvider
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newCachedTokenProvider(next TokenProvider, ttl time.Duration) *cachedTokenProvider {
+	return &cachedTokenProvider{next: next, ttl: ttl, now: time.Now}
+}
+
+func (p *cachedTokenProvider) SlackToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if p.token != "" && now.Before(p.expiresAt) {
+		return p.token, nil
+	}
+	token, err := p.next.SlackToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.token, p.expiresAt = token, now.Add(p.ttl)
+	return token, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+const tokenShardCount = 32
+
+type tokenShard struct {
+	mu     sync.RWMutex
+	tokens map[string]*AccessToken
+}
+
+// shardedTokenMap spreads access tokens over several independently locked shards
+// so concurrent lookups and inserts only contend within a shard. It also indexes tokens by
+// client, so per-client limits don't need to scan every shard.
+type shardedTokenMap struct {
+	seed   maphash.Seed
+	shards [tokenShardCount]tokenShard
+
+	// byClient holds each client's tokens; it is only changed while the token's shard is locked
+	indexMu  sync.Mutex
+	byClient map[string]map[string]struct{}
+}
+
+func newShardedTokenMap() *shardedTokenMap {
+	m := &shardedTokenMap{seed: maphash.MakeSeed(), byClient: make(map[string]map[string]struct{})}
+	for i := range m.shards {
+		m.shards[i].tokens = make(map[string]*AccessToken)
+	}
+	return m
+}
+
+// index records token under clientID
+func (m *shardedTokenMap) index(clientID, token string) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	tokens := m.byClient[clientID]
+	if tokens == nil {
+		tokens = make(map[string]struct{})
+		m.byClient[clientID] = tokens
+	}
+	tokens[token] = struct{}{}
+}
+
+// unindex removes token from clientID's tokens
+func (m *shardedTokenMap) unindex(clientID, token string) {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	delete(m.byClient[clientID], token)
+	if len(m.byClient[clientID]) == 0 {
+		delete(m.byClient, clientID)
+	}
+}
+
+// shard picks the shard for a token from its hash
+func (m *shardedTokenMap) shard(token string) *tokenShard {
+	return &m.shards[maphash.String(m.seed, token)%tokenShardCount]
+}
+
+func (m *shardedTokenMap) Get(token string) (*AccessToken, bool) {
+	s := m.shard(token)
+	s.mu.RLock()
+	at, ok := s.tokens[token]
+	s.mu.RUnlock()
+	return at, ok
+}
+
+func (m *shardedTokenMap) Set(token string, at *AccessToken) {
+	s := m.shard(token)
+	s.mu.Lock()
+	if prev, ok := s.tokens[token]; ok {
+		m.unindex(prev.ClientID, token)
+	}
+	s.tokens[token] = at
+	m.index(at.ClientID, token)
+	s.mu.Unlock()
+}
+
+func (m *shardedTokenMap) Delete(token string) {
+	s := m.shard(token)
+	s.mu.Lock()
+	if at, ok := s.tokens[token]; ok {
+		m.unindex(at.ClientID, token)
+		delete(s.tokens, token)
+	}
+	s.mu.Unlock()
+}
+
+// Clear removes every token and returns how many there were
+func (m *shardedTokenMap) Clear() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		n += len(s.tokens)
+		for token, at := range s.tokens {
+			m.unindex(at.ClientID, token)
+		}
+		clear(s.tokens)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// ClientTokens returns the tokens currently held for clientID
+func (m *shardedTokenMap) ClientTokens(clientID string) []string {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	tokens := make([]string, 0, len(m.byClient[clientID]))
+	for token := range m.byClient[clientID] {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// ClientCounts returns how many tokens each client holds
+func (m *shardedTokenMap) ClientCounts() map[string]int {
+	m.indexMu.Lock()
+	defer m.indexMu.Unlock()
+	counts := make(map[string]int, len(m.byClient))
+	for clientID, tokens := range m.byClient {
+		counts[clientID] = len(tokens)
+	}
+	return counts
+}
+
+func (m *shardedTokenMap) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += len(s.tokens)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Range calls fn for every token until it returns false. Each shard is locked while it is visited,
+// so fn must not call back into the map.
+func (m *shardedTokenMap) Range(fn func(token string, at *AccessToken) bool) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for token, at := range s.tokens {
+			if !fn(token, at) {
+				s.mu.RUnlock()
+				return
+			}
+		}
+		s.mu.RUnlock()
+	}
+}
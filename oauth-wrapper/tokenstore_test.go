@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedTokenMap(t *testing.T) {
+	m := newShardedTokenMap()
+	for i := 0; i < 100; i++ {
+		m.Set("token-"+strconv.Itoa(i), &AccessToken{ClientID: strconv.Itoa(i)})
+	}
+
+	if got := m.Len(); got != 100 {
+		t.Fatalf("expected 100 tokens, got %d", got)
+	}
+	at, ok := m.Get("token-42")
+	if !ok || at.ClientID != "42" {
+		t.Fatalf("unexpected lookup result: %v %v", at, ok)
+	}
+
+	m.Delete("token-42")
+	if _, ok := m.Get("token-42"); ok {
+		t.Error("expected token to be deleted")
+	}
+
+	seen := 0
+	m.Range(func(string, *AccessToken) bool {
+		seen++
+		return true
+	})
+	if seen != 99 {
+		t.Errorf("expected Range to visit 99 tokens, got %d", seen)
+	}
+}
+
+func TestShardedTokenMapIndexesByClient(t *testing.T) {
+	m := newShardedTokenMap()
+	m.Set("a1", &AccessToken{ClientID: "a"})
+	m.Set("a2", &AccessToken{ClientID: "a"})
+	m.Set("b1", &AccessToken{ClientID: "b"})
+
+	if got := len(m.ClientTokens("a")); got != 2 {
+		t.Errorf("expected 2 tokens for client a, got %d", got)
+	}
+
+	// Replacing a token under another client moves it in the index
+	m.Set("a2", &AccessToken{ClientID: "b"})
+	m.Delete("a1")
+	if counts := m.ClientCounts(); counts["a"] != 0 || counts["b"] != 2 || len(counts) != 1 {
+		t.Errorf("expected only client b with 2 tokens, got %v", counts)
+	}
+
+	m.Clear()
+	if counts := m.ClientCounts(); len(counts) != 0 {
+		t.Errorf("expected Clear to empty the index, got %v", counts)
+	}
+}
+
+// lockedTokenMap is the previous single-mutex layout, kept for comparison
+type lockedTokenMap struct {
+	mu     sync.RWMutex
+	tokens map[string]*AccessToken
+}
+
+func (m *lockedTokenMap) Get(token string) (*AccessToken, bool) {
+	m.mu.RLock()
+	at, ok := m.tokens[token]
+	m.mu.RUnlock()
+	return at, ok
+}
+
+func (m *lockedTokenMap) Set(token string, at *AccessToken) {
+	m.mu.Lock()
+	m.tokens[token] = at
+	m.mu.Unlock()
+}
+
+type tokenMap interface {
+	Get(token string) (*AccessToken, bool)
+	Set(token string, at *AccessToken)
+}
+
+// Compare with -cpu 1,8,32: sharding costs one extra hash per call, which pays off once
+// enough goroutines contend on the single RWMutex
+func benchmarkTokenMap(b *testing.B, m tokenMap) {
+	const n = 1024
+	tokens := make([]string, n)
+	for i := range tokens {
+		tokens[i] = generateRandomString(64)
+		m.Set(tokens[i], &AccessToken{ExpiresAt: time.Now().Add(time.Hour)})
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			// Mostly reads with the occasional issuance, like SSE churn
+			if i%64 == 0 {
+				m.Set(tokens[i%n], &AccessToken{ExpiresAt: time.Now().Add(time.Hour)})
+			} else {
+				m.Get(tokens[i%n])
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkTokenLookupLocked(b *testing.B) {
+	benchmarkTokenMap(b, &lockedTokenMap{tokens: make(map[string]*AccessToken)})
+}
+
+func BenchmarkTokenLookupSharded(b *testing.B) {
+	benchmarkTokenMap(b, newShardedTokenMap())
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a token's Slack profile is reused before /userinfo asks Slack again
+const userInfoCacheTTL = 5 * time.Minute
+
+const defaultSlackAPIURL = "https://slack.com/api"
+
+// UserInfo is the /userinfo response: standard OIDC claims plus Slack's namespaced team claims
+type UserInfo struct {
+	Sub               string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	TeamID            string `json:"https://slack.com/team_id,omitempty"`
+	TeamName          string `json:"https://slack.com/team_name,omitempty"`
+}
+
+type cachedUserInfo struct {
+	info      *UserInfo
+	expiresAt time.Time
+}
+
+// userInfoCache holds recent Slack profiles keyed by access token
+type userInfoCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedUserInfo
+}
+
+func (c *userInfoCache) get(token string, now time.Time) (*UserInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[token]
+	if !ok || now.After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.info, true
+}
+
+func (c *userInfoCache) set(token string, info *UserInfo, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedUserInfo)
+	}
+	// Drop stale entries so revoked and expired tokens don't pile up
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[token] = cachedUserInfo{info: info, expiresAt: now.Add(userInfoCacheTTL)}
+}
+
+// clear forgets every cached profile
+func (c *userInfoCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// slackCredential returns the Slack token in effect, preferring the user token like Config.SlackCredential
+func (s *secrets) slackCredential() string {
+	if s.SlackToken != "" {
+		return s.SlackToken
+	}
+	return s.SlackBotToken
+}
+
+// Handle OpenID Connect userinfo: the Slack identity behind the workspace token
+func (w *OAuthWrapper) handleUserInfo(rw http.ResponseWriter, r *http.Request) {
+	// Userinfo belongs to the authorization server, so tokens bound to any resource may use it
+	token, _, ok := w.authenticate(rw, r, "")
+	if !ok {
+		return
+	}
+
+	now := w.now()
+	info, ok := w.userInfo.get(token, now)
+	if !ok {
+		slackToken, err := w.slackTokens.SlackToken(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Slack token provider failed", "error", err)
+			writeJSONError(rw, http.StatusServiceUnavailable, "temporarily_unavailable", "The Slack token is unavailable")
+			return
+		}
+		info, err = w.fetchSlackIdentity(r.Context(), slackToken)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Slack identity lookup failed", "error", err)
+			writeJSONError(rw, http.StatusBadGateway, "server_error", "Could not look up the Slack identity")
+			return
+		}
+		w.userInfo.set(token, info, now)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(info)
+}
+
+// fetchSlackIdentity asks Slack who the workspace token belongs to (auth.test), then fills in the
+// name and email from users.info when the token has the scopes for it
+func (w *OAuthWrapper) fetchSlackIdentity(ctx context.Context, slackToken string) (*UserInfo, error) {
+	var auth struct {
+		UserID string `json:"user_id"`
+		User   string `json:"user"`
+		TeamID string `json:"team_id"`
+		Team   string `json:"team"`
+	}
+	if err := w.callSlack(ctx, slackToken, "auth.test", nil, &auth); err != nil {
+		return nil, err
+	}
+	info := &UserInfo{
+		Sub:               auth.UserID,
+		PreferredUsername: auth.User,
+		TeamID:            auth.TeamID,
+		TeamName:          auth.Team,
+	}
+
+	var user struct {
+		User struct {
+			RealName string `json:"real_name"`
+			Profile  struct {
+				Email string `json:"email"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	if err := w.callSlack(ctx, slackToken, "users.info", url.Values{"user": {auth.UserID}}, &user); err != nil {
+		// users:read or users:read.email may be missing; the identity alone is still useful
+		slog.DebugContext(ctx, "Slack users.info failed, returning identity only", "error", err)
+		return info, nil
+	}
+	info.Name = user.User.RealName
+	info.Email = user.User.Profile.Email
+	return info, nil
+}
+
+// callSlack POSTs a Web API method and decodes the response, turning "ok": false into an error
+func (w *OAuthWrapper) callSlack(ctx context.Context, token, method string, params url.Values, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.slackAPIURL+"/"+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", method, resp.StatusCode)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("%s: decode response: %w", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return fmt.Errorf("%s: decode response: %w", method, err)
+	}
+	if !status.OK {
+		if status.Error == "" {
+			return errors.New(method + " failed")
+		}
+		return fmt.Errorf("%s: %s", method, status.Error)
+	}
+	return json.Unmarshal(raw, out)
+}
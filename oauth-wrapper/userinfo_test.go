@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func slackAPI(t *testing.T, usersInfo bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxp-test" {
+			io.WriteString(rw, `{"ok":false,"error":"invalid_auth"}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/auth.test":
+			calls.Add(1)
+			io.WriteString(rw, `{"ok":true,"user_id":"U123","user":"pete","team_id":"T456","team":"Acme"}`)
+		case "/users.info":
+			if !usersInfo || r.FormValue("user") != "U123" {
+				io.WriteString(rw, `{"ok":false,"error":"missing_scope"}`)
+				return
+			}
+			io.WriteString(rw, `{"ok":true,"user":{"real_name":"Pete P","profile":{"email":"pete@example.com"}}}`)
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestHandleUserInfo(t *testing.T) {
+	slack, calls := slackAPI(t, true)
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.secrets.Store(&secrets{SlackToken: "xoxp-test"})
+	w.slackAPIURL = slack.URL
+	w.accessTokens.Set("valid", &AccessToken{ClientID: "client", Audience: []string{"http://localhost:8080/sse"}, ExpiresAt: time.Now().Add(time.Hour)})
+	w.accessTokens.Set("expired", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"unknown token", "Bearer nope", http.StatusUnauthorized},
+		{"expired token", "Bearer expired", http.StatusUnauthorized},
+		{"valid token", "Bearer valid", http.StatusOK},
+		{"valid token again", "Bearer valid", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			w.routes().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var info UserInfo
+			if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+				t.Fatal(err)
+			}
+			want := UserInfo{Sub: "U123", Name: "Pete P", PreferredUsername: "pete", Email: "pete@example.com", TeamID: "T456", TeamName: "Acme"}
+			if info != want {
+				t.Errorf("got %+v, want %+v", info, want)
+			}
+		})
+	}
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected the profile to be cached after one Slack call, got %d calls", got)
+	}
+}
+
+func TestHandleUserInfoWithoutUsersRead(t *testing.T) {
+	slack, _ := slackAPI(t, false)
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.secrets.Store(&secrets{SlackToken: "xoxp-test"})
+	w.slackAPIURL = slack.URL
+	w.accessTokens.Set("valid", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var info UserInfo
+	json.NewDecoder(rec.Body).Decode(&info)
+	if info.Sub != "U123" || info.TeamID != "T456" || info.Email != "" {
+		t.Errorf("expected the auth.test identity only, got %+v", info)
+	}
+}
+
+func TestHandleUserInfoSlackFailure(t *testing.T) {
+	slack, _ := slackAPI(t, true)
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.secrets.Store(&secrets{SlackToken: "xoxp-revoked"})
+	w.slackAPIURL = slack.URL
+	w.accessTokens.Set("valid", &AccessToken{ClientID: "client", ExpiresAt: time.Now().Add(time.Hour)})
+
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d: %s", rec.Code, rec.Body)
+	}
+}
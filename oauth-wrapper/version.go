@@ -0,0 +1,24 @@
+package main
+
+// Build information, overridden at build time via
+// -ldflags "-X main.Version=... -X main.CommitHash=... -X main.BuildTime=..."
+var (
+	Version    = "0.0.0"
+	CommitHash = "unknown"
+	BuildTime  = "1970-01-01T00:00:00Z"
+)
+
+// BuildInfo is returned by the /version endpoint
+type BuildInfo struct {
+	Version    string `json:"version"`
+	CommitHash string `json:"commit"`
+	BuildTime  string `json:"build_time"`
+}
+
+func buildInfo() BuildInfo {
+	return BuildInfo{
+		Version:    Version,
+		CommitHash: CommitHash,
+		BuildTime:  BuildTime,
+	}
+}
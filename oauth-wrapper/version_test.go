@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleVersion(t *testing.T) {
+	version, commit, built := Version, CommitHash, BuildTime
+	t.Cleanup(func() { Version, CommitHash, BuildTime = version, commit, built })
+	// As set by -ldflags "-X main.Version=..." at build time
+	Version, CommitHash, BuildTime = "1.2.3", "abc1234", "2026-01-02T03:04:05Z"
+
+	w := newTestWrapper("http://127.0.0.1:13080")
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected 200 with JSON, got %d (%s)", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var fields map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&fields); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "1.2.3", "commit": "abc1234", "build_time": "2026-01-02T03:04:05Z"}
+	if len(fields) != len(want) {
+		t.Errorf("expected exactly %v, got %v", want, fields)
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("expected %s %q, got %q", key, value, fields[key])
+		}
+	}
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		w.routes().ServeHTTP(rec, httptest.NewRequest(method, "/version", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s /version: expected 405, got %d", method, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// registrationWebhookTimeout bounds a webhook delivery, so a slow receiver can't pile up goroutines
+const registrationWebhookTimeout = 10 * time.Second
+
+// RegistrationEvent is POSTed to the registration webhook after a client registers. It never
+// includes the client secret.
+type RegistrationEvent struct {
+	Event        string    `json:"event"`
+	ClientID     string    `json:"client_id"`
+	ClientName   string    `json:"client_name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	RemoteIP     string    `json:"remote_ip"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// notifyRegistration delivers the event to the registration webhook, if one is configured, without
+// blocking the caller. Failures are logged; the registration has already succeeded.
+func (w *OAuthWrapper) notifyRegistration(r *http.Request, client *ClientRegistrationResponse) {
+	if w.registrationWebhook == "" {
+		return
+	}
+	event := RegistrationEvent{
+		Event:        "client.registered",
+		ClientID:     client.ClientID,
+		ClientName:   client.ClientName,
+		RedirectURIs: client.RedirectURIs,
+		RemoteIP:     clientIP(r),
+		Timestamp:    time.Unix(client.ClientIDIssuedAt, 0).UTC(),
+	}
+
+	// Keep the request's log attributes but not its cancellation, which comes with the response
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		if err := w.deliverWebhook(ctx, event); err != nil {
+			slog.WarnContext(ctx, "Registration webhook delivery failed", "client_id", event.ClientID, "error", err)
+		}
+	}()
+}
+
+func (w *OAuthWrapper) deliverWebhook(ctx context.Context, event RegistrationEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, registrationWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.registrationWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
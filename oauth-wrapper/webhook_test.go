@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistrationWebhook(t *testing.T) {
+	events := make(chan map[string]any, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer hook.Close()
+
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.registrationWebhook, w.webhookClient = hook.URL, hook.Client()
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"client_name":"Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"]}`))
+	req.RemoteAddr = "203.0.113.7:51234"
+	rec := httptest.NewRecorder()
+	w.handleRegistration(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var registered ClientRegistrationResponse
+	json.NewDecoder(rec.Body).Decode(&registered)
+
+	select {
+	case event := <-events:
+		if event["client_id"] != registered.ClientID || event["client_name"] != "Claude" || event["remote_ip"] != "203.0.113.7" {
+			t.Errorf("unexpected event %v", event)
+		}
+		if _, ok := event["client_secret"]; ok {
+			t.Error("the webhook must never receive the client secret")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a webhook delivery")
+	}
+}
+
+func TestRegistrationWebhookFailureDoesNotFailRegistration(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hook.Close()
+
+	w := newTestWrapper("http://127.0.0.1:13080")
+	w.registrationWebhook, w.webhookClient = hook.URL, hook.Client()
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	w.handleRegistration(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"client_name":"Claude","redirect_uris":["https://claude.ai/api/mcp/auth_callback"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the registration to succeed, got %d", rec.Code)
+	}
+	if time.Since(start) >= 100*time.Millisecond {
+		t.Error("registration must not wait for the webhook")
+	}
+	if err := w.deliverWebhook(context.Background(), RegistrationEvent{ClientID: "c"}); err == nil {
+		t.Error("expected a 500 from the webhook to be reported")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WhoAmI is what /whoami tells a client about its own access token
+type WhoAmI struct {
+	ClientID  string    `json:"client_id"`
+	TokenType string    `json:"token_type"`
+	Scope     string    `json:"scope,omitempty"`
+	Audience  []string  `json:"audience,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresIn int       `json:"expires_in"`
+	// TeamName is the Slack workspace, when /userinfo has recently looked it up for this token
+	TeamName string `json:"team_name,omitempty"`
+}
+
+// Handle token self-introspection: the caller's own token, validated as the proxy does, described
+// without anything that would help use it. Only the presented token is ever looked up.
+func (w *OAuthWrapper) handleWhoAmI(rw http.ResponseWriter, r *http.Request) {
+	// Like /userinfo, this belongs to the authorization server, so tokens bound to any resource may use it
+	token, accessToken, ok := w.authenticate(rw, r, "")
+	if !ok {
+		return
+	}
+
+	now := w.now()
+	whoami := WhoAmI{
+		ClientID:  accessToken.ClientID,
+		TokenType: accessToken.TokenType(),
+		Scope:     strings.Join(accessToken.Scopes, " "),
+		Audience:  accessToken.Audience,
+		ExpiresAt: accessToken.ExpiresAt.UTC(),
+		ExpiresIn: max(int(accessToken.ExpiresAt.Sub(now).Seconds()), 0),
+	}
+	if info, ok := w.userInfo.get(token, now); ok {
+		whoami.TeamName = info.TeamName
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(whoami)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWhoAmI(t *testing.T) {
+	now := time.Now()
+	w := newOAuthTestWrapper(now)
+	w.accessTokens.Set("mine", &AccessToken{ClientID: "client", Scopes: []string{"mcp:stream"}, ExpiresAt: now.Add(time.Hour)})
+	w.accessTokens.Set("theirs", &AccessToken{ClientID: "other", ExpiresAt: now.Add(time.Hour)})
+	w.userInfo.set("mine", &UserInfo{Sub: "U123", TeamName: "Acme"}, now)
+
+	whoami := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/whoami?client_id=other&token=theirs", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		w.routes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := whoami("Bearer mine")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var got WhoAmI
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ClientID != "client" || got.Scope != "mcp:stream" || got.TokenType != tokenTypeBearer || got.TeamName != "Acme" || got.ExpiresIn != 3600 {
+		t.Errorf("expected the caller's own token, ignoring query parameters, got %+v", got)
+	}
+	if strings.Contains(rec.Body.String(), "mine") {
+		t.Error("the response must not echo the token")
+	}
+
+	for _, authorization := range []string{"", "Bearer unknown"} {
+		if rec := whoami(authorization); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", authorization, rec.Code)
+		}
+	}
+}